@@ -1,138 +1,56 @@
 package main
 
 import (
-	"encoding/binary"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
-)
 
-const (
-	headerFlag = 0x00
-	dataFlag   = 0xFF
+	"zxgotools/pkg/basic"
+	"zxgotools/pkg/tap"
 )
 
-// TAPHeader represents a TAP file header block
-type TAPHeader struct {
-	Type        byte
-	Filename    string
-	DataLength  uint16
-	Param1      uint16
-	Param2      uint16
-	Checksum    byte
-}
-
-// TAPBlock represents a block in a TAP file
-type TAPBlock struct {
-	Length   uint16
-	Flag     byte
-	Data     []byte
-	Checksum byte
-	Header   *TAPHeader
-}
-
-// parseHeader creates a TAPHeader from raw bytes
-func parseHeader(headerData []byte, checksum byte) (*TAPHeader, error) {
-	if len(headerData) != 17 { // Header should be exactly 17 bytes (without checksum)
-		return nil, fmt.Errorf("invalid header data length: %d", len(headerData))
-	}
-
-	// Extract filename (10 bytes) and trim spaces
-	filename := strings.TrimRight(string(headerData[1:11]), " ")
-
-	return &TAPHeader{
-		Type:       headerData[0],
-		Filename:   filename,
-		DataLength: binary.LittleEndian.Uint16(headerData[11:13]),
-		Param1:     binary.LittleEndian.Uint16(headerData[13:15]),
-		Param2:     binary.LittleEndian.Uint16(headerData[15:17]),
-		Checksum:   checksum,
-	}, nil
-}
-
-// readTAPFile reads a TAP file and returns a slice of TAPBlock
-func readTAPFile(filename string) ([]TAPBlock, error) {
+// readTAPFile reads all blocks from a TAP file
+func readTAPFile(filename string) ([]*tap.Block, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("opening file: %w", err)
 	}
 	defer file.Close()
 
-	var blocks []TAPBlock
-
-	for {
-		// Read block length (2 bytes, little-endian)
-		var length uint16
-		if err := binary.Read(file, binary.LittleEndian, &length); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, fmt.Errorf("reading block length: %w", err)
-		}
-
-		// Read flag byte
-		var flag byte
-		if err := binary.Read(file, binary.LittleEndian, &flag); err != nil {
-			return nil, fmt.Errorf("reading flag: %w", err)
-		}
-
-		// Read block data (excluding checksum)
-		data := make([]byte, length-2) // -2 for flag and checksum
-		if _, err := io.ReadFull(file, data); err != nil {
-			return nil, fmt.Errorf("reading data: %w", err)
-		}
-
-		// Read checksum
-		var checksum byte
-		if err := binary.Read(file, binary.LittleEndian, &checksum); err != nil {
-			return nil, fmt.Errorf("reading checksum: %w", err)
-		}
-
-		block := TAPBlock{
-			Length:   length,
-			Flag:     flag,
-			Data:     data,
-			Checksum: checksum,
-		}
-
-		// If this is a header block (flag = 0x00 and length = 0x13)
-		if flag == headerFlag && length == 0x13 {
-			if header, err := parseHeader(data, checksum); err == nil {
-				block.Header = header
-			} else {
-				fmt.Fprintf(os.Stderr, "Warning: Failed to parse header: %v\n", err)
-			}
-		}
-
-		blocks = append(blocks, block)
-	}
-
-	return blocks, nil
+	return tap.ReadBlocks(file)
 }
 
 // printBlockInfo prints information about a TAP block
-func printBlockInfo(block TAPBlock, index int) {
+func printBlockInfo(block *tap.Block, index int) {
 	fmt.Printf("\nBlock %d:\n", index)
-	fmt.Printf("  Length: %d\n", block.Length)
+	fmt.Printf("  Length: %d\n", block.Length())
 	fmt.Printf("  Flag: 0x%02X (%s)\n", block.Flag, flagTypeString(block.Flag))
 
 	if block.Header != nil {
 		fmt.Println("  Header Information:")
 		fmt.Printf("    Type: %d\n", block.Header.Type)
-		fmt.Printf("    Filename: %s\n", block.Header.Filename)
+		fmt.Printf("    Filename: %s\n", block.Header.Name())
 		fmt.Printf("    Data Length: %d\n", block.Header.DataLength)
 		fmt.Printf("    Param1: %d\n", block.Header.Param1)
 		fmt.Printf("    Param2: %d\n", block.Header.Param2)
 	}
-	fmt.Printf("  Checksum: 0x%02X\n", block.Checksum)
+	if block.Valid() {
+		fmt.Printf("  Checksum: 0x%02X\n", block.Checksum)
+	} else {
+		fmt.Printf("  Checksum: 0x%02X (BAD, computed 0x%02X)\n", block.Checksum, block.Computed)
+	}
 	fmt.Printf("  Data Length: %d bytes\n", len(block.Data))
 }
 
 // flagTypeString returns a string description of the flag type
 func flagTypeString(flag byte) string {
-	if flag == headerFlag {
+	if flag == tap.HeaderFlag {
 		return "Header"
 	}
 	return "Data"
@@ -156,27 +74,230 @@ func dumpHex(data []byte) {
 	}
 }
 
+// droppedBlock returns the read error for a file that ends before any
+// of its last block, which leaves nothing to rebuild, or nil
+func droppedBlock(blocks []*tap.Block, readErr error) error {
+	if readErr == nil || len(blocks) > 0 && blocks[len(blocks)-1].Missing > 0 {
+		return nil
+	}
+	return readErr
+}
+
+// verifyTAP prints every problem found in the blocks, and the error from
+// reading a file that ends part way through a block, and returns their
+// count
+func verifyTAP(blocks []*tap.Block, filename string, readErr error) int {
+	problems := tap.Verify(blocks)
+	for _, problem := range problems {
+		fmt.Printf("%s: %s\n", filename, problem)
+	}
+	count := len(problems)
+	if err := droppedBlock(blocks, readErr); err != nil {
+		fmt.Printf("%s: %v\n", filename, err)
+		count++
+	}
+	if count == 0 {
+		fmt.Printf("%s: %d blocks OK\n", filename, len(blocks))
+	}
+	return count
+}
+
+// repairTAP fixes checksums (and optionally header lengths) and writes
+// the corrected blocks to outputFile. A last block cut short is rebuilt
+// from what remains, or dropped if nothing of it remains.
+func repairTAP(blocks []*tap.Block, readErr error, outputFile string, fixLengths bool) error {
+	dropped := droppedBlock(blocks, readErr)
+	fixed := tap.Repair(blocks, fixLengths)
+	for _, problem := range fixed {
+		fmt.Printf("Fixed %s\n", problem)
+	}
+	if dropped != nil {
+		fmt.Printf("Dropped the last block, as nothing of it remains: %v\n", dropped)
+	}
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer out.Close()
+
+	if err := tap.WriteBlocks(out, blocks); err != nil {
+		return fmt.Errorf("writing TAP file: %w", err)
+	}
+
+	for _, problem := range tap.Verify(blocks) {
+		fmt.Printf("Not fixed %s\n", problem)
+	}
+	fmt.Printf("Wrote %d blocks to %s (%d fixes)\n", len(blocks), outputFile, len(fixed))
+	return nil
+}
+
+// exportArrays writes every numeric and character array in the blocks to
+// a CSV or JSON file named after its header. Arrays saved under the same
+// name get a numbered suffix instead of overwriting each other.
+func exportArrays(blocks []*tap.Block, format string) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown export format %q (use csv or json)", format)
+	}
+
+	exported := 0
+	used := make(map[string]bool)
+	for i := 0; i+1 < len(blocks); i++ {
+		header := blocks[i].Header
+		if header == nil || (header.Type != tap.Data && header.Type != tap.Chars) {
+			continue
+		}
+		if blocks[i+1].Flag == tap.HeaderFlag {
+			fmt.Printf("Skipped block %d: no data block follows the header\n", i+1)
+			continue
+		}
+		data := blocks[i+1].Data
+
+		name := header.Name()
+		if name == "" {
+			name = fmt.Sprintf("array%d", i)
+		}
+		name = filepath.Base(name)
+		filename := name + "." + format
+		for n := 2; used[strings.ToLower(filename)]; n++ {
+			filename = fmt.Sprintf("%s_%d.%s", name, n, format)
+		}
+		used[strings.ToLower(filename)] = true
+
+		var buf bytes.Buffer
+		if header.Type == tap.Data {
+			array := &basic.NumberArray{}
+			if err := array.UnmarshalBinary(data); err != nil {
+				return fmt.Errorf("block %d: %w", i+1, err)
+			}
+			if err := writeArray(&buf, array, format); err != nil {
+				return fmt.Errorf("block %d: %w", i+1, err)
+			}
+		} else {
+			array := &basic.CharArray{}
+			if err := array.UnmarshalBinary(data); err != nil {
+				return fmt.Errorf("block %d: %w", i+1, err)
+			}
+			if err := writeArray(&buf, array, format); err != nil {
+				return fmt.Errorf("block %d: %w", i+1, err)
+			}
+		}
+
+		if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+		fmt.Printf("Exported %c%s() to %s\n", header.ArrayName(), arraySuffix(header.Type), filename)
+		exported++
+	}
+
+	if exported == 0 {
+		fmt.Println("No arrays found")
+	}
+	return nil
+}
+
+// listPrograms prints the source of every BASIC program in the blocks
+func listPrograms(blocks []*tap.Block) error {
+	listed := 0
+	lister := basic.NewLister()
+	for i := 0; i+1 < len(blocks); i++ {
+		header := blocks[i].Header
+		if header == nil || header.Type != tap.Program || blocks[i+1].Flag == tap.HeaderFlag {
+			continue
+		}
+
+		// Param2 is the program length, anything after it is variables
+		data := blocks[i+1].Data
+		if int(header.Param2) < len(data) {
+			data = data[:header.Param2]
+		}
+
+		fmt.Printf("# %s (block %d)\n", header.Name(), i+1)
+		if err := lister.List(os.Stdout, data); err != nil {
+			return fmt.Errorf("block %d: %w", i+1, err)
+		}
+		listed++
+	}
+
+	if listed == 0 {
+		fmt.Println("No BASIC programs found")
+	}
+	return nil
+}
+
+// csvArray is implemented by the basic array types
+type csvArray interface {
+	WriteCSV(w io.Writer) error
+}
+
+// writeArray encodes an array as CSV or indented JSON
+func writeArray(w io.Writer, array csvArray, format string) error {
+	if format == "csv" {
+		return array.WriteCSV(w)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(array)
+}
+
+// arraySuffix returns "$" for character arrays
+func arraySuffix(blockType byte) string {
+	if blockType == tap.Chars {
+		return "$"
+	}
+	return ""
+}
+
 func main() {
 	dump := flag.Bool("d", false, "Dump block data as hex")
 	raw := flag.Bool("r", false, "Output raw block data")
+	verify := flag.Bool("verify", false, "Verify checksums and header lengths")
+	repair := flag.String("repair", "", "Write a repaired copy of the TAP file to `FILE`")
+	fixLengths := flag.Bool("fix-lengths", false, "With -repair, also correct header data lengths")
+	export := flag.String("export", "", "Export DATA arrays as `FORMAT` (csv or json) files named after their headers")
+	list := flag.Bool("list", false, "List BASIC programs as source text")
 	flag.Parse()
 
 	if flag.NArg() != 1 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [-d] [-r] <tap-file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [-d] [-r] [-verify] [-repair out.tap [-fix-lengths]] [-export csv|json] [-list] <tap-file>\n", os.Args[0])
 		os.Exit(1)
 	}
 
 	filename := flag.Arg(0)
 	blocks, err := readTAPFile(filename)
+	var readErr error
+	if errors.Is(err, tap.ErrTruncated) && (*verify || *repair != "") {
+		// Check or repair what there is of the file
+		readErr, err = err, nil
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if *raw {
+	if *list {
+		if err := listPrograms(blocks); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *export != "" {
+		if err := exportArrays(blocks, *export); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *repair != "" {
+		if err := repairTAP(blocks, readErr, *repair, *fixLengths); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *verify {
+		if verifyTAP(blocks, filename, readErr) > 0 {
+			os.Exit(1)
+		}
+	} else if *raw {
 		// Output just the raw data blocks (skip headers)
 		for _, block := range blocks {
-			if block.Flag != headerFlag {
+			if block.Flag != tap.HeaderFlag {
 				os.Stdout.Write(block.Data)
 			}
 		}
@@ -10,24 +10,45 @@ import (
 
 func main() {
 	var (
-		name    = flag.String("name", "", "Name for code block (max 10 chars)")
-		address = flag.Uint("address", 32768, "Start address (default: 32768)")
+		name       = flag.String("name", "", "Comma-separated names for the code blocks, one per input file (max 10 chars each)")
+		address    = flag.String("address", "32768", "Comma-separated start addresses, one per input file")
+		headerless = flag.Bool("headerless", false, "Write data blocks without headers")
+		flagByte   = flag.Uint("flag", tap.DataFlag, "Flag byte for data blocks (default: 255)")
 	)
 
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [--name NAME] [--address ADDR] input.bin output.tap\n", os.Args[0])
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--name NAME,...] [--address ADDR,...] [--flag N] input.bin [input2.bin ...] output.tap\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s --headerless [--flag N] input.bin [input2.bin ...] output.tap\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	inputFile, outputFile := args[0], args[1]
+	if *flagByte > 0xFF {
+		fmt.Fprintf(os.Stderr, "Error: flag must be between 0 and 255\n")
+		os.Exit(1)
+	}
 
-	if err := tap.BinaryToTAP(inputFile, outputFile, *name, uint16(*address)); err != nil {
+	inputFiles, outputFile := args[:len(args)-1], args[len(args)-1]
+
+	files, err := tap.ListBinaryFiles(inputFiles, *name, *address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts := tap.BinaryOptions{
+		Headerless: *headerless,
+		Flag:       byte(*flagByte),
+	}
+	if err := tap.BinariesToTAP(files, outputFile, opts); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Successfully converted %s to %s\n", inputFile, outputFile)
-}
\ No newline at end of file
+	if len(inputFiles) == 1 {
+		fmt.Printf("Successfully converted %s to %s\n", inputFiles[0], outputFile)
+	} else {
+		fmt.Printf("Successfully converted %d files to %s\n", len(inputFiles), outputFile)
+	}
+}
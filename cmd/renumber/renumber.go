@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zxgotools/pkg/basic"
+	"zxgotools/pkg/tap"
+)
+
+// renumbering holds the settings given on the command line
+type renumbering struct {
+	start, step int
+	options     []basic.RenumberOption
+}
+
+// apply renumbers a program and prints any warnings
+func (r *renumbering) apply(program *basic.Program) (*basic.Renumbering, error) {
+	result, err := program.Renumber(r.start, r.step, r.options...)
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(result)
+	return result, nil
+}
+
+// renumberSource renumbers a BASIC text file. Only line numbers and the
+// targets that refer to them change; comments and layout are kept.
+func (r *renumbering) renumberSource(data []byte) ([]byte, error) {
+	out, result, err := basic.RenumberSource(data, r.start, r.step, r.options...)
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(result)
+	return out, nil
+}
+
+// printWarnings prints the warnings from renumbering
+func printWarnings(result *basic.Renumbering) {
+	for _, d := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", d.Message)
+	}
+}
+
+// renumberTAP renumbers every BASIC program in the blocks of a TAP
+// file, updating the headers to match, and returns how many it changed
+func (r *renumbering) renumberTAP(blocks []*tap.Block) (int, error) {
+	count := 0
+	for i := 0; i+1 < len(blocks); i++ {
+		header := blocks[i].Header
+		if header == nil || header.Type != tap.Program || blocks[i+1].Flag == tap.HeaderFlag {
+			continue
+		}
+
+		data := blocks[i+1].Data
+		length := int(header.Param2)
+		if length > len(data) {
+			length = len(data)
+		}
+
+		var program basic.Program
+		if err := program.UnmarshalBinary(data[:length]); err != nil {
+			return count, fmt.Errorf("program %q: %w", header.Name(), err)
+		}
+		fmt.Fprintf(os.Stderr, "Renumbering %q\n", header.Name())
+		result, err := r.apply(&program)
+		if err != nil {
+			return count, fmt.Errorf("program %q: %w", header.Name(), err)
+		}
+
+		tokenized, err := program.MarshalBinary()
+		if err != nil {
+			return count, fmt.Errorf("program %q: %w", header.Name(), err)
+		}
+		updated := *header
+		updated.DataLength = uint16(len(tokenized) + len(data) - length)
+		updated.Param2 = uint16(len(tokenized))
+		if header.Param1 < 0x8000 {
+			updated.Param1 = uint16(result.Target(int(header.Param1)))
+		}
+		blocks[i].SetHeader(&updated)
+
+		blocks[i+1].Data = append(tokenized, data[length:]...)
+		blocks[i+1].UpdateChecksum()
+		count++
+	}
+	return count, nil
+}
+
+func main() {
+	start := flag.Int("start", 10, "First new line `number`")
+	step := flag.Int("step", 10, "Gap between new line numbers")
+	from := flag.Int("from", 0, "Renumber only lines from this `line` on")
+	to := flag.Int("to", 9999, "Renumber only lines up to this `line`")
+	output := flag.String("o", "", "Write the result to `FILE` (a text file goes to standard output by default)")
+	inPlace := flag.Bool("i", false, "Modify the input file in place")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-start N] [-step N] [-from N] [-to N] [-o FILE | -i] <file.bas|file.tap>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	filename := flag.Arg(0)
+	isTAP := strings.EqualFold(filepath.Ext(filename), ".tap")
+	switch {
+	case *inPlace && *output != "":
+		fmt.Fprintln(os.Stderr, "Error: -o and -i can't be used together")
+		os.Exit(1)
+	case *inPlace:
+		*output = filename
+	case *output == "" && isTAP:
+		fmt.Fprintln(os.Stderr, "Error: give -o FILE for the renumbered TAP file, or -i to modify it in place")
+		os.Exit(1)
+	}
+
+	r := &renumbering{
+		start:   *start,
+		step:    *step,
+		options: []basic.RenumberOption{basic.WithLineRange(*from, *to)},
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading file: %v\n", err)
+		os.Exit(1)
+	}
+
+	var result []byte
+	if isTAP {
+		blocks, err := tap.ReadBlocks(bytes.NewReader(data))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		count, err := r.renumberTAP(blocks)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if count == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no BASIC programs found in %s\n", filename)
+			os.Exit(1)
+		}
+		var buf bytes.Buffer
+		if err := tap.WriteBlocks(&buf, blocks); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		result = buf.Bytes()
+	} else {
+		result, err = r.renumberSource(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *output == "" {
+		os.Stdout.Write(result)
+		return
+	}
+	if err := os.WriteFile(*output, result, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing output file: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"zxgotools/pkg/basic"
+	"zxgotools/pkg/tap"
+)
+
+// program is a BASIC program found in a TAP file
+type program struct {
+	name      string
+	autostart uint16
+	data      []byte
+	variables []byte // The variables area saved after the program
+}
+
+// findPrograms returns every Program block in the TAP file. The data is
+// cut at the program length so that the variables area is not listed.
+func findPrograms(blocks []*tap.Block) []program {
+	var programs []program
+	for i := 0; i+1 < len(blocks); i++ {
+		header := blocks[i].Header
+		if header == nil || header.Type != tap.Program || blocks[i+1].Flag == tap.HeaderFlag {
+			continue
+		}
+
+		data, variables := blocks[i+1].Data, []byte(nil)
+		if int(header.Param2) < len(data) {
+			data, variables = data[:header.Param2], data[header.Param2:]
+		}
+		programs = append(programs, program{
+			name:      header.Name(),
+			autostart: header.Param1,
+			data:      data,
+			variables: variables,
+		})
+	}
+	return programs
+}
+
+// listPrograms writes the source of each program, preceded by a comment
+// with its name when there is more than one
+func listPrograms(w io.Writer, programs []program, options ...basic.ListerOption) error {
+	lister := basic.NewLister(options...)
+	for i, prog := range programs {
+		if len(programs) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "# %s\n", prog.name)
+		}
+		if prog.autostart < 0x8000 {
+			fmt.Fprintf(w, "# autostart %d\n", prog.autostart)
+		}
+		if err := lister.List(w, prog.data); err != nil {
+			return fmt.Errorf("listing %q: %w", prog.name, err)
+		}
+	}
+	return nil
+}
+
+// writeVariables decodes the variables saved with a single program and
+// writes them to path as JSON
+func writeVariables(path string, programs []program) error {
+	if len(programs) > 1 {
+		return fmt.Errorf("-vars needs a TAP file with one program, found %d", len(programs))
+	}
+	var vars basic.Variables
+	if err := vars.UnmarshalBinary(programs[0].variables); err != nil {
+		return fmt.Errorf("decoding variables of %q: %w", programs[0].name, err)
+	}
+	data, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding variables: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing variables: %w", err)
+	}
+	return nil
+}
+
+func main() {
+	output := flag.String("o", "", "Write the listing to `FILE` instead of standard output")
+	hidden := flag.Bool("hidden", false, "List fake numbers as digits followed by {=value} (for totap --fake-numbers)")
+	utf8 := flag.Bool("utf8", false, "Write £, © and block graphics as Unicode characters")
+	udgs := flag.String("udgs", "", "Unicode `characters` to write for UDGs A, B, C... with -utf8")
+	vars := flag.String("vars", "", "Write the variables saved with the program to `FILE` as JSON (for totap --vars)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-o out.bas] [-hidden] [-utf8 [-udgs chars]] [-vars vars.json] <tap-file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: opening file: %v\n", err)
+		os.Exit(1)
+	}
+	blocks, err := tap.ReadBlocks(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	programs := findPrograms(blocks)
+	if len(programs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no BASIC programs found in %s\n", flag.Arg(0))
+		os.Exit(1)
+	}
+
+	if *vars != "" {
+		if err := writeVariables(*vars, programs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		out, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+		w = out
+	}
+
+	options := []basic.ListerOption{basic.WithHiddenValues(*hidden)}
+	if *utf8 {
+		options = append(options, basic.WithUnicodeListing(*udgs))
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := listPrograms(bw, programs, options...); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := bw.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing listing: %v\n", err)
+		os.Exit(1)
+	}
+}
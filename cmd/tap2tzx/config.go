@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"zxgotools/pkg/tap"
 )
 
 type blockPosition struct {
@@ -161,8 +163,9 @@ func processConfigBlock(w io.Writer, block blockConfig, positions map[string]int
 		}
 		defer inFile.Close()
 
+		tr := tap.NewReader(inFile)
 		for {
-			data, err := readTapBlock(inFile)
+			tb, err := tr.Next()
 			if err == io.EOF {
 				break
 			}
@@ -170,10 +173,10 @@ func processConfigBlock(w io.Writer, block blockConfig, positions map[string]int
 				return fmt.Errorf("reading TAP block: %w", err)
 			}
 
-			if err := writeStandardSpeedBlock(w, data, 1000); err != nil {
+			if err := writeStandardSpeedBlock(w, tb.Bytes(), 1000); err != nil {
 				return fmt.Errorf("writing TAP block: %w", err)
 			}
-			*currentPos += 5 + int64(len(data))
+			*currentPos += 5 + int64(tb.Length())
 		}
 	}
 
@@ -2,4 +2,9 @@ module tap2tzx
 
 go 1.21.6
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require (
+	gopkg.in/yaml.v3 v3.0.1
+	zxgotools v0.0.0
+)
+
+replace zxgotools => ../..
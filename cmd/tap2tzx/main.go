@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"unsafe"
+
+	"zxgotools/pkg/tap"
 )
 
 func parseFlags() (*options, error) {
@@ -86,8 +88,9 @@ func processInputFile(w io.Writer, filename string, opts *options) error {
 	}
 	defer inFile.Close()
 
+	tr := tap.NewReader(inFile)
 	for {
-		data, err := readTapBlock(inFile)
+		block, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
@@ -95,7 +98,7 @@ func processInputFile(w io.Writer, filename string, opts *options) error {
 			return fmt.Errorf("reading TAP block: %w", err)
 		}
 
-		if err := writeStandardSpeedBlock(w, data, opts.pauseDuration); err != nil {
+		if err := writeStandardSpeedBlock(w, block.Bytes(), opts.pauseDuration); err != nil {
 			return fmt.Errorf("writing TZX block: %w", err)
 		}
 	}
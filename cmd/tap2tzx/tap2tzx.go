@@ -364,26 +364,6 @@ func writeLoopEnd(w io.Writer) error {
 	return binary.Write(w, binary.LittleEndian, uint8(0x25))
 }
 
-// readTapBlock reads a single TAP block from the input file
-func readTapBlock(r io.Reader) ([]byte, error) {
-	// Read block length
-	var length uint16
-	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
-		if err == io.EOF {
-			return nil, err
-		}
-		return nil, fmt.Errorf("reading block length: %w", err)
-	}
-
-	// Read block data
-	data := make([]byte, length)
-	if _, err := io.ReadFull(r, data); err != nil {
-		return nil, fmt.Errorf("reading block data: %w", err)
-	}
-
-	return data, nil
-}
-
 // processConfig reads and processes a YAML configuration file
 func processConfig(filename string) (*tzxConfig, error) {
 	data, err := os.ReadFile(filename)
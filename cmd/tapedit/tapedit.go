@@ -0,0 +1,373 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"zxgotools/pkg/tap"
+)
+
+const usage = `Usage: %s <command> [options] <tap-file> [arguments]
+
+Commands:
+  ls        <tap-file>                       List blocks
+  rm        <tap-file> <block>               Remove a block (and its data block)
+  mv        <tap-file> <block> <position>    Move a block (and its data block)
+  rename    <tap-file> <block> <name>        Change a header's filename
+  set-start <tap-file> <block> <value>       Change a header's start address or autostart line
+  insert    <tap-file> <position> <src.tap> [block...]
+                                             Insert blocks from another TAP file
+  extract   <tap-file> <out.tap> <block>...  Copy blocks (and their data blocks) to a new file
+
+Options:
+  -f        Allow edits that separate a header from its data block
+  -o FILE   Write the result to FILE instead of modifying the TAP file in place
+
+Every block written gets its checksum recomputed.
+`
+
+// editor holds the blocks of the TAP file being edited
+type editor struct {
+	blocks []*tap.Block
+	force  bool
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(1)
+	}
+
+	command := os.Args[1]
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	force := fs.Bool("f", false, "Allow edits that separate a header from its data block")
+	output := fs.String("o", "", "Write the result to `FILE` instead of modifying the TAP file in place")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+	}
+	fs.Parse(os.Args[2:])
+
+	args := fs.Args()
+	if len(args) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	filename := args[0]
+	blocks, err := readTAPFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	e := &editor{blocks: blocks, force: *force}
+	modified := true
+
+	switch command {
+	case "ls":
+		e.list()
+		modified = false
+	case "rm":
+		err = e.remove(args[1:])
+	case "mv":
+		err = e.move(args[1:])
+	case "rename":
+		err = e.rename(args[1:])
+	case "set-start":
+		err = e.setStart(args[1:])
+	case "insert":
+		err = e.insert(args[1:])
+	case "extract":
+		err = e.extract(args[1:])
+		modified = false
+	default:
+		err = fmt.Errorf("unknown command %q", command)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if modified {
+		if *output == "" {
+			*output = filename
+		}
+		if err := writeTAPFile(*output, e.blocks); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// readTAPFile reads all blocks from a TAP file
+func readTAPFile(filename string) ([]*tap.Block, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	return tap.ReadBlocks(file)
+}
+
+// writeTAPFile writes blocks to a TAP file, recomputing every checksum
+func writeTAPFile(filename string, blocks []*tap.Block) error {
+	for _, block := range blocks {
+		block.UpdateChecksum()
+	}
+
+	out, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer out.Close()
+
+	if err := tap.WriteBlocks(out, blocks); err != nil {
+		return fmt.Errorf("writing TAP file: %w", err)
+	}
+	return nil
+}
+
+// list prints a one line summary of every block
+func (e *editor) list() {
+	for i, block := range e.blocks {
+		status := ""
+		if !block.Valid() {
+			status = " (BAD CHECKSUM)"
+		}
+
+		if block.Header == nil {
+			fmt.Printf("%3d  data     flag 0x%02X  %5d bytes%s\n", i, block.Flag, len(block.Data), status)
+			continue
+		}
+
+		h := block.Header
+		fmt.Printf("%3d  %-7s  %-10q  %5d bytes  param1 %5d  param2 %5d%s\n",
+			i, typeString(h.Type), h.Name(), h.DataLength, h.Param1, h.Param2, status)
+	}
+}
+
+// remove deletes a block, together with its data block if it is a header
+func (e *editor) remove(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("rm requires a block number")
+	}
+	start, end, err := e.entry(args[0])
+	if err != nil {
+		return err
+	}
+
+	e.blocks = append(e.blocks[:start], e.blocks[end:]...)
+	fmt.Printf("Removed %d block(s)\n", end-start)
+	return nil
+}
+
+// move moves a block, together with its data block if it is a header,
+// so that it starts at the given position of the original file
+func (e *editor) move(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("mv requires a block number and a position")
+	}
+	start, end, err := e.entry(args[0])
+	if err != nil {
+		return err
+	}
+	pos, err := e.position(args[1])
+	if err != nil {
+		return err
+	}
+	if pos > start && pos < end {
+		return fmt.Errorf("cannot move block %d inside itself", start)
+	}
+
+	moved := append([]*tap.Block(nil), e.blocks[start:end]...)
+	rest := append(append([]*tap.Block(nil), e.blocks[:start]...), e.blocks[end:]...)
+	if pos >= end {
+		pos -= end - start
+	}
+	e.blocks = splice(rest, pos, moved)
+	fmt.Printf("Moved %d block(s) to position %d\n", len(moved), pos)
+	return nil
+}
+
+// rename sets the filename of a header block
+func (e *editor) rename(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("rename requires a block number and a name")
+	}
+	header, err := e.header(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args[1]) > 10 {
+		return fmt.Errorf("name %q is longer than 10 characters", args[1])
+	}
+
+	h := *header.Header
+	h.SetName(args[1])
+	header.SetHeader(&h)
+	fmt.Printf("Renamed block to %q\n", h.Name())
+	return nil
+}
+
+// setStart sets Param1 of a header block: the start address for CODE
+// blocks or the autostart line for programs
+func (e *editor) setStart(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("set-start requires a block number and a value")
+	}
+	header, err := e.header(args[0])
+	if err != nil {
+		return err
+	}
+	value, err := strconv.ParseUint(args[1], 0, 16)
+	if err != nil {
+		return fmt.Errorf("invalid value %q: %w", args[1], err)
+	}
+
+	h := *header.Header
+	h.Param1 = uint16(value)
+	header.SetHeader(&h)
+	fmt.Printf("Set param1 of %q to %d\n", h.Name(), h.Param1)
+	return nil
+}
+
+// insert copies blocks from another TAP file into the given position.
+// Without block numbers the whole source file is inserted.
+func (e *editor) insert(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("insert requires a position and a source TAP file")
+	}
+	pos, err := e.position(args[0])
+	if err != nil {
+		return err
+	}
+	source, err := readTAPFile(args[1])
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", args[1], err)
+	}
+
+	src := &editor{blocks: source, force: e.force}
+	selected := source
+	if len(args) > 2 {
+		if selected, err = src.selection(args[2:]); err != nil {
+			return fmt.Errorf("%s: %w", args[1], err)
+		}
+	}
+
+	e.blocks = splice(e.blocks, pos, selected)
+	fmt.Printf("Inserted %d block(s) at position %d\n", len(selected), pos)
+	return nil
+}
+
+// extract writes the selected blocks to a new TAP file
+func (e *editor) extract(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("extract requires an output file and at least one block number")
+	}
+	selected, err := e.selection(args[1:])
+	if err != nil {
+		return err
+	}
+	if err := writeTAPFile(args[0], selected); err != nil {
+		return err
+	}
+	fmt.Printf("Extracted %d block(s) to %s\n", len(selected), args[0])
+	return nil
+}
+
+// selection returns the blocks of the given entries, in order
+func (e *editor) selection(args []string) ([]*tap.Block, error) {
+	var selected []*tap.Block
+	for _, arg := range args {
+		start, end, err := e.entry(arg)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, e.blocks[start:end]...)
+	}
+	return selected, nil
+}
+
+// entry returns the block range for a block number: a header together
+// with its data block, or a single block. Selecting a data block that
+// belongs to a header requires force.
+func (e *editor) entry(arg string) (int, int, error) {
+	index, err := e.index(arg)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if e.isPaired(index) {
+		return index, index + 2, nil
+	}
+	if index > 0 && e.isPaired(index-1) && !e.force {
+		return 0, 0, fmt.Errorf("block %d is the data block of header %d (use -f to separate them)", index, index-1)
+	}
+	return index, index + 1, nil
+}
+
+// header returns the header block with the given number
+func (e *editor) header(arg string) (*tap.Block, error) {
+	index, err := e.index(arg)
+	if err != nil {
+		return nil, err
+	}
+	if e.blocks[index].Header == nil {
+		return nil, fmt.Errorf("block %d is not a header", index)
+	}
+	return e.blocks[index], nil
+}
+
+// index parses a block number
+func (e *editor) index(arg string) (int, error) {
+	index, err := strconv.Atoi(arg)
+	if err != nil || index < 0 || index >= len(e.blocks) {
+		return 0, fmt.Errorf("invalid block number %q (file has %d blocks)", arg, len(e.blocks))
+	}
+	return index, nil
+}
+
+// position parses an insertion position, which may be one past the last
+// block. A position between a header and its data requires force.
+func (e *editor) position(arg string) (int, error) {
+	pos, err := strconv.Atoi(arg)
+	if err != nil || pos < 0 || pos > len(e.blocks) {
+		return 0, fmt.Errorf("invalid position %q (must be between 0 and %d)", arg, len(e.blocks))
+	}
+	if pos > 0 && e.isPaired(pos-1) && !e.force {
+		return 0, fmt.Errorf("position %d is between header %d and its data block (use -f to separate them)", pos, pos-1)
+	}
+	return pos, nil
+}
+
+// isPaired reports whether block i is a header followed by a data block
+func (e *editor) isPaired(i int) bool {
+	return e.blocks[i].Header != nil && i+1 < len(e.blocks) && e.blocks[i+1].Flag != tap.HeaderFlag
+}
+
+// splice returns blocks with items inserted at pos
+func splice(blocks []*tap.Block, pos int, items []*tap.Block) []*tap.Block {
+	out := make([]*tap.Block, 0, len(blocks)+len(items))
+	out = append(out, blocks[:pos]...)
+	out = append(out, items...)
+	return append(out, blocks[pos:]...)
+}
+
+// typeString returns the BASIC name of a header type
+func typeString(blockType byte) string {
+	switch blockType {
+	case tap.Program:
+		return "Program"
+	case tap.Data:
+		return "Numbers"
+	case tap.Chars:
+		return "Chars"
+	case tap.Bytes:
+		return "Bytes"
+	}
+	return fmt.Sprintf("Type %d", blockType)
+}
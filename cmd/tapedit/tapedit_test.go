@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zxgotools/pkg/tap"
+)
+
+func TestEditsFixChecksums(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.tap")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := tap.NewWriter(file)
+	if err := w.WriteBytes("code", []byte{1, 2, 3}, 32768); err != nil {
+		t.Fatalf("WriteBytes() error = %v", err)
+	}
+	if err := w.WriteHeaderless([]byte{4, 5, 6}); err != nil {
+		t.Fatalf("WriteHeaderless() error = %v", err)
+	}
+	file.Close()
+
+	blocks, err := readTAPFile(filename)
+	if err != nil {
+		t.Fatalf("readTAPFile() error = %v", err)
+	}
+	blocks[2].Checksum ^= 0xFF
+	file, err = os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tap.WriteBlocks(file, blocks); err != nil {
+		t.Fatalf("WriteBlocks() error = %v", err)
+	}
+	file.Close()
+
+	// Read the bad checksum back, then move the block
+	blocks, err = readTAPFile(filename)
+	if err != nil {
+		t.Fatalf("readTAPFile() error = %v", err)
+	}
+	if blocks[2].Valid() {
+		t.Fatal("checksum was fixed before the edit")
+	}
+	e := &editor{blocks: blocks}
+	if err := e.move([]string{"2", "0"}); err != nil {
+		t.Fatalf("move() error = %v", err)
+	}
+	if err := writeTAPFile(filename, e.blocks); err != nil {
+		t.Fatalf("writeTAPFile() error = %v", err)
+	}
+
+	blocks, err = readTAPFile(filename)
+	if err != nil {
+		t.Fatalf("readTAPFile() error = %v", err)
+	}
+	if len(blocks) != 3 || blocks[0].Flag != tap.DataFlag || blocks[1].Header == nil {
+		t.Fatalf("blocks are not in the moved order")
+	}
+	for i, block := range blocks {
+		if !block.Valid() {
+			t.Errorf("block %d checksum 0x%02X, computed 0x%02X", i, block.Checksum, block.Computed)
+		}
+	}
+}
+
+// writeTestFile writes two CODE files and a headerless block, which
+// layout lists as "one@32768 1 two@40000 2 3". With a prefix the files
+// are named after it and hold 7, 8 and 9 instead.
+func writeTestFile(t *testing.T, filename, prefix string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tap.NewWriter(&buf)
+	first, second := "one", "two"
+	var base byte = 1
+	if prefix != "" {
+		first, second, base = prefix, prefix+"2", 7
+	}
+	if err := w.WriteBytes(first, []byte{base}, 32768); err != nil {
+		t.Fatalf("WriteBytes() error = %v", err)
+	}
+	if err := w.WriteBytes(second, []byte{base + 1}, 40000); err != nil {
+		t.Fatalf("WriteBytes() error = %v", err)
+	}
+	if err := w.WriteHeaderless([]byte{base + 2}); err != nil {
+		t.Fatalf("WriteHeaderless() error = %v", err)
+	}
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// layout describes blocks as name@param1 for headers and the first data
+// byte for other blocks
+func layout(blocks []*tap.Block) string {
+	var parts []string
+	for _, block := range blocks {
+		if block.Header != nil {
+			parts = append(parts, fmt.Sprintf("%s@%d", block.Header.Name(), block.Header.Param1))
+		} else {
+			parts = append(parts, fmt.Sprint(block.Data[0]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestEditor(t *testing.T) {
+	commands := map[string]func(*editor, []string) error{
+		"rm":        (*editor).remove,
+		"mv":        (*editor).move,
+		"rename":    (*editor).rename,
+		"set-start": (*editor).setStart,
+		"insert":    (*editor).insert,
+		"extract":   (*editor).extract,
+	}
+
+	// SRC and OUT in args stand for the source file of insert and the
+	// output file of extract. For extract, want is the extracted file.
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		force   bool
+		want    string
+		wantErr string
+	}{
+		{name: "rm header and data", command: "rm", args: []string{"0"}, want: "two@40000 2 3"},
+		{name: "rm headerless block", command: "rm", args: []string{"4"}, want: "one@32768 1 two@40000 2"},
+		{name: "rm data block", command: "rm", args: []string{"1"}, wantErr: "block 1 is the data block of header 0"},
+		{name: "rm data block with -f", command: "rm", args: []string{"1"}, force: true, want: "one@32768 two@40000 2 3"},
+		{name: "rm past the end", command: "rm", args: []string{"5"}, wantErr: "invalid block number \"5\""},
+		{name: "rm negative block", command: "rm", args: []string{"-1"}, wantErr: "invalid block number \"-1\""},
+		{name: "rm without block", command: "rm", wantErr: "rm requires a block number"},
+
+		{name: "mv pair to end", command: "mv", args: []string{"0", "5"}, want: "two@40000 2 3 one@32768 1"},
+		{name: "mv block to start", command: "mv", args: []string{"4", "0"}, want: "3 one@32768 1 two@40000 2"},
+		{name: "mv into pair", command: "mv", args: []string{"4", "1"}, wantErr: "position 1 is between header 0 and its data block"},
+		{name: "mv into pair with -f", command: "mv", args: []string{"4", "1"}, force: true, want: "one@32768 3 1 two@40000 2"},
+		{name: "mv data block", command: "mv", args: []string{"3", "0"}, wantErr: "block 3 is the data block of header 2"},
+		{name: "mv inside itself", command: "mv", args: []string{"0", "1"}, force: true, wantErr: "cannot move block 0 inside itself"},
+		{name: "mv past the end", command: "mv", args: []string{"0", "6"}, wantErr: "invalid position \"6\""},
+		{name: "mv bad position", command: "mv", args: []string{"0", "x"}, wantErr: "invalid position \"x\""},
+
+		{name: "rename", command: "rename", args: []string{"2", "three"}, want: "one@32768 1 three@40000 2 3"},
+		{name: "rename ten characters", command: "rename", args: []string{"0", "abcdefghij"}, want: "abcdefghij@32768 1 two@40000 2 3"},
+		{name: "rename long name", command: "rename", args: []string{"0", "abcdefghijk"}, wantErr: "name \"abcdefghijk\" is longer than 10 characters"},
+		{name: "rename data block", command: "rename", args: []string{"1", "x"}, force: true, wantErr: "block 1 is not a header"},
+		{name: "rename bad block", command: "rename", args: []string{"x", "y"}, wantErr: "invalid block number \"x\""},
+
+		{name: "set-start", command: "set-start", args: []string{"2", "30000"}, want: "one@32768 1 two@30000 2 3"},
+		{name: "set-start hex", command: "set-start", args: []string{"0", "0x9000"}, want: "one@36864 1 two@40000 2 3"},
+		{name: "set-start too large", command: "set-start", args: []string{"0", "65536"}, wantErr: "invalid value \"65536\""},
+		{name: "set-start data block", command: "set-start", args: []string{"4", "0"}, wantErr: "block 4 is not a header"},
+
+		{name: "insert whole file", command: "insert", args: []string{"5", "SRC"}, want: "one@32768 1 two@40000 2 3 src@32768 7 src2@40000 8 9"},
+		{name: "insert selected blocks", command: "insert", args: []string{"2", "SRC", "4", "0"}, want: "one@32768 1 9 src@32768 7 two@40000 2 3"},
+		{name: "insert into pair", command: "insert", args: []string{"1", "SRC"}, wantErr: "position 1 is between header 0 and its data block"},
+		{name: "insert into pair with -f", command: "insert", args: []string{"1", "SRC", "4"}, force: true, want: "one@32768 9 1 two@40000 2 3"},
+		{name: "insert data block", command: "insert", args: []string{"0", "SRC", "1"}, wantErr: "block 1 is the data block of header 0"},
+		{name: "insert data block with -f", command: "insert", args: []string{"0", "SRC", "1"}, force: true, want: "7 one@32768 1 two@40000 2 3"},
+		{name: "insert bad source block", command: "insert", args: []string{"0", "SRC", "5"}, wantErr: "invalid block number \"5\""},
+
+		{name: "extract pair", command: "extract", args: []string{"OUT", "2"}, want: "two@40000 2"},
+		{name: "extract in order given", command: "extract", args: []string{"OUT", "4", "0"}, want: "3 one@32768 1"},
+		{name: "extract data block", command: "extract", args: []string{"OUT", "3"}, wantErr: "block 3 is the data block of header 2"},
+		{name: "extract data block with -f", command: "extract", args: []string{"OUT", "3"}, force: true, want: "2"},
+		{name: "extract bad block", command: "extract", args: []string{"OUT", "x"}, wantErr: "invalid block number \"x\""},
+		{name: "extract without blocks", command: "extract", args: []string{"OUT"}, wantErr: "extract requires an output file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "test.tap")
+			source := filepath.Join(dir, "source.tap")
+			output := filepath.Join(dir, "out.tap")
+			writeTestFile(t, filename, "")
+			writeTestFile(t, source, "src")
+
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = strings.NewReplacer("SRC", source, "OUT", output).Replace(arg)
+			}
+
+			blocks, err := readTAPFile(filename)
+			if err != nil {
+				t.Fatalf("readTAPFile() error = %v", err)
+			}
+			e := &editor{blocks: blocks, force: tt.force}
+			err = commands[tt.command](e, args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("%s error = %v, want %q", tt.command, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s error = %v", tt.command, err)
+			}
+
+			got := e.blocks
+			if tt.command == "extract" {
+				if got, err = readTAPFile(output); err != nil {
+					t.Fatalf("readTAPFile() error = %v", err)
+				}
+			}
+			if layout(got) != tt.want {
+				t.Errorf("%s blocks = %q, want %q", tt.command, layout(got), tt.want)
+			}
+		})
+	}
+}
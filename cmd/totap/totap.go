@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"zxgotools/pkg/basic"
@@ -15,47 +18,154 @@ func main() {
 	var (
 		basicMode = flag.Bool("basic", false, "Convert BASIC text file")
 		binMode = flag.Bool("binary", false, "Convert binary file")
-		name = flag.String("name", "", "Name for TAP block (max 10 chars)")
-		address = flag.Uint("address", 32768, "Start address for binary files (default: 32768)")
+		name = flag.String("name", "", "Name for TAP block (max 10 chars); comma-separated, one per input file, for binary files")
+		address = flag.String("address", "32768", "Comma-separated start addresses for binary files, one per input file")
 		autostart = flag.Uint("autostart", 0, "Auto-start line for BASIC programs")
 		caseIndependent = flag.Bool("c", false, "Case independent token matching")
+		numArrayMode = flag.Bool("numarray", false, "Convert CSV/JSON file to a numeric array (DATA a())")
+		charArrayMode = flag.Bool("chararray", false, "Convert CSV/JSON file to a character array (DATA a$())")
+		variable = flag.String("var", "a", "Array variable letter for --numarray and --chararray")
+		headerless = flag.Bool("headerless", false, "Write binary data blocks without headers")
+		flagByte = flag.Uint("flag", tap.DataFlag, "Flag byte for binary data blocks (default: 255)")
+		noSyntaxCheck = flag.Bool("no-syntax-check", false, "Tokenize BASIC without checking statement syntax")
+		fakeNumbers = flag.Bool("fake-numbers", false, "Allow {=value} after a number to store a different value than the one listed")
+		labels = flag.Bool("labels", false, "Read BASIC without line numbers, using @label: to name lines")
+		labelStart = flag.Uint("label-start", 10, "First line number in --labels mode")
+		labelStep = flag.Uint("label-step", 10, "Gap between line numbers in --labels mode")
+		dialect = flag.String("dialect", "standard", "BASIC source `dialect`: standard or zmakebas")
+		utf8 = flag.Bool("utf8", false, "Read £, © and block graphics in BASIC as Unicode characters")
+		udgs = flag.String("udgs", "", "Unicode `characters` to read as UDGs A, B, C... with --utf8")
+		structured = flag.Bool("structured", false, "Allow WHILE/WEND, REPEAT/UNTIL, block IF and DEF PROC (implies --labels)")
+		optimize = flag.Bool("optimize", false, "Make the BASIC program smaller")
+		transforms = flag.String("transforms", "rems,spaces,numbers,merge", "Comma-separated `transforms` for --optimize")
+		zeroLines = flag.String("zero-lines", "", "Comma-separated BASIC `lines` to renumber to 0 so they can't be edited")
+		invisible = flag.Int("invisible", -1, "Hide the BASIC listing with INK and PAPER codes of this `colour` (0-7)")
+		fakeDigits = flag.String("fake-digits", "", "Show these `digits` in place of every number in the BASIC listing")
+		vars = flag.String("vars", "", "Save the variables in this JSON `file` with the BASIC program")
+		defines = defineFlags{}
 	)
+	flag.Var(defines, "D", "Define `NAME[=value]` for the BASIC preprocessor (may be repeated)")
 
 	flag.Parse()
 
-	if !*basicMode && !*binMode {
-		fmt.Fprintf(os.Stderr, "Error: Must specify either --basic or --binary mode\n")
+	modes := 0
+	for _, mode := range []bool{*basicMode, *binMode, *numArrayMode, *charArrayMode} {
+		if mode {
+			modes++
+		}
+	}
+
+	if modes == 0 {
+		fmt.Fprintf(os.Stderr, "Error: Must specify one of --basic, --binary, --numarray or --chararray mode\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if *basicMode && *binMode {
-		fmt.Fprintf(os.Stderr, "Error: Cannot specify both --basic and --binary\n")
+	if modes > 1 {
+		fmt.Fprintf(os.Stderr, "Error: Cannot specify more than one mode\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	args := flag.Args()
-	if len(args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [--basic|--binary] [options] input output.tap\n", os.Args[0])
+	if len(args) < 2 || (len(args) > 2 && !*binMode) {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--basic|--binary|--numarray|--chararray] [options] input output.tap\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s --binary [--name NAME,...] [--address ADDR,...] [--headerless] [--flag N] input.bin [input2.bin ...] output.tap\n", os.Args[0])
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	inputFile, outputFile := args[0], args[1]
+	if *flagByte > 0xFF {
+		fmt.Fprintf(os.Stderr, "Error: --flag must be between 0 and 255\n")
+		os.Exit(1)
+	}
+
+	inputFile, outputFile := args[0], args[len(args)-1]
 
 	if *basicMode {
 		opts := []basic.Option{}
 		if *caseIndependent {
 			opts = append(opts, basic.WithCaseIndependent(true))
 		}
+		if *fakeNumbers {
+			opts = append(opts, basic.WithFakeNumbers(true))
+		}
+		if *noSyntaxCheck {
+			opts = append(opts, basic.WithSyntaxCheck(false))
+		}
+		d, err := basic.ParseDialect(*dialect)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, basic.WithDialect(d))
+		if *labels {
+			step := int(*labelStep)
+			if d == basic.Zmakebas && !flagSet("label-step") {
+				step = 2 // zmakebas numbers lines in steps of 2
+			}
+			opts = append(opts, basic.WithLabels(int(*labelStart), step))
+		}
+		if *utf8 {
+			opts = append(opts, basic.WithUnicode(*udgs))
+		}
+		if *structured {
+			opts = append(opts, basic.WithStructured(true))
+		}
+		if len(defines) > 0 {
+			opts = append(opts, basic.WithDefines(defines))
+		}
 		
-		if err := convertBasic(inputFile, outputFile, *name, uint16(*autostart), opts...); err != nil {
+		var optimizations []string
+		if *optimize {
+			optimizations = strings.Split(*transforms, ",")
+		}
+
+		var protection []basic.ProtectOption
+		if *zeroLines != "" {
+			for _, field := range strings.Split(*zeroLines, ",") {
+				line, err := strconv.Atoi(strings.TrimSpace(field))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: --zero-lines must be line numbers separated by commas\n")
+					os.Exit(1)
+				}
+				protection = append(protection, basic.WithZeroLines(line))
+			}
+		}
+		if *invisible >= 0 {
+			protection = append(protection, basic.WithInvisibleListing(*invisible))
+		}
+		if *fakeDigits != "" {
+			protection = append(protection, basic.WithFakeDigits(*fakeDigits))
+		}
+		if len(protection) > 0 && *autostart > 0 {
+			protection = append(protection, basic.WithStartLine(int(*autostart)))
+		}
+
+		if err := convertBasic(inputFile, outputFile, *name, uint16(*autostart), *vars, optimizations, protection, opts...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *numArrayMode || *charArrayMode {
+		if len(*variable) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: --var must be a single letter\n")
+			os.Exit(1)
+		}
+		if err := convertArray(inputFile, outputFile, *name, (*variable)[0], *charArrayMode); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 	} else {
-		if err := convertBinary(inputFile, outputFile, *name, uint16(*address)); err != nil {
+		files, err := tap.ListBinaryFiles(args[:len(args)-1], *name, *address)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts := tap.BinaryOptions{
+			Headerless: *headerless,
+			Flag:       byte(*flagByte),
+		}
+		if err := convertBinary(files, outputFile, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -64,11 +174,121 @@ func main() {
 	fmt.Printf("Successfully created %s\n", outputFile)
 }
 
-func convertBinary(inputFile, outputFile, name string, startAddress uint16) error {
-	return tap.BinaryToTAP(inputFile, outputFile, name, startAddress)
+func convertBinary(files []tap.BinaryFile, outputFile string, opts tap.BinaryOptions) error {
+	return tap.BinariesToTAP(files, outputFile, opts)
+}
+
+func convertArray(inputFile, outputFile, name string, variable byte, chars bool) error {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("opening input file: %w", err)
+	}
+	defer input.Close()
+
+	isJSON := strings.EqualFold(filepath.Ext(inputFile), ".json")
+
+	// Decode the array into the ROM format
+	var data []byte
+	if chars {
+		array := &basic.CharArray{}
+		if isJSON {
+			err = json.NewDecoder(input).Decode(array)
+		} else {
+			array, err = basic.ReadCharArrayCSV(input)
+		}
+		if err != nil {
+			return fmt.Errorf("reading array: %w", err)
+		}
+		data, err = array.MarshalBinary()
+	} else {
+		array := &basic.NumberArray{}
+		if isJSON {
+			err = json.NewDecoder(input).Decode(array)
+		} else {
+			array, err = basic.ReadNumberArrayCSV(input)
+		}
+		if err != nil {
+			return fmt.Errorf("reading array: %w", err)
+		}
+		data, err = array.MarshalBinary()
+	}
+	if err != nil {
+		return fmt.Errorf("encoding array: %w", err)
+	}
+
+	// Use filename if no name provided
+	if name == "" {
+		name = filepath.Base(inputFile)
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+		if len(name) > 10 {
+			name = name[:10]
+		}
+	}
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer out.Close()
+
+	w := tap.NewWriter(out)
+	if chars {
+		err = w.WriteCharArray(name, variable, data)
+	} else {
+		err = w.WriteNumberArray(name, variable, data)
+	}
+	if err != nil {
+		return fmt.Errorf("writing TAP file: %w", err)
+	}
+
+	return nil
+}
+
+// defineFlags collects -D NAME[=value] options. A name given without a
+// value is defined as 1.
+type defineFlags map[string]string
+
+func (d defineFlags) String() string {
+	return ""
+}
+
+func (d defineFlags) Set(s string) error {
+	name, value, found := strings.Cut(s, "=")
+	if name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if !found {
+		value = "1"
+	}
+	d[name] = value
+	return nil
+}
+
+// flagSet reports whether a flag was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func convertBasic(inputFile, outputFile, name string, autostart uint16, opts ...basic.Option) error {
+// printDiagnostic writes a parser diagnostic to stderr in the
+// file:line:column form that editors and CI tools recognise
+func printDiagnostic(filename string, d basic.Diagnostic) {
+	if d.File != "" {
+		filename = d.File
+	}
+	pos := fmt.Sprintf("%s:%d", filename, d.Line)
+	if d.Column > 0 {
+		pos += fmt.Sprintf(":%d", d.Column)
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s: %s [%s]\n", pos, d.Severity, d.Message, d.Code)
+}
+
+func convertBasic(inputFile, outputFile, name string, autostart uint16, varsFile string, transforms []string, protection []basic.ProtectOption, opts ...basic.Option) error {
 	// Read and parse BASIC
 	input, err := os.Open(inputFile)
 	if err != nil {
@@ -76,8 +296,54 @@ func convertBasic(inputFile, outputFile, name string, autostart uint16, opts ...
 	}
 	defer input.Close()
 
+	opts = append(opts, basic.WithIncludeDir(filepath.Dir(inputFile)))
+	opts = append(opts, basic.WithWarningSink(func(d basic.Diagnostic) {
+		printDiagnostic(inputFile, d)
+	}))
 	parser := basic.NewParser(opts...)
-	data, err := parser.Parse(input)
+	program, err := parser.ParseProgram(input)
+	if err != nil {
+		var diags basic.Diagnostics
+		if errors.As(err, &diags) {
+			for _, d := range diags {
+				printDiagnostic(inputFile, d)
+			}
+			return fmt.Errorf("parsing BASIC: %d error(s) in %s", len(diags), inputFile)
+		}
+		return fmt.Errorf("parsing BASIC: %w", err)
+	}
+	if transforms != nil {
+		if err := optimizeBasic(program, inputFile, autostart, transforms); err != nil {
+			return err
+		}
+	}
+
+	// Find where machine code in REM lines will be, before line numbers
+	// are changed by protection. Its address doesn't change.
+	var notes []string
+	for _, code := range parser.EmbeddedCode() {
+		address, err := program.Address(code.Line, code.Offset)
+		if err != nil {
+			return err
+		}
+		notes = append(notes, fmt.Sprintf("Note: %s (%d bytes) is in line %d at address %d", code.File, code.Length, code.Line, address))
+	}
+
+	if len(protection) > 0 {
+		result, err := program.Protect(protection...)
+		if err != nil {
+			return fmt.Errorf("protecting BASIC: %w", err)
+		}
+		for _, d := range result.Warnings {
+			printDiagnostic(inputFile, d)
+		}
+	}
+	if varsFile != "" {
+		if program.Variables, err = readVariables(varsFile); err != nil {
+			return err
+		}
+	}
+	data, err := program.MarshalBinary()
 	if err != nil {
 		return fmt.Errorf("parsing BASIC: %w", err)
 	}
@@ -99,14 +365,58 @@ func convertBasic(inputFile, outputFile, name string, autostart uint16, opts ...
 	}
 
 	// Write as TAP
-	if err := tap.WriteBasicToTAP(out, name, data, autostart); err != nil {
+	if err := tap.NewWriter(out).WriteProgramWithVariables(name, data, autostart, uint16(program.VarsOffset())); err != nil {
 		return fmt.Errorf("writing TAP file: %w", err)
 	}
 
+	// Report where machine code in REM lines will be
+	for _, note := range notes {
+		fmt.Println(note)
+	}
+
 	// Report 128K requirement if detected
 	if parser.Is128K() {
 		fmt.Println("Note: Program requires 128K")
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// readVariables reads variables from a JSON file and returns them in the
+// form saved after a program
+func readVariables(path string) ([]byte, error) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading variables: %w", err)
+	}
+	var vars basic.Variables
+	if err := json.Unmarshal(input, &vars); err != nil {
+		return nil, fmt.Errorf("reading variables from %s: %w", path, err)
+	}
+	data, err := vars.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("encoding variables: %w", err)
+	}
+	return data, nil
+}
+
+// optimizeBasic makes the program smaller and prints the bytes each
+// transform saved
+func optimizeBasic(program *basic.Program, inputFile string, autostart uint16, transforms []string) error {
+	options := []basic.OptimizeOption{basic.WithTransforms(transforms...)}
+	if autostart > 0 {
+		options = append(options, basic.WithJumpTargets(int(autostart)))
+	}
+	result, err := program.Optimize(options...)
+	if err != nil {
+		return fmt.Errorf("optimizing BASIC: %w", err)
+	}
+	for _, d := range result.Warnings {
+		printDiagnostic(inputFile, d)
+	}
+	for _, s := range result.Savings {
+		fmt.Printf("Optimized %s: %d bytes saved\n", s.Transform, s.Bytes)
+	}
+	fmt.Printf("Optimized: %d bytes saved in total\n", result.Total())
+	return nil
+}
@@ -32,5 +32,35 @@ GOOS=linux   GOARCH=arm64 go build -x -o ../../bin/totap.rpi64        totap.go
 GOOS=darwin  GOARCH=arm64 go build -x -o ../../bin/totap.mac          totap.go
 popd
 
+pushd cmd/tapedit
+GOOS=windows GOARCH=amd64 go build -x -o ../../bin/tapedit.exe          tapedit.go
+GOOS=windows GOARCH=386   go build -x -o ../../bin/tapedit.win32.exe    tapedit.go
+GOOS=linux   GOARCH=amd64 go build -x -o ../../bin/tapedit.linux        tapedit.go
+GOOS=linux   GOARCH=386   go build -x -o ../../bin/tapedit.linux32      tapedit.go
+GOOS=linux   GOARCH=arm   go build -x -o ../../bin/tapedit.rpi          tapedit.go
+GOOS=linux   GOARCH=arm64 go build -x -o ../../bin/tapedit.rpi64        tapedit.go
+GOOS=darwin  GOARCH=arm64 go build -x -o ../../bin/tapedit.mac          tapedit.go
+popd
+
+pushd cmd/tap2bas
+GOOS=windows GOARCH=amd64 go build -x -o ../../bin/tap2bas.exe          tap2bas.go
+GOOS=windows GOARCH=386   go build -x -o ../../bin/tap2bas.win32.exe    tap2bas.go
+GOOS=linux   GOARCH=amd64 go build -x -o ../../bin/tap2bas.linux        tap2bas.go
+GOOS=linux   GOARCH=386   go build -x -o ../../bin/tap2bas.linux32      tap2bas.go
+GOOS=linux   GOARCH=arm   go build -x -o ../../bin/tap2bas.rpi          tap2bas.go
+GOOS=linux   GOARCH=arm64 go build -x -o ../../bin/tap2bas.rpi64        tap2bas.go
+GOOS=darwin  GOARCH=arm64 go build -x -o ../../bin/tap2bas.mac          tap2bas.go
+popd
+
+pushd cmd/renumber
+GOOS=windows GOARCH=amd64 go build -x -o ../../bin/renumber.exe          renumber.go
+GOOS=windows GOARCH=386   go build -x -o ../../bin/renumber.win32.exe    renumber.go
+GOOS=linux   GOARCH=amd64 go build -x -o ../../bin/renumber.linux        renumber.go
+GOOS=linux   GOARCH=386   go build -x -o ../../bin/renumber.linux32      renumber.go
+GOOS=linux   GOARCH=arm   go build -x -o ../../bin/renumber.rpi          renumber.go
+GOOS=linux   GOARCH=arm64 go build -x -o ../../bin/renumber.rpi64        renumber.go
+GOOS=darwin  GOARCH=arm64 go build -x -o ../../bin/renumber.mac          renumber.go
+popd
+
 (pushd cmd/tap2tzx && ./mk.sh)
 popd
\ No newline at end of file
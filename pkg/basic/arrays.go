@@ -0,0 +1,448 @@
+package basic
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Array limits imposed by the ROM's DIM format
+const (
+	MaxArrayDims = 255
+	MaxArrayDim  = 65535
+)
+
+// NumberArray is a numeric array as created by DIM a(...)
+type NumberArray struct {
+	Dims   []int     // Size of each dimension
+	Values []float64 // Elements in row-major order, as the ROM stores them
+}
+
+// CharArray is a character array as created by DIM a$(...)
+type CharArray struct {
+	Dims []int  // Size of each dimension, the last one is the string length
+	Data []byte // Characters in row-major order
+}
+
+// MarshalBinary encodes the array in the ROM format used by SAVE ... DATA:
+// number of dimensions, each dimension as 2 bytes, then 5 bytes per element
+func (a *NumberArray) MarshalBinary() ([]byte, error) {
+	out, err := marshalDims(a.Dims, len(a.Values))
+	if err != nil {
+		return nil, err
+	}
+	for i, val := range a.Values {
+		num, err := EncodeNumber(val)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out = append(out, num...)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes an array saved with SAVE ... DATA a()
+func (a *NumberArray) UnmarshalBinary(data []byte) error {
+	dims, rest, err := unmarshalDims(data)
+	if err != nil {
+		return err
+	}
+	count := dimsProduct(dims)
+	if len(rest) != count*5 {
+		return fmt.Errorf("array data is %d bytes, want %d for %d elements", len(rest), count*5, count)
+	}
+
+	values := make([]float64, count)
+	for i := range values {
+		if values[i], err = DecodeNumber(rest[i*5 : i*5+5]); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+
+	a.Dims = dims
+	a.Values = values
+	return nil
+}
+
+// MarshalBinary encodes the array in the ROM format used by SAVE ... DATA:
+// number of dimensions, each dimension as 2 bytes, then 1 byte per character
+func (a *CharArray) MarshalBinary() ([]byte, error) {
+	out, err := marshalDims(a.Dims, len(a.Data))
+	if err != nil {
+		return nil, err
+	}
+	return append(out, a.Data...), nil
+}
+
+// UnmarshalBinary decodes an array saved with SAVE ... DATA a$()
+func (a *CharArray) UnmarshalBinary(data []byte) error {
+	dims, rest, err := unmarshalDims(data)
+	if err != nil {
+		return err
+	}
+	if count := dimsProduct(dims); len(rest) != count {
+		return fmt.Errorf("array data is %d bytes, want %d", len(rest), count)
+	}
+
+	a.Dims = dims
+	a.Data = append([]byte(nil), rest...)
+	return nil
+}
+
+// MarshalJSON encodes the array as nested JSON arrays, one level per dimension
+func (a *NumberArray) MarshalJSON() ([]byte, error) {
+	if err := checkDims(a.Dims, len(a.Values)); err != nil {
+		return nil, err
+	}
+	return json.Marshal(nestNumbers(a.Dims, a.Values))
+}
+
+// UnmarshalJSON decodes nested JSON arrays of numbers.
+// All rows of the same level must have the same length.
+func (a *NumberArray) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	var dims []int
+	var values []float64
+	var walk func(v interface{}, depth int) error
+	walk = func(v interface{}, depth int) error {
+		switch v := v.(type) {
+		case float64:
+			if depth != len(dims) {
+				return fmt.Errorf("array is not rectangular")
+			}
+			values = append(values, v)
+		case []interface{}:
+			if depth == len(dims) && len(values) == 0 {
+				dims = append(dims, len(v))
+			} else if depth >= len(dims) || dims[depth] != len(v) {
+				return fmt.Errorf("array is not rectangular")
+			}
+			for _, item := range v {
+				if err := walk(item, depth+1); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected %T in numeric array", v)
+		}
+		return nil
+	}
+	if err := walk(v, 0); err != nil {
+		return err
+	}
+	if err := checkDims(dims, len(values)); err != nil {
+		return err
+	}
+
+	a.Dims = dims
+	a.Values = values
+	return nil
+}
+
+// MarshalJSON encodes the array as nested JSON arrays of strings, the
+// last dimension being the string itself
+func (a *CharArray) MarshalJSON() ([]byte, error) {
+	if err := checkDims(a.Dims, len(a.Data)); err != nil {
+		return nil, err
+	}
+	return json.Marshal(nestStrings(a.Dims, a.Data))
+}
+
+// UnmarshalJSON decodes a JSON string or nested arrays of strings.
+// Strings shorter than the longest one are padded with spaces.
+func (a *CharArray) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	var dims []int
+	var items []string
+	maxLen := 0
+	var walk func(v interface{}, depth int) error
+	walk = func(v interface{}, depth int) error {
+		switch v := v.(type) {
+		case string:
+			if depth != len(dims) {
+				return fmt.Errorf("array is not rectangular")
+			}
+			s, err := stringToSpectrum(v)
+			if err != nil {
+				return err
+			}
+			if len(s) > maxLen {
+				maxLen = len(s)
+			}
+			items = append(items, s)
+		case []interface{}:
+			if depth == len(dims) && len(items) == 0 {
+				dims = append(dims, len(v))
+			} else if depth >= len(dims) || dims[depth] != len(v) {
+				return fmt.Errorf("array is not rectangular")
+			}
+			for _, item := range v {
+				if err := walk(item, depth+1); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected %T in character array", v)
+		}
+		return nil
+	}
+	if err := walk(v, 0); err != nil {
+		return err
+	}
+
+	dims = append(dims, maxLen)
+	a.Dims = dims
+	a.Data = padStrings(items, maxLen)
+	return checkDims(a.Dims, len(a.Data))
+}
+
+// WriteCSV writes a one or two dimensional array as CSV, one row per line
+func (a *NumberArray) WriteCSV(w io.Writer) error {
+	if err := checkDims(a.Dims, len(a.Values)); err != nil {
+		return err
+	}
+	rows, cols, err := csvShape(a.Dims)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	for r := 0; r < rows; r++ {
+		record := make([]string, cols)
+		for c := range record {
+			record[c] = formatNumber(a.Values[r*cols+c])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadNumberArrayCSV reads a numeric array from CSV. A single row gives a
+// one dimensional array, several rows give a two dimensional one.
+func ReadNumberArrayCSV(r io.Reader) (*NumberArray, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV contains no data")
+	}
+
+	a := &NumberArray{}
+	for i, record := range records {
+		for j, field := range record {
+			val, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d, column %d: invalid number %q", i+1, j+1, field)
+			}
+			a.Values = append(a.Values, val)
+		}
+	}
+
+	// encoding/csv already guarantees that all rows have the same length
+	if len(records) == 1 {
+		a.Dims = []int{len(records[0])}
+	} else {
+		a.Dims = []int{len(records), len(records[0])}
+	}
+	return a, checkDims(a.Dims, len(a.Values))
+}
+
+// WriteCSV writes a one or two dimensional array as CSV, one string per line
+func (a *CharArray) WriteCSV(w io.Writer) error {
+	if err := checkDims(a.Dims, len(a.Data)); err != nil {
+		return err
+	}
+	if len(a.Dims) > 2 {
+		return fmt.Errorf("CSV supports at most 2 dimensions, array has %d", len(a.Dims))
+	}
+
+	length := a.Dims[len(a.Dims)-1]
+	cw := csv.NewWriter(w)
+	for i := 0; i+length <= len(a.Data) && length > 0; i += length {
+		if err := cw.Write([]string{spectrumToString(a.Data[i : i+length])}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCharArrayCSV reads a character array from CSV with one string per
+// line. A single line gives a one dimensional array (a single string),
+// several lines give a two dimensional one.
+func ReadCharArrayCSV(r io.Reader) (*CharArray, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV contains no data")
+	}
+
+	items := make([]string, len(records))
+	maxLen := 0
+	for i, record := range records {
+		if items[i], err = stringToSpectrum(record[0]); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if len(items[i]) > maxLen {
+			maxLen = len(items[i])
+		}
+	}
+
+	a := &CharArray{Data: padStrings(items, maxLen)}
+	if len(records) == 1 {
+		a.Dims = []int{maxLen}
+	} else {
+		a.Dims = []int{len(records), maxLen}
+	}
+	return a, checkDims(a.Dims, len(a.Data))
+}
+
+// formatNumber formats a value the way it is written in CSV exports, with
+// as many digits as it takes to read back the same 5-byte number
+func formatNumber(val float64) string {
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+// checkDims validates the dimensions against the ROM limits and element count
+func checkDims(dims []int, count int) error {
+	if len(dims) == 0 || len(dims) > MaxArrayDims {
+		return fmt.Errorf("array must have between 1 and %d dimensions, has %d", MaxArrayDims, len(dims))
+	}
+	for i, dim := range dims {
+		if dim < 1 || dim > MaxArrayDim {
+			return fmt.Errorf("dimension %d must be between 1 and %d, is %d", i+1, MaxArrayDim, dim)
+		}
+	}
+	if want := dimsProduct(dims); want != count {
+		return fmt.Errorf("array has %d elements, dimensions require %d", count, want)
+	}
+	return nil
+}
+
+// marshalDims encodes the dimension table
+func marshalDims(dims []int, count int) ([]byte, error) {
+	if err := checkDims(dims, count); err != nil {
+		return nil, err
+	}
+	out := []byte{byte(len(dims))}
+	for _, dim := range dims {
+		out = binary.LittleEndian.AppendUint16(out, uint16(dim))
+	}
+	return out, nil
+}
+
+// unmarshalDims decodes the dimension table and returns the remaining data
+func unmarshalDims(data []byte) ([]int, []byte, error) {
+	if len(data) < 1 {
+		return nil, nil, fmt.Errorf("array data is empty")
+	}
+	n := int(data[0])
+	if n == 0 || len(data) < 1+2*n {
+		return nil, nil, fmt.Errorf("invalid dimension table")
+	}
+	dims := make([]int, n)
+	for i := range dims {
+		dims[i] = int(binary.LittleEndian.Uint16(data[1+2*i:]))
+	}
+	return dims, data[1+2*n:], nil
+}
+
+// dimsProduct returns the number of elements for the given dimensions
+func dimsProduct(dims []int) int {
+	count := 1
+	for _, dim := range dims {
+		count *= dim
+	}
+	return count
+}
+
+// csvShape returns rows and columns for a one or two dimensional array
+func csvShape(dims []int) (int, int, error) {
+	switch len(dims) {
+	case 1:
+		return 1, dims[0], nil
+	case 2:
+		return dims[0], dims[1], nil
+	}
+	return 0, 0, fmt.Errorf("CSV supports at most 2 dimensions, array has %d", len(dims))
+}
+
+// nestNumbers turns row-major values into nested slices
+func nestNumbers(dims []int, values []float64) interface{} {
+	if len(dims) == 1 {
+		return values
+	}
+	size := len(values) / dims[0]
+	rows := make([]interface{}, dims[0])
+	for i := range rows {
+		rows[i] = nestNumbers(dims[1:], values[i*size:(i+1)*size])
+	}
+	return rows
+}
+
+// nestStrings turns row-major characters into nested slices of strings
+func nestStrings(dims []int, data []byte) interface{} {
+	if len(dims) == 1 {
+		return spectrumToString(data)
+	}
+	size := len(data) / dims[0]
+	rows := make([]interface{}, dims[0])
+	for i := range rows {
+		rows[i] = nestStrings(dims[1:], data[i*size:(i+1)*size])
+	}
+	return rows
+}
+
+// padStrings joins strings padded with spaces to the same length
+func padStrings(items []string, length int) []byte {
+	out := make([]byte, 0, len(items)*length)
+	for _, item := range items {
+		out = append(out, item...)
+		for i := len(item); i < length; i++ {
+			out = append(out, ' ')
+		}
+	}
+	return out
+}
+
+// spectrumToString maps each Spectrum character to the rune with the same
+// code so that bytes above 0x7F survive a round trip through JSON and CSV
+func spectrumToString(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// stringToSpectrum is the inverse of spectrumToString
+func stringToSpectrum(s string) (string, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			return "", fmt.Errorf("character %q has no Spectrum equivalent", r)
+		}
+		out = append(out, byte(r))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,183 @@
+package basic
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeNumber(t *testing.T) {
+	tests := []struct {
+		name string
+		val  float64
+		want []byte
+	}{
+		{name: "Zero", val: 0, want: []byte{0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Small integer", val: 1234, want: []byte{0x00, 0x00, 0xD2, 0x04, 0x00}},
+		{name: "Negative integer", val: -1, want: []byte{0x00, 0xFF, 0xFF, 0xFF, 0x00}},
+		{name: "Largest small integer", val: 65535, want: []byte{0x00, 0x00, 0xFF, 0xFF, 0x00}},
+		{name: "Half", val: 0.5, want: []byte{0x80, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Negative fraction", val: -0.25, want: []byte{0x7F, 0x80, 0x00, 0x00, 0x00}},
+		{name: "Beyond small integers", val: 65536, want: []byte{0x91, 0x00, 0x00, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeNumber(tt.val)
+			if err != nil {
+				t.Fatalf("EncodeNumber() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("EncodeNumber() = % X, want % X", got, tt.want)
+			}
+
+			back, err := DecodeNumber(got)
+			if err != nil {
+				t.Fatalf("DecodeNumber() error = %v", err)
+			}
+			if back != tt.val {
+				t.Errorf("DecodeNumber() = %v, want %v", back, tt.val)
+			}
+		})
+	}
+}
+
+func TestNumberArrayBinary(t *testing.T) {
+	a := &NumberArray{Dims: []int{2, 3}, Values: []float64{1, 2, 3, -4, 0.5, 100000}}
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	if want := 1 + 2*2 + 6*5; len(data) != want {
+		t.Fatalf("MarshalBinary() length = %d, want %d", len(data), want)
+	}
+	if !bytes.Equal(data[:5], []byte{2, 2, 0, 3, 0}) {
+		t.Errorf("dimension table = % X, want 02 02 00 03 00", data[:5])
+	}
+
+	var back NumberArray
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if !reflect.DeepEqual(&back, a) {
+		t.Errorf("UnmarshalBinary() = %+v, want %+v", back, a)
+	}
+
+	if err := back.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("UnmarshalBinary() on truncated data: error = nil, want error")
+	}
+}
+
+func TestCharArrayBinary(t *testing.T) {
+	a := &CharArray{Dims: []int{2, 4}, Data: []byte("ABCDefgh")}
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	if want := []byte{2, 2, 0, 4, 0, 'A', 'B', 'C', 'D', 'e', 'f', 'g', 'h'}; !bytes.Equal(data, want) {
+		t.Errorf("MarshalBinary() = % X, want % X", data, want)
+	}
+
+	var back CharArray
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if !reflect.DeepEqual(&back, a) {
+		t.Errorf("UnmarshalBinary() = %+v, want %+v", back, a)
+	}
+}
+
+func TestArrayJSON(t *testing.T) {
+	var nums NumberArray
+	if err := json.Unmarshal([]byte(`[[1,2],[3,4],[5,6]]`), &nums); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(nums.Dims, []int{3, 2}) || len(nums.Values) != 6 {
+		t.Errorf("NumberArray = %+v, want 3x2", nums)
+	}
+	out, err := json.Marshal(&nums)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if string(out) != `[[1,2],[3,4],[5,6]]` {
+		t.Errorf("json.Marshal() = %s", out)
+	}
+
+	if err := json.Unmarshal([]byte(`[[1,2],[3]]`), &nums); err == nil {
+		t.Error("json.Unmarshal() ragged array: error = nil, want error")
+	}
+
+	var chars CharArray
+	if err := json.Unmarshal([]byte(`["HI","THERE"]`), &chars); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(chars.Dims, []int{2, 5}) || string(chars.Data) != "HI   THERE" {
+		t.Errorf("CharArray = %+v, want 2x5 padded", chars)
+	}
+}
+
+func TestArrayCSV(t *testing.T) {
+	nums, err := ReadNumberArrayCSV(strings.NewReader("1,2,3\n4,5.5,-6\n"))
+	if err != nil {
+		t.Fatalf("ReadNumberArrayCSV() error = %v", err)
+	}
+	if !reflect.DeepEqual(nums.Dims, []int{2, 3}) {
+		t.Errorf("Dims = %v, want [2 3]", nums.Dims)
+	}
+	var buf bytes.Buffer
+	if err := nums.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	if buf.String() != "1,2,3\n4,5.5,-6\n" {
+		t.Errorf("WriteCSV() = %q", buf.String())
+	}
+
+	single, err := ReadNumberArrayCSV(strings.NewReader("7,8\n"))
+	if err != nil {
+		t.Fatalf("ReadNumberArrayCSV() error = %v", err)
+	}
+	if !reflect.DeepEqual(single.Dims, []int{2}) {
+		t.Errorf("single row Dims = %v, want [2]", single.Dims)
+	}
+
+	chars, err := ReadCharArrayCSV(strings.NewReader("ALICE\nBOB\n"))
+	if err != nil {
+		t.Fatalf("ReadCharArrayCSV() error = %v", err)
+	}
+	if !reflect.DeepEqual(chars.Dims, []int{2, 5}) || string(chars.Data) != "ALICEBOB  " {
+		t.Errorf("CharArray = %+v, want 2x5 padded", chars)
+	}
+}
+
+func TestNumberArrayCSVRoundTrip(t *testing.T) {
+	// 107.86621794104576 needs more than 10 significant digits to keep
+	// the last byte of its mantissa
+	data := []byte{
+		1, 3, 0,
+		0x87, 0x57, 0xBB, 0x80, 0xEB,
+		0x81, 0x49, 0x0F, 0xDA, 0xA2,
+		0x00, 0xFF, 0xF6, 0xFF, 0x00,
+	}
+	var a NumberArray
+	if err := a.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := a.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	back, err := ReadNumberArrayCSV(&buf)
+	if err != nil {
+		t.Fatalf("ReadNumberArrayCSV() error = %v", err)
+	}
+	got, err := back.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("round trip = % X, want % X", got, data)
+	}
+}
@@ -0,0 +1,103 @@
+package basic
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// defFnPlaceholder follows every DEF FN parameter. The ROM copies the
+// argument into it when the function is called: the value for a numeric
+// parameter, or the start and length for a string parameter.
+var defFnPlaceholder = []byte{numberMarker, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// parseDefFn tokenizes the part of a DEF FN statement that follows the
+// keyword, up to and including the bracket that closes the parameter
+// list. Returns the number of characters consumed. Errors carry their
+// position in text.
+func (p *Parser) parseDefFn(text string, out *bytes.Buffer) (int, error) {
+	pos := skipSpacesFrom(text, 0)
+
+	// Function name: a single letter, with $ for a string function
+	name, n, err := p.parseDefFnName(text[pos:], "name")
+	if err != nil {
+		return 0, errorAt(pos, CodeDefFn, err)
+	}
+	out.WriteString(name)
+	pos = skipSpacesFrom(text, pos+n)
+
+	if pos >= len(text) || text[pos] != '(' {
+		return 0, errorAt(pos, CodeDefFn, fmt.Errorf("DEF FN %s must be followed by a parameter list in brackets", name))
+	}
+	out.WriteByte('(')
+	pos = skipSpacesFrom(text, pos+1)
+
+	// Parameters, each followed by its placeholder
+	seen := make(map[string]bool)
+	for pos < len(text) && text[pos] != ')' {
+		param, n, err := p.parseDefFnName(text[pos:], "parameter")
+		if err != nil {
+			return 0, errorAt(pos, CodeDefFn, err)
+		}
+		if seen[param] {
+			return 0, errorAt(pos, CodeDefFn, fmt.Errorf("DEF FN parameter %s used twice", param))
+		}
+		seen[param] = true
+
+		out.WriteString(param)
+		out.Write(defFnPlaceholder)
+		pos = skipSpacesFrom(text, pos+n)
+
+		if pos < len(text) && text[pos] == ',' {
+			out.WriteByte(',')
+			pos = skipSpacesFrom(text, pos+1)
+			if pos < len(text) && text[pos] == ')' {
+				return 0, errorAt(pos, CodeDefFn, fmt.Errorf("missing DEF FN parameter after ','"))
+			}
+			continue
+		}
+		if pos < len(text) && text[pos] != ')' {
+			return 0, errorAt(pos, CodeDefFn, fmt.Errorf("expected ',' or ')' after DEF FN parameter %s", param))
+		}
+	}
+
+	if pos >= len(text) {
+		return 0, errorAt(pos, CodeDefFn, fmt.Errorf("unclosed DEF FN parameter list"))
+	}
+	out.WriteByte(')')
+	pos++
+
+	if next := skipSpacesFrom(text, pos); next >= len(text) || text[next] != '=' {
+		return 0, errorAt(next, CodeDefFn, fmt.Errorf("DEF FN %s(...) must be followed by '='", name))
+	}
+
+	return pos, nil
+}
+
+// parseDefFnName reads a DEF FN function or parameter name, which is a
+// single letter optionally followed by $
+func (p *Parser) parseDefFnName(text, what string) (string, int, error) {
+	if text == "" || !isAlpha(text[0]) {
+		return "", 0, fmt.Errorf("DEF FN %s must be a letter", what)
+	}
+
+	n := 1
+	if n < len(text) && text[n] == '$' {
+		n++
+	}
+
+	// Spaces are ignored in names, so "ab" and "a b" are both too long
+	if next := skipSpacesFrom(text, n); next < len(text) && (isAlpha(text[next]) || isDigit(text[next])) {
+		return "", 0, fmt.Errorf("DEF FN %s must be a single letter", what)
+	}
+
+	return text[:n], n, nil
+}
+
+// skipSpacesFrom returns the position of the first non-space character
+// in text at or after pos
+func skipSpacesFrom(text string, pos int) int {
+	for pos < len(text) && isSpace(text[pos]) {
+		pos++
+	}
+	return pos
+}
@@ -0,0 +1,94 @@
+package basic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseDefFn(t *testing.T) {
+	placeholder := []byte{0x0E, 0x00, 0x00, 0x00, 0x00, 0x00}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:  "Two numeric parameters",
+			input: "DEF FN f(x,y)=x*y",
+			want:  join([]byte{0xCE, 'f', '(', 'x'}, placeholder, []byte{',', 'y'}, placeholder, []byte(")=x*y")),
+		},
+		{
+			name:  "String parameter",
+			input: "DEF FN a$(s$, n) = s$",
+			want:  join([]byte{0xCE, 'a', '$', '(', 's', '$'}, placeholder, []byte{',', 'n'}, placeholder, []byte(")=s$")),
+		},
+		{
+			name:  "No parameters",
+			input: "DEF FN p()=PI",
+			want:  []byte{0xCE, 'p', '(', ')', '=', 0xA7},
+		},
+		{
+			name:  "One parameter",
+			input: "DEF FN s(x)=x*x",
+			want:  join([]byte{0xCE, 's', '(', 'x'}, placeholder, []byte(")=x*x")),
+		},
+		{
+			name:    "Long function name",
+			input:   "DEF FN fn(x)=x",
+			wantErr: true,
+		},
+		{
+			name:    "Long parameter name",
+			input:   "DEF FN f(x1)=x1",
+			wantErr: true,
+		},
+		{
+			name:    "Duplicate parameter",
+			input:   "DEF FN f(x,x)=x",
+			wantErr: true,
+		},
+		{
+			name:    "Missing parameter",
+			input:   "DEF FN f(x,)=x",
+			wantErr: true,
+		},
+		{
+			name:    "Missing bracket",
+			input:   "DEF FN f=1",
+			wantErr: true,
+		},
+		{
+			name:    "Unclosed parameter list",
+			input:   "DEF FN f(x",
+			wantErr: true,
+		},
+		{
+			name:    "Missing equals",
+			input:   "DEF FN f(x)",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewParser().Parse(strings.NewReader("10 " + tt.input + "\n"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Strip the line number, length and final ENTER
+			if body := got[4 : len(got)-1]; !bytes.Equal(body, tt.want) {
+				t.Errorf("Parse() = % X, want % X", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package basic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity tells whether a diagnostic stops the program being built
+type Severity int
+
+const (
+	SeverityError   Severity = iota // The line could not be tokenized
+	SeverityWarning                 // The program was built but may not do what was meant
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic codes identify the kind of problem for tools that
+// match on them rather than on the message
+const (
+	CodeInput         = "input"          // Reading the source failed
+	CodeLineLength    = "line-length"    // Source line too long
+	CodeLineNumber    = "line-number"    // Missing or out of range line number
+	CodeLineOrder     = "line-order"     // Line number smaller than the one before
+	CodeDuplicateLine = "duplicate-line" // Line number used twice
+	CodeEmptyLine     = "empty-line"     // Line number without statements
+	CodeStatements    = "statements"     // Too many statements in a line
+	CodeBrackets      = "brackets"       // Unbalanced brackets
+	CodeNumber        = "number"         // Invalid number
+	CodeSequence      = "sequence"       // Invalid {...} sequence
+	CodeKeyword       = "keyword"        // Keyword not allowed here
+	CodeDefFn         = "def-fn"         // Invalid DEF FN name or parameters
+	CodeSyntax        = "syntax"         // Statement does not follow its keyword's syntax
+	CodeLabel         = "label"          // Undefined, duplicate or invalid label
+	CodePreprocessor  = "preprocessor"   // Invalid directive or missing include file
+	CodeStructure     = "structure"      // Unmatched WHILE, REPEAT, IF or DEF PROC block
+)
+
+// Diagnostic describes a problem found in the BASIC source
+type Diagnostic struct {
+	Severity Severity
+	File     string // Included file the problem is in, empty for the main input
+	Line     int    // Source line, counting from 1
+	Column   int    // Column in the source line, counting from 1, or 0 for the whole line
+	Offset   int    // Byte offset in the source
+	Code     string // One of the Code constants
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	if d.File != "" {
+		fmt.Fprintf(&b, "%s: ", d.File)
+	}
+	fmt.Fprintf(&b, "line %d", d.Line)
+	if d.Column > 0 {
+		fmt.Fprintf(&b, ":%d", d.Column)
+	}
+	if d.Severity == SeverityWarning {
+		b.WriteString(": warning")
+	}
+	fmt.Fprintf(&b, ": %s", d.Message)
+	return b.String()
+}
+
+// Diagnostics is the error Parse returns when the source has errors.
+// It holds every error found, in source order.
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	lines := make([]string, len(d))
+	for i, diag := range d {
+		lines[i] = diag.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WithWarningSink sets a function that receives each warning as it is
+// found. Without one, warnings are only available from Diagnostics.
+func WithWarningSink(sink func(Diagnostic)) Option {
+	return func(p *Parser) {
+		p.warningSink = sink
+	}
+}
+
+// lineError is an error at a position in the source line being parsed
+type lineError struct {
+	pos  int // Byte index in the line, or -1 for the whole line
+	code string
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return e.err.Error()
+}
+
+func (e *lineError) Unwrap() error {
+	return e.err
+}
+
+// errorAt returns err as an error at pos in the text being parsed
+func errorAt(pos int, code string, err error) error {
+	return &lineError{pos: pos, code: code, err: err}
+}
+
+// shiftError moves the position of a lineError by offset, for errors
+// found in a part of the line that starts at offset
+func shiftError(err error, offset int) error {
+	if le, ok := err.(*lineError); ok && le.pos >= 0 {
+		return &lineError{pos: le.pos + offset, code: le.code, err: le.err}
+	}
+	return err
+}
+
+// report records a diagnostic for the current source line. pos is the
+// byte index in the line, or -1 when the problem is the whole line.
+func (p *Parser) report(severity Severity, pos int, code, message string) {
+	d := Diagnostic{
+		Severity: severity,
+		File:     p.fileName,
+		Line:     p.lineCount,
+		Offset:   p.lineOffset,
+		Code:     code,
+		Message:  message,
+	}
+	if pos >= 0 && p.origin != nil {
+		pos = p.origin.position(pos)
+	}
+	if pos >= 0 {
+		d.Column = pos + 1
+		d.Offset += pos
+	}
+
+	p.diagnostics = append(p.diagnostics, d)
+	if severity == SeverityWarning && p.warningSink != nil {
+		p.warningSink(d)
+	}
+}
+
+// reportError records err, which may carry a position, as an error
+// diagnostic for the current source line
+func (p *Parser) reportError(err error) {
+	if le, ok := err.(*lineError); ok {
+		p.report(SeverityError, le.pos, le.code, le.err.Error())
+		return
+	}
+	p.report(SeverityError, -1, CodeInput, err.Error())
+}
+
+// Diagnostics returns the errors and warnings found by the last Parse
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// errors returns the error diagnostics found so far
+func (p *Parser) errors() Diagnostics {
+	var errs Diagnostics
+	for _, d := range p.diagnostics {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,89 @@
+package basic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	input := "10 PRINT 1.2.3\n" +
+		"20 PRINT \"ok\"\r\n" +
+		"20 GO TO 10\n" +
+		"5 STOP\n" +
+		"30 DEF FN f(x,x)=1\n"
+
+	var warnings []Diagnostic
+	p := NewParser(WithWarningSink(func(d Diagnostic) {
+		warnings = append(warnings, d)
+	}))
+	data, err := p.Parse(strings.NewReader(input))
+	if data != nil {
+		t.Errorf("Parse() returned data despite errors")
+	}
+
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("Parse() error = %v, want Diagnostics", err)
+	}
+
+	want := []Diagnostic{
+		{Severity: SeverityError, Line: 1, Column: 10, Offset: 9, Code: CodeNumber},
+		{Severity: SeverityError, Line: 4, Column: 0, Offset: 42, Code: CodeLineOrder},
+		{Severity: SeverityError, Line: 5, Column: 15, Offset: 63, Code: CodeDefFn},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(diags), len(want), diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Severity != w.Severity || d.Line != w.Line || d.Column != w.Column || d.Offset != w.Offset || d.Code != w.Code {
+			t.Errorf("error %d = %s (offset %d, code %s), want line %d:%d (offset %d, code %s)",
+				i, d, d.Offset, d.Code, w.Line, w.Column, w.Offset, w.Code)
+		}
+	}
+
+	if len(warnings) != 1 || warnings[0].Code != CodeDuplicateLine || warnings[0].Line != 3 {
+		t.Errorf("warnings = %+v, want one duplicate-line warning on line 3", warnings)
+	}
+	if got := len(p.Diagnostics()); got != 4 {
+		t.Errorf("Diagnostics() has %d entries, want 4", got)
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	tests := []struct {
+		name string
+		diag Diagnostic
+		want string
+	}{
+		{
+			name: "Error with column",
+			diag: Diagnostic{Severity: SeverityError, Line: 3, Column: 7, Message: "bad"},
+			want: "line 3:7: bad",
+		},
+		{
+			name: "Warning for whole line",
+			diag: Diagnostic{Severity: SeverityWarning, Line: 2, Message: "odd"},
+			want: "line 2: warning: odd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.diag.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWithoutErrors(t *testing.T) {
+	p := NewParser()
+	if _, err := p.Parse(strings.NewReader("10 PRINT 1\n10 STOP\n")); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if diags := p.Diagnostics(); len(diags) != 1 || diags[0].Severity != SeverityWarning {
+		t.Errorf("Diagnostics() = %+v, want one warning", diags)
+	}
+}
@@ -0,0 +1,146 @@
+package basic
+
+// Expression trees
+//
+// The syntax checker parses every expression of a tokenized line into a
+// tree of Expr nodes and checks the type of each operand. Positions are
+// byte offsets in the tokenized line.
+
+// ExprType is the type of value an expression produces
+type ExprType int
+
+const (
+	NumericType ExprType = iota
+	StringType
+)
+
+func (t ExprType) String() string {
+	if t == StringType {
+		return "string"
+	}
+	return "numeric"
+}
+
+// Expr is a node of an expression tree
+type Expr interface {
+	Type() ExprType
+	Position() int // Offset of the node in the tokenized line
+}
+
+// Number is a numeric literal, including BIN numbers
+type Number struct {
+	Pos   int
+	Value float64 // The hidden 5-byte value
+}
+
+// String is a string literal, without its quotes
+type String struct {
+	Pos   int
+	Value string // With "" already reduced to "
+}
+
+// Subscript is one item in brackets after a name or string: an index,
+// or a slice when it contains TO
+type Subscript struct {
+	From  Expr // nil when omitted in a slice
+	To    Expr // nil when omitted in a slice
+	Range bool // TO was given
+}
+
+// Variable is a variable, array element or slice of a string variable
+type Variable struct {
+	Pos        int
+	Name       string // Including $ for string variables
+	Subscripts []Subscript
+}
+
+// Slice is a slice of a string literal or bracketed string expression
+type Slice struct {
+	Pos       int
+	Operand   Expr
+	Subscript Subscript
+}
+
+// Unary is a prefix operator: '-' or NOT (0xC3). Unary plus is dropped.
+type Unary struct {
+	Pos     int
+	Op      byte
+	Operand Expr
+}
+
+// Binary is a binary operator, with Op holding the character or token
+type Binary struct {
+	Pos         int
+	Op          byte
+	Left, Right Expr
+}
+
+// Function is a call of a built-in function such as SIN or POINT, or a
+// function without arguments such as RND and PI
+type Function struct {
+	Pos   int
+	Token byte
+	Args  []Expr
+}
+
+// FnCall is a call of a function defined with DEF FN
+type FnCall struct {
+	Pos  int
+	Name string // Including $ for string functions
+	Args []Expr
+}
+
+func (n *Number) Type() ExprType { return NumericType }
+func (n *String) Type() ExprType { return StringType }
+func (n *Slice) Type() ExprType  { return StringType }
+func (n *Unary) Type() ExprType  { return NumericType }
+
+func (n *Variable) Type() ExprType { return nameType(n.Name) }
+func (n *FnCall) Type() ExprType   { return nameType(n.Name) }
+
+func (n *Binary) Type() ExprType {
+	switch n.Op {
+	case '+', 0xC6: // Joining strings, and a$ AND n
+		return n.Left.Type()
+	}
+	return NumericType
+}
+
+func (n *Function) Type() ExprType {
+	if TokenMap[n.Token].Type == TokenStrExpr {
+		return StringType
+	}
+	return NumericType
+}
+
+func (n *Number) Position() int   { return n.Pos }
+func (n *String) Position() int   { return n.Pos }
+func (n *Variable) Position() int { return n.Pos }
+func (n *Slice) Position() int    { return n.Pos }
+func (n *Unary) Position() int    { return n.Pos }
+func (n *Binary) Position() int   { return n.Pos }
+func (n *Function) Position() int { return n.Pos }
+func (n *FnCall) Position() int   { return n.Pos }
+
+// nameType returns the type of a variable or function name
+func nameType(name string) ExprType {
+	if len(name) > 0 && name[len(name)-1] == '$' {
+		return StringType
+	}
+	return NumericType
+}
+
+// ParseExpression parses a complete tokenized expression, as produced
+// by Parser, and checks its operand types
+func ParseExpression(data []byte) (Expr, error) {
+	c := &syntaxChecker{data: data}
+	expr, err := c.expression()
+	if err != nil {
+		return nil, err
+	}
+	c.skip()
+	if !c.atEnd() {
+		return nil, c.errorf("unexpected %s after expression", c.describe())
+	}
+	return expr, nil
+}
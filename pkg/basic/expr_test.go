@@ -0,0 +1,116 @@
+package basic
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dumpExpr writes an expression tree in prefix form for comparison
+func dumpExpr(e Expr) string {
+	switch n := e.(type) {
+	case *Number:
+		return fmt.Sprint(n.Value)
+	case *String:
+		return fmt.Sprintf("%q", n.Value)
+	case *Variable:
+		if len(n.Subscripts) == 0 {
+			return n.Name
+		}
+		var subs []string
+		for _, s := range n.Subscripts {
+			subs = append(subs, dumpSubscript(s))
+		}
+		return fmt.Sprintf("%s(%s)", n.Name, strings.Join(subs, ","))
+	case *Slice:
+		return fmt.Sprintf("%s(%s)", dumpExpr(n.Operand), dumpSubscript(n.Subscript))
+	case *Unary:
+		return fmt.Sprintf("(%s %s)", strings.Trim(describeByte(n.Op), "'"), dumpExpr(n.Operand))
+	case *Binary:
+		return fmt.Sprintf("(%s %s %s)", strings.Trim(describeByte(n.Op), "'"), dumpExpr(n.Left), dumpExpr(n.Right))
+	case *Function:
+		args := []string{TokenMap[n.Token].Text}
+		for _, a := range n.Args {
+			args = append(args, dumpExpr(a))
+		}
+		return "(" + strings.Join(args, " ") + ")"
+	case *FnCall:
+		args := []string{"FN " + n.Name}
+		for _, a := range n.Args {
+			args = append(args, dumpExpr(a))
+		}
+		return "(" + strings.Join(args, " ") + ")"
+	}
+	return "?"
+}
+
+func dumpSubscript(s Subscript) string {
+	var from, to string
+	if s.From != nil {
+		from = dumpExpr(s.From)
+	}
+	if !s.Range {
+		return from
+	}
+	if s.To != nil {
+		to = dumpExpr(s.To)
+	}
+	return from + " TO " + to
+}
+
+// tokenizeExpression tokenizes "LET v=expr" and returns the bytes of expr
+func tokenizeExpression(t *testing.T, target, expr string) []byte {
+	t.Helper()
+	data, err := NewParser().Parse(strings.NewReader("10 LET " + target + "=" + expr + "\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	body := data[4 : len(data)-1]
+	return body[bytes.IndexByte(body, '=')+1:]
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		target string
+		expr   string
+		want   string
+		typ    ExprType
+	}{
+		{"x", "1+2*3", "(+ 1 (* 2 3))", NumericType},
+		{"x", "(1+2)*3", "(* (+ 1 2) 3)", NumericType},
+		{"x", "-2^2", "(- (^ 2 2))", NumericType},
+		{"x", "NOT a=b AND c", "(AND (NOT (= a b)) c)", NumericType},
+		{"x", "SIN x+1", "(+ (SIN x) 1)", NumericType},
+		{"x", "BIN 101", "5", NumericType},
+		{"x", "LEN a$(2 TO )", "(LEN a$(2 TO ))", NumericType},
+		{"x", "b(1,n)", "b(1,n)", NumericType},
+		{"x", "POINT (1,2)+RND", "(+ (POINT 1 2) (RND))", NumericType},
+		{"s$", "\"a\"\"b\"( TO 2)", "\"a\\\"b\"( TO 2)", StringType},
+		{"s$", "a$+CHR$ 65", "(+ a$ (CHR$ 65))", StringType},
+		{"s$", "a$ AND x", "(AND a$ x)", StringType},
+		{"s$", "FN f$(1,\"a\")", "(FN f$ 1 \"a\")", StringType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseExpression(tokenizeExpression(t, tt.target, tt.expr))
+			if err != nil {
+				t.Fatalf("ParseExpression() error = %v", err)
+			}
+			if got := dumpExpr(expr); got != tt.want {
+				t.Errorf("ParseExpression() = %s, want %s", got, tt.want)
+			}
+			if expr.Type() != tt.typ {
+				t.Errorf("Type() = %v, want %v", expr.Type(), tt.typ)
+			}
+		})
+	}
+}
+
+func TestParseExpressionTrailing(t *testing.T) {
+	data := []byte("a)")
+	if _, err := ParseExpression(data); err == nil {
+		t.Error("ParseExpression() accepted trailing ')'")
+	}
+}
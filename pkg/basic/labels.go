@@ -0,0 +1,142 @@
+package basic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Labels mode
+//
+// With WithLabels, source lines have no line numbers. They are numbered
+// as they are read, and a line can be named with a label such as
+// @menu: in front of its statements, or on a line of its own to name
+// the line that follows. Anywhere outside strings and REM, @menu then
+// stands for the line number, so GO TO @menu is tokenized as GO TO 100.
+
+// WithLabels turns on labels mode, numbering lines from start in steps
+// of step
+func WithLabels(start, step int) Option {
+	return func(p *Parser) {
+		p.labels = true
+		p.labelStart = start
+		p.labelStep = step
+	}
+}
+
+// numberLines gives each source line its line number and records the
+// labels, before any line is tokenized, so that labels can be used
+// before they are defined
+func (p *Parser) numberLines(lines []sourceLine) {
+	p.labelLines = make(map[string]int)
+	defined := make(map[string]sourceLine) // Where each label is defined
+
+	var pending []string // Labels waiting for the next line
+	number := p.labelStart
+	for i := range lines {
+		source := &lines[i]
+		p.setSource(*source)
+
+		text := strings.TrimSpace(source.text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		label, rest, err := splitLabel(text)
+		if err != nil {
+			continue // Reported when the line is parsed
+		}
+		if label != "" {
+			if first, ok := defined[label]; ok {
+				p.report(SeverityError, strings.Index(source.text, "@"), CodeLabel,
+					fmt.Sprintf("label @%s is already defined at %s", label, first.location()))
+			} else {
+				defined[label] = *source
+				pending = append(pending, label)
+			}
+		}
+
+		if rest == "" {
+			source.number = -1
+			continue
+		}
+		for _, name := range pending {
+			p.labelLines[name] = number
+		}
+		pending = pending[:0]
+		source.number = number
+		number += p.labelStep
+	}
+
+	for _, name := range pending {
+		if p.structured && strings.HasPrefix(name, "_") {
+			// A block at the end jumps past the last line, which ends
+			// the program
+			p.labelLines[name] = number
+			continue
+		}
+		p.setSource(defined[name])
+		p.report(SeverityError, strings.Index(defined[name].text, "@"), CodeLabel,
+			fmt.Sprintf("label @%s is not followed by a line", name))
+	}
+}
+
+// labelledLine returns the number given to the current source line and
+// its statements, without the label
+func (p *Parser) labelledLine(line string) (int, string, error) {
+	if line != "" && isDigit(line[0]) {
+		return 0, "", fmt.Errorf("line numbers can't be used with labels")
+	}
+	_, rest, err := splitLabel(line)
+	if err != nil {
+		return 0, "", err
+	}
+	return p.autoNumber, rest, nil
+}
+
+// splitLabel separates a label definition from the start of a line. It
+// returns an empty label if the line doesn't start with one.
+func splitLabel(line string) (string, string, error) {
+	if !strings.HasPrefix(line, "@") {
+		return "", line, nil
+	}
+	length := labelLength(line[1:])
+	if length == 0 || !strings.HasPrefix(line[1+length:], ":") {
+		return "", "", fmt.Errorf("label must be @name: at the start of a line")
+	}
+	return line[1 : 1+length], strings.TrimSpace(line[2+length:]), nil
+}
+
+// labelLength returns the length of the label name at the start of text.
+// Names are letters, digits and underscores, not starting with a digit.
+func labelLength(text string) int {
+	if text == "" || !isWordStart(text[0]) {
+		return 0
+	}
+	length := 1
+	for length < len(text) && (isAlpha(text[length]) || isDigit(text[length]) || text[length] == '_') {
+		length++
+	}
+	return length
+}
+
+// labelReference tokenizes a reference to a label as its line number,
+// with both the digits and the hidden value. It returns the number of
+// characters used.
+func (p *Parser) labelReference(text string) ([]byte, int, error) {
+	length := labelLength(text[1:])
+	if length == 0 {
+		return nil, 0, fmt.Errorf("label name expected after @")
+	}
+	name := text[1 : 1+length]
+
+	number, ok := p.labelLines[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("undefined label @%s", name)
+	}
+	encoded, _, err := p.parseNumber(strconv.Itoa(number))
+	if err != nil {
+		return nil, 0, err
+	}
+	return encoded, 1 + length, nil
+}
@@ -0,0 +1,98 @@
+package basic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	source := `# Labels can be used before they are defined
+@start:
+  PRINT "@start is not a label here"
+@loop: GO SUB @sub: IF INKEY$="" THEN GO TO @loop
+  GO TO @start
+
+@sub:
+  REM @sub stays as it is
+  RETURN
+`
+	data, err := NewParser(WithLabels(100, 5)).Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := `100 PRINT "@start is not a label here"
+105 GO SUB 115: IF INKEY$="" THEN GO TO 105
+110 GO TO 100
+115 REM @sub stays as it is
+120 RETURN
+`
+	got, err := ListProgram(data)
+	if err != nil {
+		t.Fatalf("ListProgram() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// The digits and hidden values match those of a numbered source
+	numbered, err := NewParser().Parse(strings.NewReader(want))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if string(numbered) != string(data) {
+		t.Error("labelled program differs from the numbered one")
+	}
+}
+
+func TestLabelErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		line   int
+		column int
+		code   string
+	}{
+		{name: "Undefined", input: "CLS\nGO TO @nowhere\n", line: 2, column: 7, code: CodeLabel},
+		{name: "Duplicate", input: "@a: CLS\n @a: STOP\n", line: 2, column: 2, code: CodeLabel},
+		{name: "Label at end", input: "CLS\n@end:\n", line: 2, column: 1, code: CodeLabel},
+		{name: "Missing colon", input: "@a CLS\n", line: 1, code: CodeLineNumber},
+		{name: "Line number", input: "10 CLS\n", line: 1, code: CodeLineNumber},
+		{name: "No name", input: "GO TO @\n", line: 1, column: 7, code: CodeLabel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(WithLabels(10, 10)).Parse(strings.NewReader(tt.input))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			d := diags[0]
+			if d.Line != tt.line || d.Column != tt.column || d.Code != tt.code {
+				t.Errorf("got %v [%s], want line %d:%d [%s]", d, d.Code, tt.line, tt.column, tt.code)
+			}
+		})
+	}
+}
+
+func TestLabelsNumbering(t *testing.T) {
+	// A line with an error still takes its number, so later labels
+	// keep the numbers they would have had
+	parser := NewParser(WithLabels(1, 1))
+	_, err := parser.Parse(strings.NewReader("CLS\nPOKE\n@x: GO TO @x\n"))
+	var diags Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 1 || diags[0].Line != 2 {
+		t.Fatalf("Parse() error = %v, want one error on line 2", err)
+	}
+
+	data, err := NewParser(WithLabels(1, 1)).Parse(strings.NewReader("CLS\nSTOP\n@x: GO TO @x\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got, _ := ListProgram(data); !strings.HasSuffix(got, "3 GO TO 3\n") {
+		t.Errorf("got\n%s", got)
+	}
+}
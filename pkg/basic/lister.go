@@ -0,0 +1,331 @@
+package basic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"zxgotools/pkg/basic/zxfloat"
+)
+
+// Lister converts tokenized BASIC programs back into source text
+// that Parser accepts
+type Lister struct {
+	// Configuration
+	hiddenValues bool
+	unicode      bool
+	udgRunes     []rune // Characters written for UDGs A, B, C...
+}
+
+// ListerOption defines a lister configuration option
+type ListerOption func(*Lister)
+
+// WithHiddenValues lists numbers whose stored value differs from their
+// digits, and numbers without digits, with the {=value} sequence that
+// Parser accepts when WithFakeNumbers is set. Without it the stored
+// value replaces the digits, so the listing runs the same but looks
+// different on the Spectrum.
+func WithHiddenValues(v bool) ListerOption {
+	return func(l *Lister) {
+		l.hiddenValues = v
+	}
+}
+
+// NewLister creates a new BASIC lister with the given options
+func NewLister(options ...ListerOption) *Lister {
+	l := &Lister{}
+	for _, opt := range options {
+		opt(l)
+	}
+	return l
+}
+
+// controlNames maps the colour control codes to their sequence names
+var controlNames = map[byte]string{
+	0x10: "INK",
+	0x11: "PAPER",
+	0x12: "FLASH",
+	0x13: "BRIGHT",
+	0x14: "INVERSE",
+	0x15: "OVER",
+}
+
+// List writes the source text of a tokenized program, one line per
+// program line. Listing stops at the end of the data or at the first
+// line number above 16383, which marks the start of the variables area.
+func (l *Lister) List(w io.Writer, data []byte) error {
+	for pos := 0; pos+4 <= len(data); {
+		lineNum := int(data[pos])<<8 | int(data[pos+1])
+		if lineNum > 0x3FFF {
+			break
+		}
+		length := int(data[pos+2]) | int(data[pos+3])<<8
+		pos += 4
+
+		if pos+length > len(data) {
+			return fmt.Errorf("line %d: length %d runs past end of program", lineNum, length)
+		}
+
+		text, err := l.ListLine(data[pos : pos+length])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if _, err := fmt.Fprintf(w, "%d %s\n", lineNum, text); err != nil {
+			return err
+		}
+		pos += length
+	}
+	return nil
+}
+
+// ListLine converts the body of a single line (everything after the
+// line number and length) into source text
+func (l *Lister) ListLine(body []byte) (string, error) {
+	var out strings.Builder
+	var inString, inRem bool
+	var lastVisible byte // Last byte that appears in the listing
+
+	for pos := 0; pos < len(body); pos++ {
+		b := body[pos]
+
+		if b == 0x0D && pos == len(body)-1 {
+			break
+		}
+
+		if inRem || inString {
+			if b == '"' && inString {
+				inString = false
+				out.WriteByte('"')
+				continue
+			}
+			consumed := l.writeEscaped(&out, body[pos:])
+			pos += consumed - 1
+			continue
+		}
+
+		switch {
+		case b == '"':
+			inString = true
+			out.WriteByte('"')
+
+		case b == numberMarker:
+			if pos+5 >= len(body) {
+				return "", fmt.Errorf("number at offset %d is truncated", pos)
+			}
+			hidden := body[pos+1 : pos+6]
+			digits, binary := visibleNumber(body[:pos])
+			pos += 5
+
+			// A marker straight after a name is a DEF FN parameter placeholder
+			if digits == "" && (isAlpha(lastVisible) || lastVisible == '$') {
+				continue
+			}
+			// The ROM keeps the digits in front of the marker, which have
+			// already been listed
+			if digits != "" && storesValue(digits, binary, hidden) {
+				continue
+			}
+
+			val, err := zxfloat.FromBytes(hidden)
+			if err != nil {
+				return "", err
+			}
+			if l.hiddenValues {
+				fmt.Fprintf(&out, "{=%s}", val)
+				continue
+			}
+			if digits != "" {
+				removeDigits(&out, digits, binary)
+			}
+			out.WriteString(listNumber(val))
+			lastVisible = '0'
+			continue
+
+		case b >= 0xA3:
+			text := TokenMap[b].Text
+			if isAlpha(text[0]) && needsSpaceBefore(out.String()) {
+				out.WriteByte(' ')
+			}
+			out.WriteString(text)
+			if b == 0xEA { // REM keeps its text exactly as stored
+				inRem = true
+			} else if isAlpha(text[len(text)-1]) && pos+1 < len(body) && needsSpaceAfter(body[pos+1]) {
+				out.WriteByte(' ')
+			}
+
+		case b == ' ':
+			// Spaces outside strings are not significant to the parser
+			if needsSpaceBefore(out.String()) {
+				out.WriteByte(' ')
+			}
+
+		case b == ':':
+			trimSpaces(&out)
+			out.WriteString(": ")
+
+		case b >= 0x20 && b < 0x7F && b != '{' && l.unicodeRune(b) == 0:
+			out.WriteByte(b)
+
+		default:
+			consumed := l.writeEscaped(&out, body[pos:])
+			pos += consumed - 1
+		}
+
+		lastVisible = b
+	}
+
+	return strings.TrimRight(out.String(), " "), nil
+}
+
+// writeEscaped writes the character at the start of data, using a {...}
+// sequence for anything that isn't plain ASCII. It returns the number of
+// bytes consumed, which includes the parameters of control codes.
+func (l *Lister) writeEscaped(out *strings.Builder, data []byte) int {
+	b := data[0]
+
+	switch {
+	case l.unicodeRune(b) != 0:
+		out.WriteRune(l.unicodeRune(b))
+	case b >= 0x20 && b < 0x7F && b != '{':
+		out.WriteByte(b)
+	case b == 0x7F:
+		out.WriteString("{(C)}")
+	case b >= 0x80 && b <= 0xA2:
+		// Block graphics and UDGs
+		out.WriteString(TokenMap[b].Text)
+	case controlNames[b] != "" && len(data) > 1:
+		param := data[1]
+		if err := validateControlParamRange(controlNames[b], int(param)); err == nil {
+			fmt.Fprintf(out, "{%s %d}", controlNames[b], param)
+		} else {
+			fmt.Fprintf(out, "{%02X}{%02X}", b, param)
+		}
+		return 2
+	case b == 0x16 && len(data) > 2: // AT
+		fmt.Fprintf(out, "{%02X}{%02X}{%02X}", b, data[1], data[2])
+		return 3
+	case b == 0x17 && len(data) > 2: // TAB
+		fmt.Fprintf(out, "{%02X}{%02X}{%02X}", b, data[1], data[2])
+		return 3
+	default:
+		fmt.Fprintf(out, "{%02X}", b)
+	}
+	return 1
+}
+
+// validateControlParamRange checks a colour control parameter without
+// needing parser state
+func validateControlParamRange(cmd string, param int) error {
+	var p Parser
+	return p.validateControlParam(cmd, param, 0)
+}
+
+// visibleNumber returns the digits in front of a number marker at the
+// end of body, and whether they follow BIN
+func visibleNumber(body []byte) (string, bool) {
+	start := len(body)
+	for start > 0 && (isDigit(body[start-1]) || body[start-1] == '.') {
+		start--
+	}
+
+	// Exponent, as in 1.5e-3
+	if exp := start; exp > 1 && exp < len(body) {
+		if (body[exp-1] == '+' || body[exp-1] == '-') && exp > 2 {
+			exp--
+		}
+		if body[exp-1] == 'e' || body[exp-1] == 'E' {
+			mantissa := exp - 1
+			for mantissa > 0 && (isDigit(body[mantissa-1]) || body[mantissa-1] == '.') {
+				mantissa--
+			}
+			if mantissa < exp-1 {
+				start = mantissa
+			}
+		}
+	}
+
+	binary := start > 0 && body[start-1] == 0xC4
+	return string(body[start:]), binary
+}
+
+// storesValue reports whether the parser would store hidden for digits,
+// meaning the number is not a fake
+func storesValue(digits string, binary bool, hidden []byte) bool {
+	var encoded []byte
+	var err error
+	if binary {
+		encoded, _, err = NewParser().parseBinaryNumber("BIN " + digits)
+	} else {
+		encoded, _, err = NewParser().parseNumber(digits)
+	}
+	return err == nil && bytes.HasSuffix(encoded, hidden)
+}
+
+// removeDigits takes the digits of a number (and BIN before them) back
+// off the end of the listing
+func removeDigits(out *strings.Builder, digits string, binary bool) {
+	text := strings.TrimSuffix(out.String(), digits)
+	if binary {
+		text = strings.TrimSuffix(strings.TrimRight(text, " "), "BIN")
+	}
+	out.Reset()
+	out.WriteString(text)
+}
+
+// listNumber formats a number taken from its hidden 5-byte form with the
+// fewest digits that the parser converts back to the same bytes. The
+// ROM's conversion can be a few bits out, so numbers either side of the
+// nearest are tried too, with and without an exponent. If none of them
+// comes back exactly, the nearest is listed.
+func listNumber(n zxfloat.Number) string {
+	val := n.Float64()
+	for digits := 1; digits < 17; digits++ {
+		short, _ := strconv.ParseFloat(strconv.FormatFloat(val, 'e', digits-1, 64), 64)
+		step := math.Pow(10, math.Floor(math.Log10(math.Abs(short)))-float64(digits-1))
+		for nudge := -8.0; nudge <= 8; nudge++ {
+			near, _ := strconv.ParseFloat(strconv.FormatFloat(short+nudge*step, 'g', digits, 64), 64)
+			for _, format := range []byte{'g', 'f'} {
+				text := strconv.FormatFloat(near, format, -1, 64)
+				if back, err := zxfloat.Parse(text); err == nil && back == n {
+					return text
+				}
+			}
+		}
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+// needsSpaceBefore reports whether a keyword written after text needs a
+// separating space
+func needsSpaceBefore(text string) bool {
+	if text == "" {
+		return false
+	}
+	last := text[len(text)-1]
+	return isAlpha(last) || isDigit(last) || strings.IndexByte("$\")", last) >= 0
+}
+
+// needsSpaceAfter reports whether a keyword followed by the byte next
+// needs a separating space
+func needsSpaceAfter(next byte) bool {
+	return strings.IndexByte("*/+-=<>,;:)\r", next) < 0
+}
+
+// trimSpaces removes trailing spaces from the builder
+func trimSpaces(out *strings.Builder) {
+	text := strings.TrimRight(out.String(), " ")
+	out.Reset()
+	out.WriteString(text)
+}
+
+// ListProgram is a convenience wrapper that returns the listing as a string
+func ListProgram(data []byte, options ...ListerOption) (string, error) {
+	var buf bytes.Buffer
+	if err := NewLister(options...).List(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
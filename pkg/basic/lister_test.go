@@ -0,0 +1,234 @@
+package basic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"zxgotools/pkg/basic/zxfloat"
+)
+
+func TestListRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Simple program",
+			input: "10 PRINT \"HELLO\"\n20 GO TO 10\n",
+			want:  "10 PRINT \"HELLO\"\n20 GO TO 10\n",
+		},
+		{
+			name:  "Statements and THEN",
+			input: "10 LET a=1: IF a=1 THEN PRINT a: STOP\n",
+			want:  "10 LET a=1: IF a=1 THEN PRINT a: STOP\n",
+		},
+		{
+			name:  "Operators",
+			input: "10 IF a<=b AND c<>d THEN LET x=-1.5\n",
+			want:  "10 IF a<=b AND c<>d THEN LET x=-1.5\n",
+		},
+		{
+			name:  "Functions",
+			input: "10 LET s$=STR$ INT (RND*10)\n",
+			want:  "10 LET s$=STR$ INT (RND*10)\n",
+		},
+		{
+			name:  "String escapes",
+			input: "10 PRINT \"{(C)}{A}{-1}{+8}{INK 2}x{7B}\"\n",
+			want:  "10 PRINT \"{(C)}{A}{-1}{+8}{INK 2}x{7B}\"\n",
+		},
+		{
+			name:  "DEF FN",
+			input: "10 DEF FN f(x,s$)=x*LEN s$\n20 PRINT FN f(2,\"ab\")\n",
+			want:  "10 DEF FN f(x,s$)=x*LEN s$\n20 PRINT FN f(2,\"ab\")\n",
+		},
+		{
+			name:  "REM",
+			input: "10 REM hello: PRINT\n",
+			want:  "10 REM hello: PRINT\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := NewParser().Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			got, err := ListProgram(data)
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ListProgram() = %q, want %q", got, tt.want)
+			}
+
+			again, err := NewParser().Parse(strings.NewReader(got))
+			if err != nil {
+				t.Fatalf("Parse() of listing error = %v", err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Errorf("listing does not re-tokenize to the same bytes\ngot  % X\nwant % X", again, data)
+			}
+		})
+	}
+}
+
+func TestListLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Digits before hidden number",
+			body: []byte{0xF5, '4', '2', 0x0E, 0x00, 0x00, 42, 0x00, 0x00, 0x0D},
+			want: "PRINT 42",
+		},
+		{
+			name: "Hidden number without digits",
+			body: []byte{0xF5, 0x0E, 0x00, 0x00, 42, 0x00, 0x00, 0x0D},
+			want: "PRINT 42",
+		},
+		{
+			name: "Floating point number",
+			body: []byte{0xF5, 0x0E, 0x81, 0x40, 0x00, 0x00, 0x00, 0x0D},
+			want: "PRINT 1.5",
+		},
+		{
+			name: "DEF FN placeholder",
+			body: []byte{0xCE, 'f', '(', 'x', 0x0E, 0, 0, 0, 0, 0, ')', '=', 'x', 0x0D},
+			want: "DEF FN f(x)=x",
+		},
+		{
+			name: "Unknown control code in string",
+			body: []byte{0xF5, '"', 0x06, '"', 0x0D},
+			want: "PRINT \"{06}\"",
+		},
+		{
+			name: "AT in string",
+			body: []byte{0xF5, '"', 0x16, 1, 2, '"', 0x0D},
+			want: "PRINT \"{16}{01}{02}\"",
+		},
+		{
+			name:    "Truncated number",
+			body:    []byte{0xF5, 0x0E, 0x00, 0x00},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLister().ListLine(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ListLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListStopsAtVariables(t *testing.T) {
+	data := []byte{
+		0x00, 0x0A, 0x02, 0x00, 0xE2, 0x0D, // 10 STOP
+		0x61, 0x00, 0x00, 0x01, 0x00, 0x00, // Variable a=1
+	}
+
+	got, err := ListProgram(data)
+	if err != nil {
+		t.Fatalf("ListProgram() error = %v", err)
+	}
+	if got != "10 STOP\n" {
+		t.Errorf("ListProgram() = %q, want %q", got, "10 STOP\n")
+	}
+}
+
+func TestListHiddenValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		hidden bool
+		want   string
+	}{
+		{
+			name:  "Genuine numbers",
+			input: "10 LET a=BIN 101+1.50+2e3\n",
+			want:  "10 LET a=BIN 101+1.50+2e3\n",
+		},
+		{
+			name:  "Fake number shows stored value",
+			input: "10 PRINT 1{=2}: GO TO BIN 1{=20}\n",
+			want:  "10 PRINT 2: GO TO 20\n",
+		},
+		{
+			name:   "Fake number",
+			input:  "10 PRINT 1{=2}: GO TO BIN 1{=20}\n",
+			hidden: true,
+			want:   "10 PRINT 1{=2}: GO TO BIN 1{=20}\n",
+		},
+		{
+			name:   "Hidden value only",
+			input:  "10 PRINT {=-1}\n",
+			hidden: true,
+			want:   "10 PRINT {=-1}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := NewParser(WithFakeNumbers(true)).Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			got, err := ListProgram(data, WithHiddenValues(tt.hidden))
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ListProgram() = %q, want %q", got, tt.want)
+			}
+
+			if tt.hidden {
+				again, err := NewParser(WithFakeNumbers(true)).Parse(strings.NewReader(got))
+				if err != nil {
+					t.Fatalf("Parse() of listing error = %v", err)
+				}
+				if !bytes.Equal(again, data) {
+					t.Errorf("listing does not re-tokenize to the same bytes\ngot  % X\nwant % X", again, data)
+				}
+			}
+		})
+	}
+}
+
+func TestListStoredValueAsDigits(t *testing.T) {
+	// Values the ROM makes from typed digits, stored without the digits.
+	// The digits listed must convert back to the same bytes.
+	for _, typed := range []string{"0.1", "31847.84059", "1.5e-3", "123456789", "1e5"} {
+		value, err := zxfloat.Parse(typed)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", typed, err)
+		}
+		body := append([]byte{0xF5, numberMarker}, value[:]...)
+		data, err := (&Program{Lines: []*Line{NewLine(10, body)}}).MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() error = %v", err)
+		}
+
+		got, err := ListProgram(data)
+		if err != nil {
+			t.Fatalf("ListProgram() error = %v", err)
+		}
+		digits := strings.TrimSuffix(strings.TrimPrefix(got, "10 PRINT "), "\n")
+		if back, err := zxfloat.Parse(digits); err != nil || back != value {
+			t.Errorf("%s listed as %q, which is % X", typed, got, back[:])
+		}
+	}
+}
@@ -2,9 +2,10 @@ package basic
 
 import (
 	"fmt"
-	"math"
 	"strconv"
 	"strings"
+
+	"zxgotools/pkg/basic/zxfloat"
 )
 
 // Number types in the ZX Spectrum's Sinclair BASIC:
@@ -13,32 +14,37 @@ import (
 // 3. Binary numbers (BIN) - stored as small integers
 
 const (
-	numberMarker = 0x0E                  // Marks the start of a number in BASIC
-	shift31Bits  = float64(2147483648.0) // 2^31, used for mantissa calculation
+	numberMarker = 0x0E // Marks the start of a number in BASIC
 
 	// Number format limits
-	maxInt   = 65535
-	minInt   = -65535
-	maxExp   = 126
-	minExp   = -129
-	mantMask = 0x7F // Mask for mantissa bits in first byte
-	signMask = 0x80 // Mask for sign bit
-	expBias  = 0x81 // Exponent bias for floating point format
+	maxInt = 65535
+	minInt = -65535
 )
 
 // parseNumber tries to parse and encode a number from the text
-// Returns the encoded bytes and the number of characters consumed
+// Returns the encoded bytes and the number of characters consumed.
+// Like the ROM, the digits are kept as typed and followed by the
+// number marker and the 5-byte value.
 func (p *Parser) parseNumber(text string) ([]byte, int, error) {
+	// A hidden value on its own has no visible digits
+	if strings.HasPrefix(text, "{=") {
+		return p.parseHiddenValue(text)
+	}
+
+	// A number starts with a digit or a decimal point
+	if text == "" || !(isDigit(text[0]) || text[0] == '.') {
+		return nil, 0, nil
+	}
+
 	// Find the end of the number
 	i := 0
 	hasDecimal := false
-	hasExponent := false
 
 	// Look for integer/decimal part
 	for i < len(text) && (isDigit(text[i]) || text[i] == '.') {
 		if text[i] == '.' {
 			if hasDecimal {
-				return nil, 0, fmt.Errorf("%s: multiple decimal points in number", p.errorPrefix)
+				return nil, 0, fmt.Errorf("multiple decimal points in number")
 			}
 			hasDecimal = true
 		}
@@ -47,7 +53,6 @@ func (p *Parser) parseNumber(text string) ([]byte, int, error) {
 
 	// Look for exponent
 	if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
-		hasExponent = true
 		i++
 		if i < len(text) && (text[i] == '+' || text[i] == '-') {
 			i++
@@ -57,36 +62,27 @@ func (p *Parser) parseNumber(text string) ([]byte, int, error) {
 		}
 	}
 
-	if i == 0 {
-		return nil, 0, nil // Not a number
-	}
-
-	// Parse the number
+	// Convert the number as the ROM does, so whole numbers such as 1.0
+	// or 1e3 are small integers and the rest round the same way
 	numStr := text[:i]
-	val, err := strconv.ParseFloat(numStr, 64)
+	val, err := zxfloat.Parse(numStr)
 	if err != nil {
-		return nil, 0, fmt.Errorf("%s: invalid number format: %s", p.errorPrefix, numStr)
-	}
-
-	// Check for integer representation
-	if !hasDecimal && !hasExponent {
-		intVal := int(math.Floor(val))
-		if intVal >= minInt && intVal <= maxInt {
-			return encodeSmallInt(intVal), i, nil
-		}
+		return nil, 0, fmt.Errorf("invalid number: %w", err)
 	}
+	hidden := append([]byte{numberMarker}, val[:]...)
 
-	// Encode as floating point
-	result, err := encodeFloat(val)
-	if err != nil {
-		return nil, 0, fmt.Errorf("%s: %w", p.errorPrefix, err)
-	}
-	return result, i, nil
+	return p.withHiddenValue(numStr, hidden, text[i:])
 }
 
 // parseBinaryNumber handles BIN format numbers (e.g., BIN 01101)
+// The result holds the BIN token, the binary digits and the hidden value.
 func (p *Parser) parseBinaryNumber(text string) ([]byte, int, error) {
-	if len(text) < 4 || !strings.HasPrefix(text, "BIN") { // Must start with "BIN"
+	if len(text) < 4 || !p.hasKeywordPrefix(text, "BIN") { // Must start with "BIN"
+		return nil, 0, nil
+	}
+
+	// BIN followed by a letter is the start of a name, not a number
+	if isAlpha(text[3]) {
 		return nil, 0, nil
 	}
 
@@ -97,7 +93,7 @@ func (p *Parser) parseBinaryNumber(text string) ([]byte, int, error) {
 	}
 
 	if pos >= len(text) {
-		return nil, 0, fmt.Errorf("%s: expected binary digits after BIN", p.errorPrefix)
+		return nil, 0, fmt.Errorf("expected binary digits after BIN")
 	}
 
 	// Read binary digits
@@ -106,17 +102,65 @@ func (p *Parser) parseBinaryNumber(text string) ([]byte, int, error) {
 	for pos < len(text) && (text[pos] == '0' || text[pos] == '1') {
 		value = value*2 + int(text[pos]-'0')
 		if value > maxInt {
-			return nil, 0, fmt.Errorf("%s: binary number too large (maximum is %d)", p.errorPrefix, maxInt)
+			return nil, 0, fmt.Errorf("binary number too large (maximum is %d)", maxInt)
 		}
 		pos++
 	}
 
 	if pos == start {
-		return nil, 0, fmt.Errorf("%s: expected binary digits after BIN", p.errorPrefix)
+		return nil, 0, fmt.Errorf("expected binary digits after BIN")
+	}
+	if pos < len(text) && (isDigit(text[pos]) || text[pos] == '.') {
+		return nil, 0, fmt.Errorf("invalid binary digit '%c'", text[pos])
+	}
+
+	result, consumed, err := p.withHiddenValue(text[start:pos], encodeSmallInt(value), text[pos:])
+	if err != nil {
+		return nil, 0, err
+	}
+	return append([]byte{0xC4}, result...), start + consumed, nil
+}
+
+// withHiddenValue joins the visible digits and the hidden value. With fake
+// numbers enabled, a {=value} sequence straight after the digits replaces
+// the hidden value. Returns the bytes and the characters consumed,
+// counting the digits and any {=value} sequence.
+func (p *Parser) withHiddenValue(digits string, hidden []byte, rest string) ([]byte, int, error) {
+	consumed := len(digits)
+	if strings.HasPrefix(rest, "{=") {
+		fake, n, err := p.parseHiddenValue(rest)
+		if err != nil {
+			return nil, 0, err
+		}
+		hidden = fake
+		consumed += n
 	}
 
-	// Return as small integer
-	return encodeSmallInt(value), pos, nil
+	result := make([]byte, 0, len(digits)+len(hidden))
+	result = append(result, digits...)
+	return append(result, hidden...), consumed, nil
+}
+
+// parseHiddenValue parses a {=value} sequence into the number marker and
+// 5-byte value, without any visible digits
+func (p *Parser) parseHiddenValue(text string) ([]byte, int, error) {
+	end := strings.IndexByte(text, '}')
+	if end == -1 {
+		return nil, 0, fmt.Errorf("unclosed hidden number %q", text)
+	}
+	if !p.fakeNumbers {
+		return nil, 0, fmt.Errorf("hidden number %s needs fake numbers to be enabled", text[:end+1])
+	}
+
+	val, err := strconv.ParseFloat(strings.TrimSpace(text[2:end]), 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid hidden number %s", text[:end+1])
+	}
+	hidden, err := EncodeNumber(val)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append([]byte{numberMarker}, hidden...), end + 1, nil
 }
 
 // encodeSmallInt encodes a small integer in Spectrum format
@@ -124,7 +168,7 @@ func (p *Parser) parseBinaryNumber(text string) ([]byte, int, error) {
 // - byte 0: numberMarker (0x0E)
 // - byte 1: 0x00 (small integer flag)
 // - byte 2: sign (0x00 for positive, 0xFF for negative)
-// - byte 3: low byte
+// - byte 3: low byte (two's complement for negative values)
 // - byte 4: high byte
 // - byte 5: 0x00
 func encodeSmallInt(val int) []byte {
@@ -141,7 +185,7 @@ func encodeSmallInt(val int) []byte {
 
 	if val < 0 {
 		result[2] = 0xFF
-		val = -val
+		val += 0x10000
 	} else {
 		result[2] = 0x00
 	}
@@ -153,49 +197,22 @@ func encodeSmallInt(val int) []byte {
 	return result
 }
 
-// encodeFloat encodes a floating point number in Spectrum format
-// Format:
-// - byte 0: numberMarker (0x0E)
-// - byte 1: exponent (biased by 0x81)
-// - byte 2: bits 31-25 of mantissa with sign in bit 7
-// - byte 3: bits 24-17 of mantissa
-// - byte 4: bits 16-9 of mantissa
-// - byte 5: bits 8-1 of mantissa
-func encodeFloat(val float64) ([]byte, error) {
-	result := make([]byte, 6)
-	result[0] = numberMarker
-
-	// Handle zero specially
-	if val == 0 {
-		return result, nil // All bytes are already 0
-	}
-
-	// Handle negative numbers
-	sign := byte(0)
-	if val < 0 {
-		sign = signMask
-		val = -val
+// EncodeNumber encodes a value in the 5-byte form used by the ROM,
+// without the number marker. Integers from -65535 to 65535 use the
+// small integer form, everything else is stored as floating point.
+func EncodeNumber(val float64) ([]byte, error) {
+	n, err := zxfloat.FromFloat(val)
+	if err != nil {
+		return nil, fmt.Errorf("number out of range: %w", err)
 	}
+	return n[:], nil
+}
 
-	// Calculate exponent and mantissa
-	exp := math.Floor(math.Log2(val))
-	if exp < minExp || exp > maxExp {
-		return nil, fmt.Errorf("number out of range (exponent %d not in range %d to %d)", int(exp), minExp, maxExp)
+// DecodeNumber decodes a value stored in the ROM's 5-byte form
+func DecodeNumber(b []byte) (float64, error) {
+	n, err := zxfloat.FromBytes(b)
+	if err != nil {
+		return 0, err
 	}
-
-	// Calculate mantissa between 1 and 2
-	mantissa := val / math.Pow(2, exp)
-	// Convert to integer between 2^31 and 2^32
-	mantissa = (mantissa - 1.0) * shift31Bits
-	// Round to nearest integer
-	mantissaInt := uint32(math.Floor(mantissa + 0.5))
-
-	// Pack the bytes
-	result[1] = byte(exp) + expBias // Bias the exponent
-	result[2] = byte((mantissaInt>>24)&mantMask) | sign
-	result[3] = byte((mantissaInt >> 16) & 0xFF)
-	result[4] = byte((mantissaInt >> 8) & 0xFF)
-	result[5] = byte(mantissaInt & 0xFF)
-
-	return result, nil
+	return n.Float64(), nil
 }
@@ -2,6 +2,7 @@ package basic
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -16,19 +17,19 @@ func TestParseNumber(t *testing.T) {
 		{
 			name:    "Small integer",
 			input:   "123",
-			want:    []byte{0x0E, 0x00, 0x00, 123, 0x00, 0x00},
+			want:    []byte{'1', '2', '3', 0x0E, 0x00, 0x00, 123, 0x00, 0x00},
 			wantLen: 3,
 		},
 		{
+			// The minus sign is an operator, not part of the number
 			name:    "Negative integer",
 			input:   "-42",
-			want:    []byte{0x0E, 0x00, 0xFF, 42, 0x00, 0x00},
-			wantLen: 3,
+			wantLen: 0,
 		},
 		{
 			name:    "Zero",
 			input:   "0",
-			want:    []byte{0x0E, 0x00, 0x00, 0x00, 0x00, 0x00},
+			want:    []byte{'0', 0x0E, 0x00, 0x00, 0x00, 0x00, 0x00},
 			wantLen: 1,
 		},
 		{
@@ -79,7 +80,7 @@ func TestParseBinaryNumber(t *testing.T) {
 		{
 			name:    "Valid binary",
 			input:   "BIN 1010",
-			want:    []byte{0x0E, 0x00, 0x00, 10, 0x00, 0x00},
+			want:    []byte{0xC4, '1', '0', '1', '0', 0x0E, 0x00, 0x00, 10, 0x00, 0x00},
 			wantLen: 8,
 		},
 		{
@@ -90,7 +91,7 @@ func TestParseBinaryNumber(t *testing.T) {
 		{
 			name:    "Invalid digit",
 			input:   "BIN 102",
-			wantLen: 5,
+			wantErr: true,
 		},
 		{
 			name:    "Too large",
@@ -127,4 +128,65 @@ func TestParseBinaryNumber(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestFakeNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		fake    bool
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:  "Digits and value",
+			input: "10 PRINT 1\n",
+			want:  []byte{0x00, 0x0A, 0x09, 0x00, 0xF5, '1', 0x0E, 0x00, 0x00, 0x01, 0x00, 0x00, 0x0D},
+		},
+		{
+			name:  "Name with digits",
+			input: "10 PRINT a1\n",
+			want:  []byte{0x00, 0x0A, 0x04, 0x00, 0xF5, 'a', '1', 0x0D},
+		},
+		{
+			name:  "Fake value",
+			input: "10 PRINT 1{=2}\n",
+			fake:  true,
+			want:  []byte{0x00, 0x0A, 0x09, 0x00, 0xF5, '1', 0x0E, 0x00, 0x00, 0x02, 0x00, 0x00, 0x0D},
+		},
+		{
+			name:  "Hidden value only",
+			input: "10 PRINT {=-1}\n",
+			fake:  true,
+			want:  []byte{0x00, 0x0A, 0x08, 0x00, 0xF5, 0x0E, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x0D},
+		},
+		{
+			name:  "Fake binary value",
+			input: "10 PRINT BIN 1{=0.5}\n",
+			fake:  true,
+			want:  []byte{0x00, 0x0A, 0x0A, 0x00, 0xF5, 0xC4, '1', 0x0E, 0x80, 0x00, 0x00, 0x00, 0x00, 0x0D},
+		},
+		{
+			name:    "Fake numbers disabled",
+			input:   "10 PRINT 1{=2}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid hidden value",
+			input:   "10 PRINT 1{=x}\n",
+			fake:    true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewParser(WithFakeNumbers(tt.fake)).Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("Parse() = % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package basic
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Optimizing
+//
+// Program.Optimize makes a program smaller without changing what it
+// does. Each transform can be chosen separately:
+//
+//	rems     removes REM statements, and lines holding only a REM
+//	spaces   removes spaces outside strings and REM, which the ROM adds
+//	         back when listing
+//	numbers  writes numbers as NOT PI, SGN PI, CODE "x" or VAL "1234",
+//	         which avoid the 6 bytes that follow the digits of a number
+//	merge    joins a line onto the line before it, saving 4 bytes, when
+//	         nothing jumps to it and the line before has no IF or REM
+//
+// BIN is no help, as the ROM stores a hidden number after BIN as well.
+// The line numbers after GO TO, GO SUB, RESTORE, RUN, LIST, LLIST and
+// SAVE ... LINE are left as numbers. A REM holding machine code (any
+// byte below 32 or a keyword) is never removed, and the lines up to it
+// are left as they are so that the code doesn't move.
+
+// Transforms for WithTransforms
+const (
+	OptimizeRems    = "rems"
+	OptimizeSpaces  = "spaces"
+	OptimizeNumbers = "numbers"
+	OptimizeMerge   = "merge"
+)
+
+// Token values used when writing numbers
+const (
+	tokenPi   = 0xA7
+	tokenCode = 0xAF
+	tokenVal  = 0xB0
+	tokenSgn  = 0xBC
+	tokenNot  = 0xC3
+	tokenOr   = 0xC5
+	tokenAnd  = 0xC6
+	tokenIf   = 0xFA
+)
+
+// maxMergedLength limits the body of a merged line, so that it can
+// still be edited on the Spectrum
+const maxMergedLength = 255
+
+// optimizer holds the settings for Program.Optimize
+type optimizer struct {
+	transforms []string
+	targets    []int
+}
+
+// OptimizeOption defines an optimizing option
+type OptimizeOption func(*optimizer)
+
+// WithTransforms chooses the transforms to make, from OptimizeRems,
+// OptimizeSpaces, OptimizeNumbers and OptimizeMerge. By default all of
+// them are made.
+func WithTransforms(transforms ...string) OptimizeOption {
+	return func(o *optimizer) {
+		o.transforms = transforms
+	}
+}
+
+// WithJumpTargets adds lines that are started from outside the program,
+// such as the autostart line, so that they are not merged away
+func WithJumpTargets(lines ...int) OptimizeOption {
+	return func(o *optimizer) {
+		o.targets = append(o.targets, lines...)
+	}
+}
+
+// Saving is the number of bytes a transform saved
+type Saving struct {
+	Transform string
+	Bytes     int
+}
+
+// Optimization is the result of Program.Optimize
+type Optimization struct {
+	Savings  []Saving     // One for each transform, in the order made
+	Warnings []Diagnostic // Reasons transforms were held back
+}
+
+// Total returns the number of bytes saved by all the transforms
+func (o *Optimization) Total() int {
+	total := 0
+	for _, s := range o.Savings {
+		total += s.Bytes
+	}
+	return total
+}
+
+// Optimize makes the program smaller, as described above
+func (p *Program) Optimize(options ...OptimizeOption) (*Optimization, error) {
+	o := &optimizer{transforms: []string{OptimizeRems, OptimizeSpaces, OptimizeNumbers, OptimizeMerge}}
+	for _, opt := range options {
+		opt(o)
+	}
+
+	steps := map[string]func(*Program, int, *Optimization){
+		OptimizeRems:    removeRems,
+		OptimizeSpaces:  removeSpaces,
+		OptimizeNumbers: shortenNumbers,
+		OptimizeMerge:   o.mergeLines,
+	}
+	for _, name := range o.transforms {
+		if steps[name] == nil {
+			return nil, fmt.Errorf("unknown transform %q", name)
+		}
+	}
+
+	result := &Optimization{}
+	for _, name := range []string{OptimizeRems, OptimizeSpaces, OptimizeNumbers, OptimizeMerge} {
+		if !contains(o.transforms, name) {
+			continue
+		}
+		before := p.VarsOffset()
+		steps[name](p, p.fixedLines(), result)
+		result.Savings = append(result.Savings, Saving{Transform: name, Bytes: before - p.VarsOffset()})
+	}
+	return result, nil
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedLines returns the number of lines at the start of the program
+// that must not change: those up to the last REM holding machine code
+func (p *Program) fixedLines() int {
+	fixed := 0
+	for i, line := range p.Lines {
+		for _, s := range line.Statements() {
+			if s.Keyword() == tokenRem && holdsCode(s.Data) {
+				fixed = i + 1
+			}
+		}
+	}
+	return fixed
+}
+
+// holdsCode reports whether a REM statement holds machine code rather
+// than a comment
+func holdsCode(data []byte) bool {
+	for _, b := range data[keywordEnd(data):] {
+		if b < 0x20 || b >= 0xA5 {
+			return true
+		}
+	}
+	return false
+}
+
+// removeRems removes REM statements from the lines after the first
+// fixed ones. A line with nothing before its REM is removed; GO TO that
+// line then goes to the next one, as it would have done after the REM.
+func removeRems(p *Program, fixed int, _ *Optimization) {
+	lines := p.Lines[:fixed]
+	for _, line := range p.Lines[fixed:] {
+		statements := line.Statements()
+		last := statements[len(statements)-1]
+		if last.Keyword() != tokenRem || holdsCode(last.Data) {
+			lines = append(lines, line)
+			continue
+		}
+		if len(statements) == 1 {
+			continue
+		}
+
+		// Keep THEN, but not the ':' before the REM
+		end := last.Offset
+		if prev := statements[len(statements)-2]; prev.Data[len(prev.Data)-1] != tokenThen {
+			end--
+		}
+		line.Body = append(line.Body[:end:end], 0x0D)
+		lines = append(lines, line)
+	}
+	p.Lines = lines
+}
+
+// removeSpaces removes the spaces outside strings and REM from the
+// lines after the first fixed ones
+func removeSpaces(p *Program, fixed int, _ *Optimization) {
+	for _, line := range p.Lines[fixed:] {
+		spaces := make(map[int]bool)
+		forEachCode(line.Body, func(pos int) {
+			if line.Body[pos] == ' ' {
+				spaces[pos] = true
+			}
+		})
+
+		body := make([]byte, 0, len(line.Body))
+		for pos, b := range line.Body {
+			if !spaces[pos] {
+				body = append(body, b)
+			}
+		}
+		line.Body = body
+	}
+}
+
+// shortenNumbers writes numbers in the lines after the first fixed
+// ones in their shortest form
+func shortenNumbers(p *Program, fixed int, _ *Optimization) {
+	for _, line := range p.Lines[fixed:] {
+		body := line.Body
+		out := make([]byte, 0, len(body))
+		done := 0
+
+		for _, s := range line.Statements() {
+			if lineTargets[s.Keyword()] {
+				continue
+			}
+			forEachCode(s.Data, func(pos int) {
+				if s.Data[pos] != numberMarker || pos+6 > len(s.Data) {
+					return
+				}
+				start, form := numberForm(s.Data, pos)
+				if form == nil {
+					return
+				}
+				out = append(out, body[done:s.Offset+start]...)
+				out = append(out, form...)
+				done = s.Offset + pos + 6
+			})
+		}
+		out = append(out, body[done:]...)
+
+		// Keep the line as it was if the checker disagrees
+		if checkSyntax(out[:len(out)-1]) == nil {
+			line.Body = out
+		}
+	}
+}
+
+// numberForm returns a shorter form for the number whose marker is at
+// pos in a statement, and where its digits start. It returns nil if the
+// number must stay as it is.
+func numberForm(data []byte, pos int) (int, []byte) {
+	digits, binary := visibleNumber(data[:pos])
+	hidden := data[pos+1 : pos+6]
+	if digits == "" || binary || !storesValue(digits, false, hidden) {
+		return 0, nil // No digits, BIN or a fake number
+	}
+	start := pos - len(digits)
+
+	before := start
+	for before > 0 && data[before-1] == ' ' {
+		before--
+	}
+	if before > 0 && data[before-1] == tokenLine {
+		return 0, nil // Line number after SAVE ... LINE
+	}
+
+	value, err := DecodeNumber(hidden)
+	if err != nil {
+		return 0, nil
+	}
+	switch {
+	case value == 0 && endsOperand(data[pos+6:]):
+		// NOT binds less tightly than everything but AND and OR
+		return start, []byte{tokenNot, tokenPi}
+	case value == 0:
+		return start, []byte{tokenCode, '"', '"'}
+	case value == 1:
+		return start, []byte{tokenSgn, tokenPi}
+	case value == math.Trunc(value) && value >= 0x20 && value < 0x80 && value != '"':
+		return start, []byte{tokenCode, '"', byte(value), '"'}
+	}
+	return start, append(append([]byte{tokenVal, '"'}, digits...), '"')
+}
+
+// endsOperand reports whether the operand before rest is complete
+// without any operator that binds more tightly than NOT
+func endsOperand(rest []byte) bool {
+	for _, b := range rest {
+		switch b {
+		case ' ':
+			continue
+		case ':', ')', ',', ';', '\'', tokenThen, tokenTo, tokenStep, tokenAnd, tokenOr:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// mergeLines joins lines after the first fixed ones onto the line
+// before them where that can't change what the program does
+func (o *optimizer) mergeLines(p *Program, fixed int, result *Optimization) {
+	targets, warnings := p.jumpTargets("so no lines were merged")
+	if len(warnings) > 0 {
+		result.Warnings = append(result.Warnings, warnings...)
+		return
+	}
+	jumpedTo := p.jumpedTo(append(targets, o.targets...))
+
+	lines := p.Lines[:fixed]
+	for i, line := range p.Lines[fixed:] {
+		if i > 0 && !jumpedTo[line] {
+			prev := lines[len(lines)-1]
+			if canMergeInto(prev, line) {
+				prev.Body = append(append(prev.Body[:len(prev.Body)-1:len(prev.Body)-1], ':'), line.Body...)
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	p.Lines = lines
+}
+
+// jumpTargets returns the line numbers that GO TO, GO SUB, RESTORE,
+// RUN, LIST, LLIST and SAVE ... LINE refer to, and a warning ending with
+// consequence for each target that is not a line number
+func (p *Program) jumpTargets(consequence string) ([]int, []Diagnostic) {
+	var targets []int
+	var warnings []Diagnostic
+	for _, line := range p.Lines {
+		for _, s := range line.Statements() {
+			var pos int
+			switch {
+			case lineTargets[s.Keyword()]:
+				pos = keywordEnd(s.Data)
+			case s.Keyword() == tokenSave && findToken(s.Data, tokenLine) >= 0:
+				pos = findToken(s.Data, tokenLine) + 1
+			default:
+				continue
+			}
+
+			start, end, value, ok := literalTarget(s.Data, pos)
+			if start == end {
+				continue
+			}
+			if !ok {
+				warnings = append(warnings, Diagnostic{
+					Severity: SeverityWarning,
+					Line:     line.SourceLine,
+					Code:     CodeComputedTarget,
+					Message: fmt.Sprintf("line %d: %s target is not a line number, %s",
+						line.Number, TokenMap[s.Data[pos-1]].Text, consequence),
+				})
+				continue
+			}
+			targets = append(targets, value)
+		}
+	}
+	return targets, warnings
+}
+
+// jumpedTo returns the lines that jumps to targets arrive at: the first
+// line numbered at or after each target
+func (p *Program) jumpedTo(targets []int) map[*Line]bool {
+	lines := make(map[*Line]bool)
+	for _, target := range targets {
+		i := sort.Search(len(p.Lines), func(i int) bool { return p.Lines[i].Number >= target })
+		if i < len(p.Lines) {
+			lines[p.Lines[i]] = true
+		}
+	}
+	return lines
+}
+
+// canMergeInto reports whether line can be joined onto the end of prev.
+// Statements after an IF only run when its condition is true, and
+// anything after a REM is part of the comment.
+func canMergeInto(prev, line *Line) bool {
+	if len(prev.Body)+len(line.Body) > maxMergedLength {
+		return false
+	}
+	statements := prev.Statements()
+	if len(statements)+len(line.Statements()) > MaxStatements {
+		return false
+	}
+	for _, s := range statements {
+		if k := s.Keyword(); k == tokenIf || k == tokenRem {
+			return false
+		}
+	}
+	return true
+}
+
+// forEachCode calls fn with the position of each byte of body outside
+// strings and REM, skipping the hidden part of numbers and control
+// codes with their parameters
+func forEachCode(body []byte, fn func(pos int)) {
+	inString := false
+	for pos := 0; pos < len(body); pos++ {
+		b := body[pos]
+		switch {
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == tokenRem:
+			return
+		case b >= 0x10 && b <= 0x15: // INK to OVER, one parameter
+			pos++
+		case b == 0x16 || b == 0x17: // AT and TAB, two parameters
+			pos += 2
+		default:
+			fn(pos)
+			if b == numberMarker {
+				pos += 5
+			}
+		}
+	}
+}
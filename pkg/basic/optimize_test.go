@@ -0,0 +1,143 @@
+package basic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		transforms []string
+		options    []OptimizeOption
+		want       string
+		saved      []int // Bytes saved by each transform made
+		warnings   int
+	}{
+		{
+			name:       "REM lines and statements",
+			input:      "10 REM Start\n20 CLS: REM clear\n30 IF a THEN REM nothing\n40 STOP\n",
+			transforms: []string{OptimizeRems},
+			want:       "20 CLS\n30 IF a THEN\n40 STOP\n",
+			saved:      []int{29},
+		},
+		{
+			name:       "Numbers",
+			input:      "10 LET a=0: LET b=1: LET c=65: LET d=1234: LET e=0+a\n",
+			transforms: []string{OptimizeNumbers},
+			want:       "10 LET a=NOT PI: LET b=SGN PI: LET c=CODE \"A\": LET d=VAL \"1234\": LET e=CODE \"\"+a\n",
+			saved:      []int{5 + 5 + 4 + 3 + 4},
+		},
+		{
+			name:       "Line numbers and BIN are kept",
+			input:      "10 GO TO 20\n20 SAVE \"x\" LINE 10: PRINT BIN 101\n",
+			transforms: []string{OptimizeNumbers},
+			want:       "10 GO TO 20\n20 SAVE \"x\" LINE 10: PRINT BIN 101\n",
+			saved:      []int{0},
+		},
+		{
+			name:       "Merging",
+			input:      "10 CLS\n20 PRINT 1\n30 PRINT 2\n40 IF a THEN GO TO 30\n50 PRINT 3\n60 BEEP 1,1\n",
+			transforms: []string{OptimizeMerge},
+			want:       "10 CLS: PRINT 1\n30 PRINT 2: IF a THEN GO TO 30\n50 PRINT 3: BEEP 1,1\n",
+			saved:      []int{12},
+		},
+		{
+			name:       "Missing target goes to the next line",
+			input:      "10 GO TO 15\n20 CLS\n",
+			transforms: []string{OptimizeMerge},
+			want:       "10 GO TO 15\n20 CLS\n",
+			saved:      []int{0},
+		},
+		{
+			name:       "Autostart line",
+			input:      "10 CLS\n20 PRINT\n",
+			transforms: []string{OptimizeMerge},
+			options:    []OptimizeOption{WithJumpTargets(20)},
+			want:       "10 CLS\n20 PRINT\n",
+			saved:      []int{0},
+		},
+		{
+			name:       "Computed target",
+			input:      "10 GO TO a\n20 CLS\n",
+			transforms: []string{OptimizeMerge},
+			want:       "10 GO TO a\n20 CLS\n",
+			saved:      []int{0},
+			warnings:   1,
+		},
+		{
+			name:       "Machine code doesn't move",
+			input:      "10 LET a=1\n20 REM {00}{C9}\n30 REM x\n40 LET b=1\n",
+			transforms: nil,
+			want:       "10 LET a=1\n20 REM {00}{C9}\n40 LET b=SGN PI\n",
+			saved:      []int{8, 0, 5, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := NewParser().ParseProgram(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ParseProgram() error = %v", err)
+			}
+			options := tt.options
+			if tt.transforms != nil {
+				options = append(options, WithTransforms(tt.transforms...))
+			}
+			result, err := program.Optimize(options...)
+			if err != nil {
+				t.Fatalf("Optimize() error = %v", err)
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("got %d warnings, want %d: %v", len(result.Warnings), tt.warnings, result.Warnings)
+			}
+			if len(result.Savings) != len(tt.saved) {
+				t.Fatalf("got %d savings, want %d", len(result.Savings), len(tt.saved))
+			}
+			for i, s := range result.Savings {
+				if s.Bytes != tt.saved[i] {
+					t.Errorf("%s saved %d bytes, want %d", s.Transform, s.Bytes, tt.saved[i])
+				}
+			}
+
+			data, err := program.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() error = %v", err)
+			}
+			got, err := ListProgram(data)
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Optimize() gave\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimizeUnknownTransform(t *testing.T) {
+	program, _ := NewParser().ParseProgram(strings.NewReader("10 CLS\n"))
+	if _, err := program.Optimize(WithTransforms("colours")); err == nil {
+		t.Error("Optimize() error = nil")
+	}
+}
+
+func TestOptimizeSpaces(t *testing.T) {
+	// PRINT a ; " x " ; b : REM a b, with the spaces a program typed on
+	// a Spectrum keeps
+	body := []byte{0xF5, 'a', ' ', ';', ' ', '"', ' ', 'x', ' ', '"', ' ', ';', ' ', 'b', ' ', ':', 0xEA, 'a', ' ', 'b'}
+	program := &Program{Lines: []*Line{NewLine(10, body)}}
+
+	result, err := program.Optimize(WithTransforms(OptimizeSpaces))
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	want := []byte{0xF5, 'a', ';', '"', ' ', 'x', ' ', '"', ';', 'b', ':', 0xEA, 'a', ' ', 'b', 0x0D}
+	if got := program.Lines[0].Body; string(got) != string(want) {
+		t.Errorf("got % X, want % X", got, want)
+	}
+	if result.Total() != 5 {
+		t.Errorf("Total() = %d, want 5", result.Total())
+	}
+}
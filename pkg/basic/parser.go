@@ -18,6 +18,8 @@ const (
 type Parser struct {
 	// Configuration
 	caseIndependent bool
+	fakeNumbers     bool
+	syntaxCheck     bool
 
 	// Program type detection
 	is48K int // -1=unknown, 0=128K, 1=48K
@@ -29,14 +31,41 @@ type Parser struct {
 
 	// Statement context
 	bracketCount  int
-	handlingDEFFN bool
-	insideDEFFN   bool
-	tokenBracket  bool
 	inPrint       bool
 	currentParams []int
 
+	// Labels mode
+	labels     bool
+	labelStart int
+	labelStep  int
+	labelLines map[string]int // Line number of each label
+	autoNumber int            // Line number given to the current line
+
+	// Preprocessor
+	defines    map[string]string
+	includeDir string
+
+	// Structured mode
+	structured bool
+
+	// Source dialect
+	dialect Dialect
+
+	// Unicode source
+	unicode  bool
+	udgRunes []rune // Characters read as UDGs A, B, C...
+
+	// Machine code in REM lines
+	embedded []EmbeddedCode // Code in the lines parsed so far
+	lineCode []EmbeddedCode // Code in the current line, without its line number
+
 	// Error reporting
-	errorPrefix string
+	sourceMap   []int   // Position in the line text of each tokenized byte
+	fileName    string  // File of the current source line, empty for the main input
+	lineOffset  int     // Byte offset of the current source line
+	origin      *origin // Where the text of a line made by lowering came from
+	diagnostics []Diagnostic
+	warningSink func(Diagnostic)
 }
 
 // Option defines a parser configuration option
@@ -49,16 +78,38 @@ func WithCaseIndependent(v bool) Option {
 	}
 }
 
+// WithFakeNumbers allows a {=value} sequence after a number, so that the
+// value stored in the program differs from the digits LIST shows
+// (10 PRINT 1{=2} prints 2). A {=value} on its own stores a number
+// without any visible digits.
+func WithFakeNumbers(v bool) Option {
+	return func(p *Parser) {
+		p.fakeNumbers = v
+	}
+}
+
+// WithSyntaxCheck turns checking each statement against the ROM's syntax
+// rules on or off. It is on by default.
+func WithSyntaxCheck(v bool) Option {
+	return func(p *Parser) {
+		p.syntaxCheck = v
+	}
+}
+
 // NewParser creates a new BASIC parser with the given options
 func NewParser(options ...Option) *Parser {
 	p := &Parser{
 		is48K:         -1,
 		previousLine:  -1,
+		syntaxCheck:   true,
 		currentParams: make([]int, 0, 8),
 	}
 	for _, opt := range options {
 		opt(p)
 	}
+	if p.structured && !p.labels {
+		p.labels, p.labelStart, p.labelStep = true, 10, 10
+	}
 	return p
 }
 
@@ -79,21 +130,50 @@ func (p *Parser) StatementCount() int {
 	return p.statementCount
 }
 
-// Parse processes BASIC text into binary format suitable for TAP
+// Parse processes BASIC text into binary format suitable for TAP.
+// A line with an error is left out and parsing carries on with the next
+// one, so that every problem is found in one pass. If there were any
+// errors, the returned error is a Diagnostics holding all of them.
 func (p *Parser) Parse(r io.Reader) ([]byte, error) {
-	scanner := bufio.NewScanner(r)
-	var output bytes.Buffer
+	program, err := p.ParseProgram(r)
+	if err != nil {
+		return nil, err
+	}
+	return program.MarshalBinary()
+}
+
+// ParseProgram is like Parse but returns the program as separate lines,
+// each recording where it came from in the source
+func (p *Parser) ParseProgram(r io.Reader) (*Program, error) {
+	program := &Program{}
+	lines, readErr := readLines(r, "")
 
 	p.lineCount = 0
 	p.previousLine = -1
+	p.diagnostics = nil
+	p.embedded = nil
 
-	for scanner.Scan() {
-		p.lineCount++
-		line := scanner.Text()
+	end := sourceLine{line: len(lines) + 1}
+	if p.dialect == Zmakebas {
+		lines = joinContinuations(lines)
+	}
+	lines = p.preprocess(lines)
+	if p.structured {
+		lines = p.lower(lines)
+	}
+	if p.labels {
+		p.numberLines(lines)
+	}
+
+	for _, source := range lines {
+		p.setSource(source)
+		line := source.text
 
 		// Check line length
 		if len(line) > MaxLineLength {
-			return nil, fmt.Errorf("line %d: exceeds maximum length of %d characters", p.lineCount, MaxLineLength)
+			p.report(SeverityError, -1, CodeLineLength,
+				fmt.Sprintf("exceeds maximum length of %d characters", MaxLineLength))
+			continue
 		}
 
 		// Skip empty lines and comments
@@ -101,59 +181,146 @@ func (p *Parser) Parse(r io.Reader) ([]byte, error) {
 			continue
 		}
 
-		p.errorPrefix = fmt.Sprintf("line %d", p.lineCount)
+		// A label on its own names the next line
+		if p.labels && source.number < 0 {
+			continue
+		}
 
 		// Process the line
 		basicLine, lineNum, err := p.parseLine(line)
 		if err != nil {
-			return nil, fmt.Errorf("%s: %w", p.errorPrefix, err)
+			p.reportError(err)
+			continue
 		}
 
 		// Check line number sequence
 		if p.previousLine >= 0 {
 			if lineNum < p.previousLine {
-				return nil, fmt.Errorf("%s: number %d is smaller than previous line number %d",
-					p.errorPrefix, lineNum, p.previousLine)
+				p.report(SeverityError, -1, CodeLineOrder,
+					fmt.Sprintf("number %d is smaller than previous line number %d", lineNum, p.previousLine))
+				continue
 			}
 			if lineNum == p.previousLine {
-				fmt.Printf("Warning: Duplicate use of line number %d\n", lineNum)
+				p.report(SeverityWarning, -1, CodeDuplicateLine,
+					fmt.Sprintf("duplicate use of line number %d", lineNum))
 			}
 		}
 		p.previousLine = lineNum
 
-		// Write to output buffer
-		output.Write(basicLine)
+		program.Lines = append(program.Lines, &Line{
+			Number:       lineNum,
+			Body:         basicLine[4:],
+			SourceFile:   p.fileName,
+			SourceLine:   p.lineCount,
+			SourceOffset: p.lineOffset,
+		})
+		for _, code := range p.lineCode {
+			code.Line = lineNum
+			p.embedded = append(p.embedded, code)
+		}
+	}
+
+	if readErr != nil {
+		p.setSource(end)
+		p.report(SeverityError, -1, CodeInput, fmt.Sprintf("reading input: %v", readErr))
+	}
+
+	if errs := p.errors(); len(errs) > 0 {
+		return nil, errs
 	}
+	return program, nil
+}
+
+// sourceLine is a line of BASIC source and where it came from
+type sourceLine struct {
+	text   string
+	file   string  // Empty for the main input
+	line   int     // Counting from 1
+	offset int     // Byte offset in the file
+	number int     // Line number given in labels mode, -1 for a label on its own
+	origin *origin // Set for lines made by lowering structured blocks
+}
+
+// readLines reads every line of the source. It returns the lines read
+// before any error.
+func readLines(r io.Reader, file string) ([]sourceLine, error) {
+	scanner := bufio.NewScanner(r)
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading input: %w", err)
+	// Track the byte offset of each line, including its line ending
+	var lines []sourceLine
+	lineOffset, nextOffset := 0, 0
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			lineOffset = nextOffset
+			nextOffset += advance
+		}
+		return advance, token, err
+	})
+
+	for scanner.Scan() {
+		lines = append(lines, sourceLine{
+			text:   scanner.Text(),
+			file:   file,
+			line:   len(lines) + 1,
+			offset: lineOffset,
+		})
 	}
+	return lines, scanner.Err()
+}
+
+// setSource makes source the line that diagnostics are reported for
+func (p *Parser) setSource(source sourceLine) {
+	p.fileName = source.file
+	p.lineCount = source.line
+	p.lineOffset = source.offset
+	p.autoNumber = source.number
+	p.origin = source.origin
+}
 
-	return output.Bytes(), nil
+// ParseLine tokenizes a single line of source text, such as
+// "10 PRINT 1", for adding to a Program. What the parser holds from the
+// last ParseProgram, such as EmbeddedCode, is left as it was.
+func (p *Parser) ParseLine(text string) (*Line, error) {
+	// The line is parsed as a program of its own by a copy of the parser
+	single := *p
+	program, err := single.ParseProgram(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	if len(program.Lines) != 1 {
+		return nil, fmt.Errorf("expected one line, found %d", len(program.Lines))
+	}
+	return program.Lines[0], nil
 }
 
-// parseLine converts a single line of text into BASIC binary format
+// parseLine converts a single line of text into BASIC binary format.
+// Errors carry their position in text.
 func (p *Parser) parseLine(text string) ([]byte, int, error) {
 	// Extract line number
 	lineNum, rest, err := p.extractLineNumber(text)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, errorAt(-1, CodeLineNumber, err)
 	}
 
 	if lineNum < 0 || lineNum > 9999 {
-		return nil, 0, fmt.Errorf("line number must be between 0 and 9999")
+		return nil, 0, errorAt(-1, CodeLineNumber, fmt.Errorf("line number must be between 0 and 9999"))
 	}
 
 	// Check for empty line (just a line number)
 	if rest == "" {
-		return nil, 0, fmt.Errorf("line contains no statements")
+		return nil, 0, errorAt(-1, CodeEmptyLine, fmt.Errorf("line contains no statements"))
 	}
 
+	// rest runs to the end of the line, apart from trailing spaces,
+	// so its last occurrence is where it starts
+	restPos := strings.LastIndex(text, rest)
+
 	var lineBuf bytes.Buffer
 
-	// Write line number (little-endian)
-	lineBuf.WriteByte(byte(lineNum & 0xFF))
+	// Write line number (big-endian, unlike every other word in the program)
 	lineBuf.WriteByte(byte(lineNum >> 8))
+	lineBuf.WriteByte(byte(lineNum & 0xFF))
 
 	// Reserve space for line length (will be filled in later)
 	lengthPos := lineBuf.Len()
@@ -165,17 +332,24 @@ func (p *Parser) parseLine(text string) ([]byte, int, error) {
 
 	// Convert the line contents
 	if err := p.convertLine(rest, &lineBuf); err != nil {
-		return nil, 0, err
+		return nil, 0, shiftError(err, restPos)
 	}
 
 	// Check statement count
 	if p.statementCount > MaxStatements {
-		return nil, 0, fmt.Errorf("too many statements (maximum is %d)", MaxStatements)
+		return nil, 0, errorAt(-1, CodeStatements, fmt.Errorf("too many statements (maximum is %d)", MaxStatements))
 	}
 
 	// Check final bracket count
 	if p.bracketCount != 0 {
-		return nil, 0, fmt.Errorf("mismatched brackets (count: %d)", p.bracketCount)
+		return nil, 0, errorAt(-1, CodeBrackets, fmt.Errorf("mismatched brackets (count: %d)", p.bracketCount))
+	}
+
+	// Check each statement against its keyword's syntax
+	if p.syntaxCheck {
+		if err := checkSyntax(lineBuf.Bytes()[lengthPos+2:]); err != nil {
+			return nil, 0, errorAt(restPos+p.sourcePos(err.(*syntaxError).pos, rest), CodeSyntax, err)
+		}
 	}
 
 	// Add end of line marker
@@ -194,26 +368,57 @@ func (p *Parser) parseLine(text string) ([]byte, int, error) {
 func (p *Parser) convertLine(text string, out *bytes.Buffer) error {
 	var inString bool
 	var inRem bool
+	var inName bool     // Inside a variable name, where digits are not numbers
+	var expectName bool // After LET, FOR, NEXT or DIM, where a variable comes next
 	pos := 0
 
 	expectKeyword := true
 
+	// Record where in text each output byte came from, so that the syntax
+	// checker can report positions in the source
+	base := out.Len()
+	p.sourceMap = p.sourceMap[:0]
+	itemStart := 0
+	mapItem := func() {
+		for len(p.sourceMap) < out.Len()-base {
+			p.sourceMap = append(p.sourceMap, itemStart)
+		}
+	}
+	defer mapItem()
+
 	for pos < len(text) {
+		mapItem()
+
 		// Skip whitespace unless in string or REM
+		spaced := false
 		if !inString && !inRem {
 			for pos < len(text) && text[pos] == ' ' {
 				pos++
+				spaced = true
 			}
 			if pos >= len(text) {
 				break
 			}
 		}
+		itemStart = pos
+		wasName := inName
+		inName = false
+
+		// Letters straight after a name, or where a variable is expected,
+		// are part of a name rather than the start of a keyword
+		nameOnly := isAlpha(text[pos]) && ((wasName && !spaced) || expectName)
+		expectName = false
 
 		if inRem {
 			// After REM, copy everything as-is, expanding sequences
+			pos = p.remCodeStart(text, pos)
 			for pos < len(text) {
-				if match, err := p.expandSequence(text[pos:], false); err != nil {
-					return fmt.Errorf("in REM: %w", err)
+				if consumed, err := p.incbin(text[pos:], out, base); err != nil {
+					return errorAt(pos, CodeSequence, fmt.Errorf("in REM: %w", err))
+				} else if consumed > 0 {
+					pos += consumed
+				} else if match, err := p.expandSequence(text[pos:], false); err != nil {
+					return errorAt(pos, CodeSequence, fmt.Errorf("in REM: %w", err))
 				} else if match != nil {
 					out.Write(match.Bytes)
 					pos += match.Length
@@ -234,7 +439,7 @@ func (p *Parser) convertLine(text string, out *bytes.Buffer) error {
 			}
 			// Look for special sequences in strings
 			if match, err := p.expandSequence(text[pos:], false); err != nil {
-				return fmt.Errorf("in string: %w", err)
+				return errorAt(pos, CodeSequence, fmt.Errorf("in string: %w", err))
 			} else if match != nil {
 				out.Write(match.Bytes)
 				pos += match.Length
@@ -256,10 +461,6 @@ func (p *Parser) convertLine(text string, out *bytes.Buffer) error {
 		// Handle brackets
 		if text[pos] == '(' {
 			p.bracketCount++
-			if p.handlingDEFFN && !p.insideDEFFN {
-				p.insideDEFFN = true
-			}
-			p.tokenBracket = true
 			out.WriteByte('(')
 			pos++
 			continue
@@ -267,68 +468,88 @@ func (p *Parser) convertLine(text string, out *bytes.Buffer) error {
 		if text[pos] == ')' {
 			p.bracketCount--
 			if p.bracketCount < 0 {
-				return fmt.Errorf("too many closing brackets")
-			}
-			if p.handlingDEFFN && p.insideDEFFN {
-				// Insert room for evaluator (call by value)
-				out.WriteByte(0x0E)
-				out.WriteByte(0x00)
-				out.WriteByte(0x00)
-				out.WriteByte(0x00)
-				out.WriteByte(0x00)
-				out.WriteByte(0x00)
-				p.insideDEFFN = false
-				p.handlingDEFFN = false
+				return errorAt(pos, CodeBrackets, fmt.Errorf("too many closing brackets"))
 			}
-			p.tokenBracket = false
 			out.WriteByte(')')
 			pos++
 			continue
 		}
 
+		// Statement separator
+		if text[pos] == ':' {
+			p.statementCount++
+			expectKeyword = true
+			p.inPrint = false
+			// Reset parameter state
+			p.currentParams = p.currentParams[:0]
+			out.WriteByte(':')
+			pos++
+			continue
+		}
+
+		// A label reference stands for the number of its line
+		if p.labels && text[pos] == '@' {
+			bytes, consumed, err := p.labelReference(text[pos:])
+			if err != nil {
+				return errorAt(pos, CodeLabel, err)
+			}
+			out.Write(bytes)
+			pos += consumed
+			expectKeyword = false
+			continue
+		}
+
+		// Try to parse a binary number before BIN is taken as a keyword
+		if nameOnly {
+			// Copied below
+		} else if bytes, consumed, err := p.parseBinaryNumber(text[pos:]); err != nil {
+			return errorAt(pos, CodeNumber, fmt.Errorf("parsing binary: %w", err))
+		} else if consumed > 0 {
+			out.Write(bytes)
+			pos += consumed
+			expectKeyword = false
+			continue
+		}
+
 		// Try to match a token
-		if match, err := p.matchToken(text[pos:], expectKeyword); err != nil {
-			return err
+		if nameOnly {
+			// Copied below
+		} else if match, err := p.matchToken(text[pos:], expectKeyword); err != nil {
+			return errorAt(pos, CodeKeyword, err)
 		} else if match != nil {
 			// Handle special tokens
 			switch match.Value {
 			case 0xEA: // REM
 				inRem = true
-			case 0xCE: // DEF FN
-				p.handlingDEFFN = true
-			case 0xF5, 0xE0: // PRINT or LPRINT
+			case 0xF5, 0xE0, 0xEE: // PRINT, LPRINT or INPUT
 				p.inPrint = true
-			case ':':
-				p.statementCount++
-				expectKeyword = true
-				p.inPrint = false
-				// Reset parameter state
-				p.currentParams = p.currentParams[:0]
-				pos++
-				continue
+			case 0xF1, 0xEB, 0xF3, 0xE9: // LET, FOR, NEXT or DIM
+				expectName = true
 			}
 
 			out.WriteByte(match.Value)
 			pos += match.Length
 
-			// After a token, the next token can be any type
-			expectKeyword = false
-			continue
-		}
+			// DEF FN name and parameters, with room for the argument values
+			if match.Value == 0xCE {
+				consumed, err := p.parseDefFn(text[pos:], out)
+				if err != nil {
+					return shiftError(err, pos)
+				}
+				pos += consumed
+			}
 
-		// Try to parse a number
-		if bytes, consumed, err := p.parseNumber(text[pos:]); err != nil {
-			return fmt.Errorf("parsing number: %w", err)
-		} else if consumed > 0 {
-			out.Write(bytes)
-			pos += consumed
-			expectKeyword = false
+			// After a token, the next token can be any type,
+			// except after THEN where a new statement starts
+			expectKeyword = match.Value == 0xCB
 			continue
 		}
 
-		// Try to parse a binary number
-		if bytes, consumed, err := p.parseBinaryNumber(text[pos:]); err != nil {
-			return fmt.Errorf("parsing binary: %w", err)
+		// Try to parse a number
+		if wasName && isDigit(text[pos]) {
+			// Part of a name such as a1, copied below
+		} else if bytes, consumed, err := p.parseNumber(text[pos:]); err != nil {
+			return errorAt(pos, CodeNumber, fmt.Errorf("parsing number: %w", err))
 		} else if consumed > 0 {
 			out.Write(bytes)
 			pos += consumed
@@ -338,7 +559,7 @@ func (p *Parser) convertLine(text string, out *bytes.Buffer) error {
 
 		// Look for special sequences
 		if match, err := p.expandSequence(text[pos:], true); err != nil {
-			return fmt.Errorf("expanding sequence: %w", err)
+			return errorAt(pos, CodeSequence, fmt.Errorf("expanding sequence: %w", err))
 		} else if match != nil {
 			out.Write(match.Bytes)
 			pos += match.Length
@@ -347,6 +568,7 @@ func (p *Parser) convertLine(text string, out *bytes.Buffer) error {
 
 		// Just copy any other character
 		out.WriteByte(text[pos])
+		inName = isAlpha(text[pos]) || (wasName && isDigit(text[pos]))
 		pos++
 		
 		// Reset expectKeyword if this wasn't whitespace
@@ -362,6 +584,10 @@ func (p *Parser) convertLine(text string, out *bytes.Buffer) error {
 func (p *Parser) extractLineNumber(line string) (int, string, error) {
 	line = strings.TrimSpace(line)
 
+	if p.labels {
+		return p.labelledLine(line)
+	}
+
 	// Find first non-digit
 	i := 0
 	for i < len(line) && isDigit(line[i]) {
@@ -383,16 +609,22 @@ func (p *Parser) extractLineNumber(line string) (int, string, error) {
 	return num, rest, nil
 }
 
+// sourcePos returns the position in text of the tokenized byte at
+// offset. An offset past the last byte is the end of the text.
+func (p *Parser) sourcePos(offset int, text string) int {
+	if offset >= len(p.sourceMap) {
+		return len(text)
+	}
+	return p.sourceMap[offset]
+}
+
 // resetState resets the parser state for a new line
 func (p *Parser) resetState() {
 	p.statementCount = 0
 	p.bracketCount = 0
-	p.handlingDEFFN = false
-	p.insideDEFFN = false
-	p.tokenBracket = false
 	p.inPrint = false
 	p.currentParams = p.currentParams[:0]
-	p.errorPrefix = fmt.Sprintf("line %d", p.lineCount)
+	p.lineCode = p.lineCode[:0]
 }
 
 func isDigit(c byte) bool {
@@ -0,0 +1,298 @@
+package basic
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Preprocessor
+//
+// Before tokenizing, lines starting with one of these directives are
+// carried out and removed:
+//
+//	#include "file.bas"   insert another source file
+//	#define NAME value    replace NAME with value in the lines that follow
+//	#undef NAME           forget a definition
+//	#ifdef NAME, #ifndef NAME, #else, #endif
+//	                      keep or drop lines depending on definitions
+//
+// Any other line starting with # is a comment, as before. Names are
+// replaced as whole words outside strings and REM, so NAME does not
+// change NAMES, NAME$, "NAME" or REM NAME.
+
+// maxIncludeDepth limits how deeply files can include each other
+const maxIncludeDepth = 16
+
+// WithDefines sets names that are defined before the source is read,
+// like #define lines at the top of the file
+func WithDefines(defines map[string]string) Option {
+	return func(p *Parser) {
+		p.defines = defines
+	}
+}
+
+// WithIncludeDir sets the directory that #include reads files from in
+// the main input. Files included from an included file are read
+// relative to that file. The default is the current directory.
+func WithIncludeDir(dir string) Option {
+	return func(p *Parser) {
+		p.includeDir = dir
+	}
+}
+
+// preprocessor holds the state of a preprocessor run
+type preprocessor struct {
+	p       *Parser
+	defines map[string]string
+	out     []sourceLine
+	files   []string // Files being included, innermost last
+}
+
+// condition is an open #ifdef or #ifndef
+type condition struct {
+	source   sourceLine // The directive, for reporting
+	parent   bool       // Whether the lines around the block are kept
+	taken    bool       // Whether the condition was true
+	seenElse bool
+}
+
+// preprocess carries out the directives in lines and returns the lines
+// that remain, with defined names replaced
+func (p *Parser) preprocess(lines []sourceLine) []sourceLine {
+	pp := &preprocessor{p: p, defines: make(map[string]string)}
+	for name, value := range p.defines {
+		pp.defines[name] = value
+	}
+
+	dir := p.includeDir
+	if dir == "" {
+		dir = "."
+	}
+	pp.file(lines, dir)
+	return pp.out
+}
+
+// file preprocesses the lines of one file. Included files are read
+// relative to dir.
+func (pp *preprocessor) file(lines []sourceLine, dir string) {
+	var open []condition
+	active := true
+
+	for _, source := range lines {
+		directive, arg := splitDirective(source.text)
+
+		switch directive {
+		case "ifdef", "ifndef":
+			name, err := directiveName(directive, arg)
+			if err != nil {
+				pp.errorAt(source, err.Error())
+			}
+			_, defined := pp.defines[name]
+			taken := defined == (directive == "ifdef")
+			open = append(open, condition{source: source, parent: active, taken: taken})
+			active = active && taken
+
+		case "else":
+			if len(open) == 0 {
+				pp.errorAt(source, "#else without #ifdef or #ifndef")
+				continue
+			}
+			top := &open[len(open)-1]
+			if top.seenElse {
+				pp.errorAt(source, fmt.Sprintf("second #else for the #%s at %s", directiveOf(top.source), top.source.location()))
+				continue
+			}
+			top.seenElse = true
+			active = top.parent && !top.taken
+
+		case "endif":
+			if len(open) == 0 {
+				pp.errorAt(source, "#endif without #ifdef or #ifndef")
+				continue
+			}
+			active = open[len(open)-1].parent
+			open = open[:len(open)-1]
+
+		case "define":
+			if !active {
+				continue
+			}
+			name, value, _ := strings.Cut(arg, " ")
+			if _, err := directiveName(directive, name); err != nil {
+				pp.errorAt(source, err.Error())
+				continue
+			}
+			pp.defines[name] = pp.substitute(strings.TrimSpace(value))
+
+		case "undef":
+			if !active {
+				continue
+			}
+			name, err := directiveName(directive, arg)
+			if err != nil {
+				pp.errorAt(source, err.Error())
+				continue
+			}
+			delete(pp.defines, name)
+
+		case "include":
+			if active {
+				pp.include(source, arg, dir)
+			}
+
+		default:
+			if !active {
+				continue
+			}
+			if text := strings.TrimSpace(source.text); text != "" && !strings.HasPrefix(text, "#") {
+				source.text = pp.substitute(source.text)
+			}
+			pp.out = append(pp.out, source)
+		}
+	}
+
+	for _, c := range open {
+		pp.errorAt(c.source, fmt.Sprintf("#%s without #endif", directiveOf(c.source)))
+	}
+}
+
+// include reads a file named by an #include directive and preprocesses
+// its lines in place of the directive
+func (pp *preprocessor) include(source sourceLine, arg, dir string) {
+	if len(arg) < 2 || arg[0] != '"' || arg[len(arg)-1] != '"' {
+		pp.errorAt(source, "#include needs a file name in quotes")
+		return
+	}
+	path := filepath.Join(dir, arg[1:len(arg)-1])
+
+	for _, file := range pp.files {
+		if file == path {
+			pp.errorAt(source, fmt.Sprintf("%s includes itself", path))
+			return
+		}
+	}
+	if len(pp.files) >= maxIncludeDepth {
+		pp.errorAt(source, fmt.Sprintf("includes nested more than %d deep", maxIncludeDepth))
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		pp.errorAt(source, fmt.Sprintf("including file: %v", err))
+		return
+	}
+	lines, err := readLines(f, path)
+	f.Close()
+	if err != nil {
+		pp.errorAt(source, fmt.Sprintf("reading %s: %v", path, err))
+		return
+	}
+
+	if pp.p.dialect == Zmakebas {
+		lines = joinContinuations(lines)
+	}
+
+	pp.files = append(pp.files, path)
+	pp.file(lines, filepath.Dir(path))
+	pp.files = pp.files[:len(pp.files)-1]
+}
+
+// substitute replaces defined names in text, outside strings. The rest
+// of a line after REM, including {INCBIN} lines, is left as it is.
+func (pp *preprocessor) substitute(text string) string {
+	if len(pp.defines) == 0 {
+		return text
+	}
+
+	var out strings.Builder
+	inString := false
+	for pos := 0; pos < len(text); {
+		c := text[pos]
+		if c == '"' {
+			inString = !inString
+		}
+		if inString || !isWordStart(c) || (pos > 0 && (isWordChar(text[pos-1]) || text[pos-1] == '@')) {
+			out.WriteByte(c)
+			pos++
+			continue
+		}
+
+		end := pos + 1
+		for end < len(text) && isWordChar(text[end]) {
+			end++
+		}
+		word := text[pos:end]
+		if word == "REM" || pp.p.caseIndependent && strings.EqualFold(word, "REM") {
+			out.WriteString(text[pos:])
+			break
+		}
+		if value, ok := pp.defines[word]; ok && (end == len(text) || text[end] != '$') {
+			out.WriteString(value)
+		} else {
+			out.WriteString(word)
+		}
+		pos = end
+	}
+	return out.String()
+}
+
+// errorAt reports a preprocessor error for a source line
+func (pp *preprocessor) errorAt(source sourceLine, message string) {
+	pp.p.setSource(source)
+	pp.p.report(SeverityError, -1, CodePreprocessor, message)
+}
+
+// splitDirective returns the directive a line starts with, such as
+// "define", and its argument. It returns an empty directive for lines
+// that aren't directives, including comments.
+func splitDirective(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	word, arg, _ := strings.Cut(line[1:], " ")
+	switch word {
+	case "include", "define", "undef", "ifdef", "ifndef", "else", "endif":
+		return word, strings.TrimSpace(arg)
+	}
+	return "", ""
+}
+
+// directiveOf returns the directive of a line known to hold one
+func directiveOf(source sourceLine) string {
+	directive, _ := splitDirective(source.text)
+	return directive
+}
+
+// directiveName checks the name given to a directive
+func directiveName(directive, name string) (string, error) {
+	if name == "" || !isWordStart(name[0]) {
+		return "", fmt.Errorf("#%s needs a name", directive)
+	}
+	for i := 1; i < len(name); i++ {
+		if !isWordChar(name[i]) {
+			return "", fmt.Errorf("#%s: invalid name %q", directive, name)
+		}
+	}
+	return name, nil
+}
+
+// isWordStart reports whether c can start a defined name
+func isWordStart(c byte) bool {
+	return isAlpha(c) || c == '_'
+}
+
+// isWordChar reports whether c can appear in a defined name
+func isWordChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '_'
+}
+
+// location describes where a source line is, for messages
+func (s sourceLine) location() string {
+	if s.file == "" {
+		return fmt.Sprintf("line %d", s.line)
+	}
+	return fmt.Sprintf("%s line %d", s.file, s.line)
+}
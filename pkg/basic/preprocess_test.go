@@ -0,0 +1,165 @@
+package basic
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreprocess(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		defines map[string]string
+		want    string
+	}{
+		{
+			name:  "Define",
+			input: "#define SCREEN 16384\n#define TOP SCREEN+32\n10 POKE TOP,SCREENS: PRINT \"SCREEN\";SCREEN$ (0,0)\n",
+			want:  "10 POKE 16384+32,SCREENS: PRINT \"SCREEN\";SCREEN$(0,0)\n",
+		},
+		{
+			name:  "Undef",
+			input: "#define N 1\n10 PRINT N\n#undef N\n20 PRINT N\n",
+			want:  "10 PRINT 1\n20 PRINT N\n",
+		},
+		{
+			name:    "Ifdef taken",
+			input:   "#ifdef DEBUG\n10 PRINT \"debug\"\n#else\n10 CLS\n#endif\n20 STOP\n",
+			defines: map[string]string{"DEBUG": "1"},
+			want:    "10 PRINT \"debug\"\n20 STOP\n",
+		},
+		{
+			name:  "Ifdef not taken",
+			input: "#ifdef DEBUG\n10 PRINT \"debug\"\n#else\n10 CLS\n#endif\n20 STOP\n",
+			want:  "10 CLS\n20 STOP\n",
+		},
+		{
+			name:  "Nested",
+			input: "#ifndef M128\n#ifdef DEBUG\n10 PRINT 1\n#else\n10 PRINT 2\n#endif\n#else\n10 PLAY \"a\"\n#endif\n",
+			want:  "10 PRINT 2\n",
+		},
+		{
+			name:  "Define inside a dropped block",
+			input: "#ifdef X\n#define Y 1\n#endif\n#ifdef Y\n10 STOP\n#endif\n10 CLS\n",
+			want:  "10 CLS\n",
+		},
+		{
+			name:  "REM text is kept",
+			input: "#define N 1\n10 PRINT N: REM N is \"N\"\n",
+			want:  "10 PRINT 1: REM N is \"N\"\n",
+		},
+		{
+			name:  "Comments are kept as comments",
+			input: "# autostart 10\n#comment\n10 CLS\n",
+			want:  "10 CLS\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := NewParser(WithDefines(tt.defines)).Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := ListProgram(data)
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreprocessInclude(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	if err := os.Mkdir(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"lib/print.bas":   "#include \"colours.bas\"\n9000 INK COLOUR: PRINT \"x\"\n9010 RETURN\n",
+		"lib/colours.bas": "#define COLOUR 2\n",
+		"lib/bad.bas":     "9000 POKE 1\n",
+		"lib/loop.bas":    "#include \"loop.bas\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parser := NewParser(WithIncludeDir(dir))
+	program, err := parser.ParseProgram(strings.NewReader("10 GO SUB 9000\n#include \"lib/print.bas\"\n"))
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	data, _ := program.MarshalBinary()
+	got, _ := ListProgram(data)
+	if want := "10 GO SUB 9000\n9000 INK 2: PRINT \"x\"\n9010 RETURN\n"; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if line := program.Lines[2]; line.SourceFile != filepath.Join(lib, "print.bas") || line.SourceLine != 3 {
+		t.Errorf("line 9010 from %s:%d", line.SourceFile, line.SourceLine)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		file  string
+		line  int
+		code  string
+	}{
+		{name: "Error in included file", input: "10 CLS\n#include \"lib/bad.bas\"\n", file: filepath.Join(lib, "bad.bas"), line: 1, code: CodeSyntax},
+		{name: "Missing file", input: "10 CLS\n#include \"none.bas\"\n", line: 2, code: CodePreprocessor},
+		{name: "Recursive include", input: "#include \"lib/loop.bas\"\n", file: filepath.Join(lib, "loop.bas"), line: 1, code: CodePreprocessor},
+		{name: "No quotes", input: "#include lib/bad.bas\n", line: 1, code: CodePreprocessor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(WithIncludeDir(dir)).Parse(strings.NewReader(tt.input))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			d := diags[0]
+			if d.File != tt.file || d.Line != tt.line || d.Code != tt.code {
+				t.Errorf("got %v [%s], want %s line %d [%s]", d, d.Code, tt.file, tt.line, tt.code)
+			}
+		})
+	}
+}
+
+func TestPreprocessErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int
+	}{
+		{name: "Else without ifdef", input: "10 CLS\n#else\n", line: 2},
+		{name: "Endif without ifdef", input: "#endif\n", line: 1},
+		{name: "Missing endif", input: "#ifdef A\n10 CLS\n", line: 1},
+		{name: "Second else", input: "#ifdef A\n#else\n#else\n#endif\n", line: 3},
+		{name: "Define without name", input: "#define\n", line: 1},
+		{name: "Invalid name", input: "#ifdef A-B\n#endif\n", line: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser().Parse(strings.NewReader(tt.input))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			if d := diags[0]; d.Line != tt.line || d.Code != CodePreprocessor {
+				t.Errorf("got %v [%s], want line %d", d, d.Code, tt.line)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package basic
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Program is a tokenized BASIC program held as separate lines, so that
+// lines can be added, removed or changed before it is written out again
+type Program struct {
+	Lines []*Line
+
+	// Variables holds whatever follows the last line, normally the
+	// variables area of a saved program, exactly as it was stored
+	Variables []byte
+}
+
+// Line is one tokenized program line
+type Line struct {
+	Number int
+
+	// Body holds the bytes after the line length, normally ending with
+	// ENTER (0x0D). The stored length is always len(Body).
+	Body []byte
+
+	// Position in the source text, for lines made by ParseProgram.
+	// SourceFile is empty for the main input and names included files.
+	// SourceLine counts from 1 and is 0 for lines from anywhere else.
+	SourceFile   string
+	SourceLine   int
+	SourceOffset int
+}
+
+// Statement is one statement of a line, without the ':' or THEN that
+// separates it from the next
+type Statement struct {
+	Offset int    // Position in the line body
+	Data   []byte // Tokenized bytes, starting with the keyword
+}
+
+// Keyword returns the token that starts the statement, or 0 for an
+// empty statement. Spaces and colour control codes before it, which
+// the ROM skips, are passed over.
+func (s Statement) Keyword() byte {
+	if pos := keywordStart(s.Data); pos < len(s.Data) {
+		return s.Data[pos]
+	}
+	return 0
+}
+
+// keywordStart returns the offset of the keyword in a statement, after
+// any spaces and control codes with their parameters
+func keywordStart(data []byte) int {
+	pos := 0
+	for pos < len(data) {
+		switch b := data[pos]; {
+		case b == ' ':
+			pos++
+		case b >= 0x10 && b <= 0x15: // INK to OVER, one parameter
+			pos += 2
+		case b == 0x16 || b == 0x17: // AT and TAB, two parameters
+			pos += 3
+		default:
+			return pos
+		}
+	}
+	return len(data)
+}
+
+// NewLine returns a line with the given number and tokenized
+// statements, adding the final ENTER
+func NewLine(number int, statements []byte) *Line {
+	body := make([]byte, len(statements), len(statements)+1)
+	copy(body, statements)
+	return &Line{Number: number, Body: append(body, 0x0D)}
+}
+
+// Statements splits the line into its statements. Statements end at
+// ':' and after THEN, as the ROM counts them, and REM runs to the end
+// of the line.
+func (l *Line) Statements() []Statement {
+	body := bytes.TrimSuffix(l.Body, []byte{0x0D})
+
+	var statements []Statement
+	start := 0
+	inString := false
+	for pos := 0; pos < len(body); pos++ {
+		b := body[pos]
+		switch {
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == numberMarker:
+			pos += 5
+		case b >= 0x10 && b <= 0x15: // INK to OVER, one parameter
+			pos++
+		case b == 0x16 || b == 0x17: // AT and TAB, two parameters
+			pos += 2
+		case b == tokenRem:
+			pos = len(body)
+		case b == ':':
+			statements = append(statements, Statement{Offset: start, Data: body[start:pos]})
+			start = pos + 1
+		case b == tokenThen:
+			statements = append(statements, Statement{Offset: start, Data: body[start : pos+1]})
+			start = pos + 1
+		}
+	}
+	if start > len(body) {
+		start = len(body)
+	}
+	return append(statements, Statement{Offset: start, Data: body[start:]})
+}
+
+// MarshalBinary returns the line as stored in memory: the line number
+// (big-endian), the length and the body
+func (l *Line) MarshalBinary() ([]byte, error) {
+	if l.Number < 0 || l.Number > 0x3FFF {
+		return nil, fmt.Errorf("line number %d out of range", l.Number)
+	}
+	if len(l.Body) > 0xFFFF {
+		return nil, fmt.Errorf("line %d: body of %d bytes is too long", l.Number, len(l.Body))
+	}
+
+	data := make([]byte, 4, 4+len(l.Body))
+	data[0] = byte(l.Number >> 8)
+	data[1] = byte(l.Number)
+	data[2] = byte(len(l.Body))
+	data[3] = byte(len(l.Body) >> 8)
+	return append(data, l.Body...), nil
+}
+
+// MarshalBinary returns the program as stored in memory, with every line
+// length worked out again, followed by the variables area
+func (p *Program) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, line := range p.Lines {
+		data, err := line.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.Write(p.Variables)
+	return buf.Bytes(), nil
+}
+
+// VarsOffset returns where the variables area starts in the program's
+// binary form: the length of the lines, which SAVE stores as Param2
+func (p *Program) VarsOffset() int {
+	offset := 0
+	for _, line := range p.Lines {
+		offset += 4 + len(line.Body)
+	}
+	return offset
+}
+
+// UnmarshalBinary splits a tokenized program into lines. Reading stops
+// at the first line number above 16383, which marks the start of the
+// variables area; everything from there on is kept in Variables.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	p.Lines = nil
+	p.Variables = nil
+
+	for pos := 0; pos < len(data); {
+		if data[pos] > 0x3F {
+			p.Variables = append([]byte(nil), data[pos:]...)
+			break
+		}
+		if pos+4 > len(data) {
+			return fmt.Errorf("line header at offset %d is truncated", pos)
+		}
+
+		number := int(data[pos])<<8 | int(data[pos+1])
+		length := int(data[pos+2]) | int(data[pos+3])<<8
+		pos += 4
+		if pos+length > len(data) {
+			return fmt.Errorf("line %d: length %d runs past end of program", number, length)
+		}
+
+		body := append([]byte(nil), data[pos:pos+length]...)
+		p.Lines = append(p.Lines, &Line{Number: number, Body: body})
+		pos += length
+	}
+	return nil
+}
+
+// Line returns the line with the given number, or nil if there isn't one
+func (p *Program) Line(number int) *Line {
+	for _, line := range p.Lines {
+		if line.Number == number {
+			return line
+		}
+	}
+	return nil
+}
+
+// Insert adds a line in line number order. Like typing a line on the
+// Spectrum, it replaces any line with the same number.
+func (p *Program) Insert(line *Line) {
+	i := sort.Search(len(p.Lines), func(i int) bool {
+		return p.Lines[i].Number >= line.Number
+	})
+	if i < len(p.Lines) && p.Lines[i].Number == line.Number {
+		p.Lines[i] = line
+		return
+	}
+	p.Lines = append(p.Lines, nil)
+	copy(p.Lines[i+1:], p.Lines[i:])
+	p.Lines[i] = line
+}
+
+// Delete removes the line with the given number and reports whether
+// there was one
+func (p *Program) Delete(number int) bool {
+	for i, line := range p.Lines {
+		if line.Number == number {
+			p.Lines = append(p.Lines[:i], p.Lines[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package basic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProgramRoundTrip(t *testing.T) {
+	source := "10 REM loader\n20 PRINT \"a:b\";1: GO TO 10\n30 IF x THEN STOP\n"
+	data, err := NewParser().Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	// A variables area: a=1, then the end marker
+	data = append(data, 0x61, 0x00, 0x00, 0x01, 0x00, 0x00, 0x80)
+
+	var program Program
+	if err := program.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if len(program.Lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(program.Lines))
+	}
+	if !bytes.Equal(program.Variables, data[len(data)-7:]) {
+		t.Errorf("Variables = % X", program.Variables)
+	}
+
+	got, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("MarshalBinary() = % X, want % X", got, data)
+	}
+}
+
+func TestProgramEdit(t *testing.T) {
+	program, err := NewParser().ParseProgram(strings.NewReader("10 CLS\n20 STOP\n"))
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+
+	line, err := NewParser().ParseLine("15 PRINT \"inserted\"")
+	if err != nil {
+		t.Fatalf("ParseLine() error = %v", err)
+	}
+	program.Insert(line)
+	program.Insert(NewLine(20, []byte{0xFB})) // Replaces STOP with CLS
+	program.Insert(NewLine(5, []byte{0xFE}))
+	if !program.Delete(10) || program.Delete(10) {
+		t.Error("Delete() should remove line 10 once")
+	}
+
+	got, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	want, _ := NewParser().Parse(strings.NewReader("5 RETURN\n15 PRINT \"inserted\"\n20 CLS\n"))
+	if !bytes.Equal(got, want) {
+		t.Errorf("MarshalBinary() = % X, want % X", got, want)
+	}
+	if program.Line(15) != line || program.Line(10) != nil {
+		t.Error("Line() did not find the right lines")
+	}
+}
+
+func TestProgramSourcePositions(t *testing.T) {
+	program, err := NewParser().ParseProgram(strings.NewReader("# comment\n10 CLS\n\n20 STOP\n"))
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	for i, want := range []struct{ line, offset int }{{2, 10}, {4, 18}} {
+		got := program.Lines[i]
+		if got.SourceLine != want.line || got.SourceOffset != want.offset {
+			t.Errorf("line %d at %d:%d, want %d:%d", got.Number, got.SourceLine, got.SourceOffset, want.line, want.offset)
+		}
+	}
+}
+
+func TestLineStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"CLS", []string{"CLS"}},
+		{"CLS: STOP", []string{"CLS", " STOP"}},
+		{"PRINT \"a:b\": CLS", []string{"PRINT \"a:b\"", " CLS"}},
+		{"IF a THEN PRINT 1: STOP", []string{"IF a THEN", " PRINT 1", " STOP"}},
+		{"REM a: b", []string{"REM a: b"}},
+		{"CLS:", []string{"CLS", ""}},
+	}
+
+	lister := NewLister()
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			line, err := NewParser().ParseLine("10 " + tt.input)
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			statements := line.Statements()
+			if len(statements) != len(tt.want) {
+				t.Fatalf("got %d statements, want %d", len(statements), len(tt.want))
+			}
+			for i, s := range statements {
+				text, err := lister.ListLine(s.Data)
+				if err != nil {
+					t.Fatalf("ListLine() error = %v", err)
+				}
+				if text != strings.TrimSpace(tt.want[i]) {
+					t.Errorf("statement %d = %q, want %q", i, text, tt.want[i])
+				}
+				if !bytes.Equal(line.Body[s.Offset:s.Offset+len(s.Data)], s.Data) {
+					t.Errorf("statement %d offset %d does not match its data", i, s.Offset)
+				}
+			}
+		})
+	}
+}
+
+func TestProgramUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Truncated header", []byte{0x00, 0x0A, 0x02}},
+		{"Truncated body", []byte{0x00, 0x0A, 0x05, 0x00, 0xFB, 0x0D}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var program Program
+			if err := program.UnmarshalBinary(tt.data); err == nil {
+				t.Error("UnmarshalBinary() error = nil")
+			}
+		})
+	}
+}
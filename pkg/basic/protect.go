@@ -0,0 +1,199 @@
+package basic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Listing protection
+//
+// Program.Protect makes a tokenized program hard to list or edit, in
+// the ways commercial tapes did:
+//
+//   - Lines renumbered to 0 can't be brought down to be edited. GO TO
+//     can't reach them any more, so a line that is jumped to is refused.
+//     Nor can FOR, GO SUB or NEXT, which come back to a line by its
+//     number, be on them, except on the first line, where line 0 leads.
+//   - INK and PAPER codes of one colour at the start of each line make
+//     the listing invisible. The ROM skips them when running the line.
+//   - Numbers show other digits than the value stored after them, which
+//     is the one the ROM uses.
+//
+// As with Program.Optimize, the lines up to a REM holding machine code
+// are left as they are, so that the code doesn't move.
+
+// Token values for statements that come back to a line by its number
+const (
+	tokenFor   = 0xEB
+	tokenGoSub = 0xED
+	tokenNext  = 0xF3
+)
+
+// protector holds the settings for Program.Protect
+type protector struct {
+	zeroLines  []int
+	colour     int
+	invisible  bool
+	fakeDigits string
+	startLine  int
+	autostart  bool
+}
+
+// ProtectOption defines a listing protection option
+type ProtectOption func(*protector)
+
+// WithZeroLines renumbers the given lines to 0
+func WithZeroLines(lines ...int) ProtectOption {
+	return func(p *protector) {
+		p.zeroLines = append(p.zeroLines, lines...)
+	}
+}
+
+// WithInvisibleListing starts each line with INK and PAPER codes of the
+// given colour, from 0 to 7
+func WithInvisibleListing(colour int) ProtectOption {
+	return func(p *protector) {
+		p.invisible = true
+		p.colour = colour
+	}
+}
+
+// WithFakeDigits shows digits in place of the digits of every number,
+// as in GO TO 0 for a jump to line 100. BIN numbers are left alone.
+func WithFakeDigits(digits string) ProtectOption {
+	return func(p *protector) {
+		p.fakeDigits = digits
+	}
+}
+
+// WithStartLine gives the autostart line, which must not be renumbered
+// to 0 as the program could no longer start there
+func WithStartLine(line int) ProtectOption {
+	return func(p *protector) {
+		p.startLine = line
+		p.autostart = true
+	}
+}
+
+// Protection is the result of Program.Protect
+type Protection struct {
+	Warnings []Diagnostic // Jumps that could not be checked
+}
+
+// Protect applies listing protection, as described above. It fails
+// without changing anything if an option can't be applied.
+func (p *Program) Protect(options ...ProtectOption) (*Protection, error) {
+	pr := &protector{}
+	for _, opt := range options {
+		opt(pr)
+	}
+
+	result := &Protection{}
+	zeroed, err := pr.findZeroLines(p, result)
+	if err != nil {
+		return nil, err
+	}
+	var codes []byte
+	if pr.invisible {
+		if codes, err = invisibleCodes(pr.colour); err != nil {
+			return nil, err
+		}
+	}
+	if pr.fakeDigits != "" && strings.Trim(pr.fakeDigits, "0123456789") != "" {
+		return nil, fmt.Errorf("fake digits %q must be digits 0 to 9", pr.fakeDigits)
+	}
+
+	fixed := p.fixedLines()
+	for i, line := range p.Lines {
+		if i >= fixed {
+			if pr.fakeDigits != "" {
+				line.Body = fakeDigits(line.Body, pr.fakeDigits)
+			}
+			line.Body = append(codes[:len(codes):len(codes)], line.Body...)
+		}
+		if zeroed[line] {
+			line.Number = 0
+		}
+	}
+	return result, nil
+}
+
+// findZeroLines returns the lines to renumber to 0, checking that
+// nothing jumps to them
+func (pr *protector) findZeroLines(p *Program, result *Protection) (map[*Line]bool, error) {
+	zeroed := make(map[*Line]bool)
+	if len(pr.zeroLines) == 0 {
+		return zeroed, nil
+	}
+
+	targets, warnings := p.jumpTargets("so it might jump to a line renumbered to 0")
+	result.Warnings = append(result.Warnings, warnings...)
+	if pr.autostart {
+		targets = append(targets, pr.startLine)
+	}
+	jumpedTo := p.jumpedTo(targets)
+
+	for _, number := range pr.zeroLines {
+		line := p.Line(number)
+		if line == nil {
+			return nil, fmt.Errorf("no line %d to renumber to 0", number)
+		}
+		if jumpedTo[line] {
+			return nil, fmt.Errorf("line %d is jumped to, so it can't be renumbered to 0", number)
+		}
+		if k := comesBack(line); k != 0 && line != p.Lines[0] {
+			return nil, fmt.Errorf("line %d holds %s, so it can't be renumbered to 0", number, TokenMap[k].Text)
+		}
+		zeroed[line] = true
+	}
+	return zeroed, nil
+}
+
+// comesBack returns the first FOR, GO SUB or NEXT in line, whose line
+// number the ROM keeps to come back to, or 0 if there is none
+func comesBack(line *Line) byte {
+	for _, s := range line.Statements() {
+		switch k := s.Keyword(); k {
+		case tokenFor, tokenGoSub, tokenNext:
+			return k
+		}
+	}
+	return 0
+}
+
+// invisibleCodes returns INK and PAPER codes for colour
+func invisibleCodes(colour int) ([]byte, error) {
+	parser := NewParser()
+	var codes []byte
+	for _, cmd := range []string{"INK", "PAPER"} {
+		if err := parser.validateControlParam(cmd, colour, 0); err != nil {
+			return nil, err
+		}
+		b, err := parser.getControlBytes(cmd, []int{colour})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, b...)
+	}
+	return codes, nil
+}
+
+// fakeDigits returns body with the digits of each number outside
+// strings and REM replaced by digits
+func fakeDigits(body []byte, digits string) []byte {
+	out := make([]byte, 0, len(body))
+	done := 0
+	forEachCode(body, func(pos int) {
+		if body[pos] != numberMarker {
+			return
+		}
+		visible, binary := visibleNumber(body[:pos])
+		if visible == "" || binary {
+			return
+		}
+		out = append(out, body[done:pos-len(visible)]...)
+		out = append(out, digits...)
+		done = pos
+	})
+	return append(out, body[done:]...)
+}
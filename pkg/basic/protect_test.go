@@ -0,0 +1,198 @@
+package basic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProtect(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		options  []ProtectOption
+		want     string
+		warnings int
+	}{
+		{
+			name:    "Zero lines",
+			input:   "1 REM (C) 1984\n10 GO TO 20\n20 GO TO 10\n",
+			options: []ProtectOption{WithZeroLines(1)},
+			want:    "0 REM (C) 1984\n10 GO TO 20\n20 GO TO 10\n",
+		},
+		{
+			name:     "Computed target",
+			input:    "1 CLS\n10 GO TO a\n",
+			options:  []ProtectOption{WithZeroLines(1)},
+			want:     "0 CLS\n10 GO TO a\n",
+			warnings: 1,
+		},
+		{
+			name:    "Invisible listing",
+			input:   "10 PRINT \"x\"\n20 STOP\n",
+			options: []ProtectOption{WithInvisibleListing(7)},
+			want:    "10 {INK 7}{PAPER 7}PRINT \"x\"\n20 {INK 7}{PAPER 7}STOP\n",
+		},
+		{
+			name:    "Fake digits",
+			input:   "10 GO TO 100: PRINT \"1\";2.5;BIN 11: REM 7\n100 STOP\n",
+			options: []ProtectOption{WithFakeDigits("0")},
+			want:    "10 GO TO 0{=100}: PRINT \"1\";0{=2.5};BIN 11: REM 7\n100 STOP\n",
+		},
+		{
+			name:    "Machine code doesn't move",
+			input:   "1 REM {C9}\n10 LET a=1\n",
+			options: []ProtectOption{WithInvisibleListing(0), WithFakeDigits("9")},
+			want:    "1 REM {C9}\n10 {INK 0}{PAPER 0}LET a=9{=1}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := NewParser().ParseProgram(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ParseProgram() error = %v", err)
+			}
+			result, err := program.Protect(tt.options...)
+			if err != nil {
+				t.Fatalf("Protect() error = %v", err)
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("got %d warnings, want %d: %v", len(result.Warnings), tt.warnings, result.Warnings)
+			}
+
+			data, err := program.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() error = %v", err)
+			}
+			got, err := ListProgram(data, WithHiddenValues(true))
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Protect() gave\n%s\nwant\n%s", got, tt.want)
+			}
+
+			// The listing reads back to the same bytes
+			again, err := NewParser(WithFakeNumbers(true)).Parse(strings.NewReader(got))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if string(again) != string(data) {
+				t.Errorf("listing parses back to % X, want % X", again, data)
+			}
+		})
+	}
+}
+
+func TestProtectErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ProtectOption
+	}{
+		{name: "Jumped to", options: []ProtectOption{WithZeroLines(20)}},
+		{name: "Autostart line", options: []ProtectOption{WithZeroLines(10), WithStartLine(10)}},
+		{name: "No such line", options: []ProtectOption{WithZeroLines(15)}},
+		{name: "Colour", options: []ProtectOption{WithInvisibleListing(8)}},
+		{name: "Fake digits", options: []ProtectOption{WithFakeDigits("1e3")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := NewParser().ParseProgram(strings.NewReader("10 GO TO 20\n20 GO TO 10\n"))
+			if err != nil {
+				t.Fatalf("ParseProgram() error = %v", err)
+			}
+			before, _ := program.MarshalBinary()
+			options := append([]ProtectOption{WithFakeDigits("0")}, tt.options...)
+			if _, err := program.Protect(options...); err == nil {
+				t.Error("Protect() error = nil")
+			}
+			if after, _ := program.MarshalBinary(); string(after) != string(before) {
+				t.Error("Protect() changed the program after failing")
+			}
+		})
+	}
+}
+
+func TestProtectedProgram(t *testing.T) {
+	// The colour codes at the start of each line don't hide the keyword
+	// from renumbering and optimizing
+	protect := func(t *testing.T) *Program {
+		t.Helper()
+		program, err := NewParser().ParseProgram(strings.NewReader("10 GO TO 30\n20 PRINT 1\n30 PRINT 2: GO SUB 10\n"))
+		if err != nil {
+			t.Fatalf("ParseProgram() error = %v", err)
+		}
+		if _, err := program.Protect(WithInvisibleListing(7)); err != nil {
+			t.Fatalf("Protect() error = %v", err)
+		}
+		return program
+	}
+	list := func(t *testing.T, program *Program) string {
+		t.Helper()
+		data, err := program.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() error = %v", err)
+		}
+		got, err := ListProgram(data)
+		if err != nil {
+			t.Fatalf("ListProgram() error = %v", err)
+		}
+		return got
+	}
+
+	t.Run("Renumber", func(t *testing.T) {
+		program := protect(t)
+		result, err := program.Renumber(100, 10)
+		if err != nil {
+			t.Fatalf("Renumber() error = %v", err)
+		}
+		if len(result.Warnings) != 0 {
+			t.Errorf("Renumber() warnings = %v", result.Warnings)
+		}
+		want := "100 {INK 7}{PAPER 7}GO TO 120\n110 {INK 7}{PAPER 7}PRINT 1\n120 {INK 7}{PAPER 7}PRINT 2: GO SUB 100\n"
+		if got := list(t, program); got != want {
+			t.Errorf("Renumber() gave\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("Optimize", func(t *testing.T) {
+		program := protect(t)
+		if _, err := program.Optimize(); err != nil {
+			t.Fatalf("Optimize() error = %v", err)
+		}
+		want := "10 {INK 7}{PAPER 7}GO TO 30: {INK 7}{PAPER 7}PRINT SGN PI\n30 {INK 7}{PAPER 7}PRINT VAL \"2\": GO SUB 10\n"
+		if got := list(t, program); got != want {
+			t.Errorf("Optimize() gave\n%s\nwant\n%s", got, want)
+		}
+	})
+}
+
+func TestZeroLinesComingBack(t *testing.T) {
+	input := "10 CLS\n20 FOR i=1 TO 2: PRINT i\n30 NEXT i\n40 GO SUB 100\n50 STOP\n100 RETURN\n"
+	tests := []struct {
+		name    string
+		input   string
+		lines   []int
+		wantErr bool
+	}{
+		{name: "FOR and GO SUB", input: "10 CLS\n20 FOR i=1 TO 2: NEXT i\n30 GO SUB 100\n100 RETURN\n", lines: []int{20, 30}, wantErr: true},
+		{name: "FOR", input: input, lines: []int{20}, wantErr: true},
+		{name: "NEXT", input: input, lines: []int{30}, wantErr: true},
+		{name: "GO SUB", input: input, lines: []int{40}, wantErr: true},
+		{name: "Other lines", input: input, lines: []int{10, 50}},
+		{name: "First line", input: "1 FOR i=1 TO 2: GO SUB 100: NEXT i\n100 RETURN\n", lines: []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := NewParser().ParseProgram(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ParseProgram() error = %v", err)
+			}
+			if _, err := program.Protect(WithZeroLines(tt.lines...)); (err != nil) != tt.wantErr {
+				t.Errorf("Protect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package basic
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Machine code in REM lines
+//
+// In a REM statement, {INCBIN "file.bin"} is replaced by the bytes of
+// the file, exactly as they are. When the sequence comes first, the
+// code starts straight after the REM token, so in line 1 it runs with
+// RANDOMIZE USR (PEEK 23635+256*PEEK 23636+5).
+
+// ProgStart is the address of the first program line when nothing such
+// as Interface 1 or a disk system moves it (the default value of PROG)
+const ProgStart = 23755
+
+// EmbeddedCode records where the bytes of a file were placed by
+// {INCBIN "file"}
+type EmbeddedCode struct {
+	File   string
+	Line   int // Number of the line holding the code
+	Offset int // Position in the line body
+	Length int
+}
+
+// EmbeddedCode returns the files placed in REM lines by the last parse,
+// in program order
+func (p *Parser) EmbeddedCode() []EmbeddedCode {
+	return p.embedded
+}
+
+// remCodeStart returns where machine code in a REM starts: after the
+// spaces following the REM token when {INCBIN comes next, so that the
+// code is at the address after the token, or else at pos
+func (p *Parser) remCodeStart(text string, pos int) int {
+	rest := strings.TrimLeft(text[pos:], " ")
+	if p.dialect == Standard && p.hasKeywordPrefix(rest, "{INCBIN ") {
+		return len(text) - len(rest)
+	}
+	return pos
+}
+
+// incbin writes the bytes of the file named by an {INCBIN "file"}
+// sequence at the start of text. It returns the length of the sequence,
+// or 0 if text doesn't start with one.
+func (p *Parser) incbin(text string, out *bytes.Buffer, base int) (int, error) {
+	if p.dialect != Standard || !p.hasKeywordPrefix(text, "{INCBIN ") {
+		return 0, nil
+	}
+	arg := strings.TrimLeft(text[len("{INCBIN "):], " ")
+	end := strings.Index(arg, "\"}")
+	if !strings.HasPrefix(arg, "\"") || end < 1 {
+		return 0, fmt.Errorf("{INCBIN} needs a file name in quotes")
+	}
+	name := arg[1:end]
+
+	dir := p.includeDir
+	if p.fileName != "" {
+		dir = filepath.Dir(p.fileName)
+	}
+	path := filepath.Join(dir, name)
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("including machine code: %w", err)
+	}
+
+	p.lineCode = append(p.lineCode, EmbeddedCode{File: path, Offset: out.Len() - base, Length: len(code)})
+	out.Write(code)
+	return len(text) - len(arg) + end + 2, nil
+}
+
+// Address returns the address that a byte of a line's body is loaded at,
+// given the program starts at ProgStart
+func (p *Program) Address(number, offset int) (int, error) {
+	address := ProgStart
+	for _, line := range p.Lines {
+		if line.Number == number {
+			return address + 4 + offset, nil
+		}
+		address += 4 + len(line.Body)
+	}
+	return 0, fmt.Errorf("no line %d", number)
+}
@@ -0,0 +1,99 @@
+package basic
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncbin(t *testing.T) {
+	dir := t.TempDir()
+	code := []byte{0x3E, 0x02, 0x0D, 0x0E, '"', ':', 0xC9} // Bytes that mean something in BASIC
+	if err := os.WriteFile(filepath.Join(dir, "code.bin"), code, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := "1 REM {INCBIN \"code.bin\"}\n2 REM loader {INCBIN \"code.bin\"} end\n10 RANDOMIZE USR (PEEK 23635+256*PEEK 23636+5)\n"
+	parser := NewParser(WithIncludeDir(dir))
+	program, err := parser.ParseProgram(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+
+	want := append(append([]byte{tokenRem}, code...), 0x0D)
+	if got := program.Lines[0].Body; !bytes.Equal(got, want) {
+		t.Errorf("line 1 = % X, want % X", got, want)
+	}
+	want = append(append([]byte{tokenRem, ' ', 'l', 'o', 'a', 'd', 'e', 'r', ' '}, code...), ' ', 'e', 'n', 'd', 0x0D)
+	if got := program.Lines[1].Body; !bytes.Equal(got, want) {
+		t.Errorf("line 2 = % X, want % X", got, want)
+	}
+
+	// Parsing a line to add doesn't lose the code of the program
+	if _, err := parser.ParseLine("5 PRINT 1"); err != nil {
+		t.Fatalf("ParseLine() error = %v", err)
+	}
+
+	embedded := parser.EmbeddedCode()
+	if len(embedded) != 2 {
+		t.Fatalf("EmbeddedCode() = %v, want two blocks", embedded)
+	}
+	first := EmbeddedCode{File: filepath.Join(dir, "code.bin"), Line: 1, Offset: 1, Length: len(code)}
+	if embedded[0] != first {
+		t.Errorf("EmbeddedCode()[0] = %+v, want %+v", embedded[0], first)
+	}
+	address, err := program.Address(embedded[0].Line, embedded[0].Offset)
+	if err != nil || address != ProgStart+5 {
+		t.Errorf("Address() = %d, %v, want %d", address, err, ProgStart+5)
+	}
+	address, _ = program.Address(embedded[1].Line, embedded[1].Offset)
+	if want := ProgStart + 4 + len(program.Lines[0].Body) + 4 + 9; address != want {
+		t.Errorf("second block at %d, want %d", address, want)
+	}
+
+	// The listing rebuilds the same program
+	data, _ := program.MarshalBinary()
+	listing, err := ListProgram(data)
+	if err != nil {
+		t.Fatalf("ListProgram() error = %v", err)
+	}
+	rebuilt, err := NewParser().Parse(strings.NewReader(listing))
+	if err != nil {
+		t.Fatalf("Parse() error = %v\n%s", err, listing)
+	}
+	if !bytes.Equal(rebuilt, data) {
+		t.Errorf("listing rebuilds a different program:\n%s", listing)
+	}
+}
+
+func TestIncbinErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Missing file", input: "1 REM {INCBIN \"none.bin\"}\n"},
+		{name: "No quotes", input: "1 REM {INCBIN none.bin}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(WithIncludeDir(t.TempDir())).Parse(strings.NewReader(tt.input))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			if d := diags[0]; d.Column != 7 || d.Code != CodeSequence {
+				t.Errorf("got %v [%s], want column 7", d, d.Code)
+			}
+		})
+	}
+
+	// Outside REM the sequence is plain text
+	if _, err := NewParser().Parse(strings.NewReader("1 PRINT \"{INCBIN \"\"x\"\"}\"\n")); err != nil {
+		t.Errorf("Parse() error = %v", err)
+	}
+}
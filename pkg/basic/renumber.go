@@ -0,0 +1,372 @@
+package basic
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Renumbering
+//
+// Program.Renumber gives lines new numbers and rewrites the line numbers
+// used by GO TO, GO SUB, RESTORE, RUN, LIST, LLIST and SAVE ... LINE.
+// Only literal numbers can be rewritten; anything else is reported.
+
+// CodeComputedTarget is the diagnostic code for a line reference that
+// Renumber could not rewrite
+const CodeComputedTarget = "computed-target"
+
+// Tokens whose operand is a line number
+var lineTargets = map[byte]bool{
+	0xEC: true, // GO TO
+	0xED: true, // GO SUB
+	0xE5: true, // RESTORE
+	0xF7: true, // RUN
+	0xF0: true, // LIST
+	0xE1: true, // LLIST
+}
+
+// renumberer holds the settings for Program.Renumber
+type renumberer struct {
+	from, to int
+}
+
+// RenumberOption defines a renumbering option
+type RenumberOption func(*renumberer)
+
+// WithLineRange limits renumbering to the lines numbered from to to,
+// inclusive. References to them from anywhere in the program are still
+// rewritten.
+func WithLineRange(from, to int) RenumberOption {
+	return func(r *renumberer) {
+		r.from = from
+		r.to = to
+	}
+}
+
+// Renumbering is the result of Program.Renumber
+type Renumbering struct {
+	Warnings []Diagnostic // References that could not be rewritten
+
+	old, new []int // Line numbers before and after, in program order
+}
+
+// Target returns the new line number for a reference to line, such as
+// the autostart line of a tape header. A reference to a line that does
+// not exist goes to the next line, as GO TO does.
+func (r *Renumbering) Target(line int) int {
+	i := sort.SearchInts(r.old, line)
+	if i == len(r.old) {
+		return line
+	}
+	return r.new[i]
+}
+
+// Renumber numbers the program lines from start in steps of step, and
+// rewrites the line numbers that refer to them. It fails without
+// changing anything if the new numbers would go above 9999 or reorder
+// the lines.
+func (p *Program) Renumber(start, step int, options ...RenumberOption) (*Renumbering, error) {
+	r := &renumberer{from: 0, to: 0x3FFF}
+	for _, opt := range options {
+		opt(r)
+	}
+
+	if start < 0 || start > 9999 {
+		return nil, fmt.Errorf("start line must be between 0 and 9999")
+	}
+	if step < 1 {
+		return nil, fmt.Errorf("step must be at least 1")
+	}
+	if r.from > r.to {
+		return nil, fmt.Errorf("line range %d-%d is empty", r.from, r.to)
+	}
+
+	result := &Renumbering{}
+	next := start
+	for _, line := range p.Lines {
+		result.old = append(result.old, line.Number)
+		if line.Number < r.from || line.Number > r.to {
+			result.new = append(result.new, line.Number)
+			continue
+		}
+
+		if next > 9999 {
+			return nil, fmt.Errorf("renumbering would need line numbers above 9999")
+		}
+		result.new = append(result.new, next)
+		next += step
+	}
+	for i := 1; i < len(result.new); i++ {
+		if result.new[i] <= result.new[i-1] && result.old[i] > result.old[i-1] {
+			return nil, fmt.Errorf("renumbered lines would overlap line %d", result.old[i])
+		}
+	}
+
+	for i, line := range p.Lines {
+		line.Number = result.new[i]
+		line.Body = result.rewriteTargets(line)
+	}
+	return result, nil
+}
+
+// rewriteTargets returns the body of line with its line references
+// changed to the new numbers
+func (r *Renumbering) rewriteTargets(line *Line) []byte {
+	body := line.Body
+	out := make([]byte, 0, len(body))
+	done := 0
+
+	for _, s := range line.Statements() {
+		keyword := s.Keyword()
+
+		var operands []int // Offsets in s.Data of line number operands
+		switch {
+		case lineTargets[keyword]:
+			operands = append(operands, keywordEnd(s.Data))
+		case keyword == tokenSave:
+			if pos := findToken(s.Data, tokenLine); pos >= 0 {
+				operands = append(operands, pos+1)
+			}
+		}
+
+		for _, pos := range operands {
+			start, end, value, ok := literalTarget(s.Data, pos)
+			if start == end {
+				continue // No operand, as in RUN
+			}
+			if !ok {
+				r.Warnings = append(r.Warnings, Diagnostic{
+					Severity: SeverityWarning,
+					Line:     line.SourceLine,
+					Code:     CodeComputedTarget,
+					Message: fmt.Sprintf("line %d: %s target is not a line number and was not renumbered",
+						line.Number, TokenMap[s.Data[pos-1]].Text),
+				})
+				continue
+			}
+
+			target := r.Target(value)
+			if target == value {
+				continue
+			}
+			encoded, _, err := NewParser().parseNumber(strconv.Itoa(target))
+			if err != nil {
+				continue
+			}
+			out = append(out, body[done:s.Offset+start]...)
+			out = append(out, encoded...)
+			done = s.Offset + end
+		}
+	}
+	return append(out, body[done:]...)
+}
+
+// keywordEnd returns the offset just after the keyword of a statement
+func keywordEnd(data []byte) int {
+	return min(keywordStart(data)+1, len(data))
+}
+
+// findToken returns the offset of token in a statement, outside strings,
+// numbers and control codes, or -1
+func findToken(data []byte, token byte) int {
+	inString := false
+	for pos := 0; pos < len(data); pos++ {
+		switch b := data[pos]; {
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == numberMarker:
+			pos += 5
+		case b >= 0x10 && b <= 0x15:
+			pos++
+		case b == 0x16 || b == 0x17:
+			pos += 2
+		case b == token:
+			return pos
+		}
+	}
+	return -1
+}
+
+// literalTarget looks for a line number at pos that runs to the end of
+// the statement. It returns where the operand starts and ends, and
+// whether it is a literal whole number. start equals end when the
+// statement has no operand.
+func literalTarget(data []byte, pos int) (start, end, value int, ok bool) {
+	for pos < len(data) && data[pos] == ' ' {
+		pos++
+	}
+	start, end = pos, len(data)
+	for end > start && data[end-1] == ' ' {
+		end--
+	}
+	if start == end {
+		return start, end, 0, false
+	}
+
+	if !isDigit(data[pos]) && data[pos] != '.' && data[pos] != numberMarker {
+		return start, end, 0, false
+	}
+	for pos < end && data[pos] != numberMarker && isNumberChar(data[pos]) {
+		pos++
+	}
+	if pos+6 != end || data[pos] != numberMarker {
+		return start, end, 0, false
+	}
+
+	number, err := DecodeNumber(data[pos+1 : pos+6])
+	if err != nil || number != float64(int(number)) || number < 0 || number > 9999 {
+		return start, end, 0, false
+	}
+	return start, end, int(number), true
+}
+
+// RenumberSource renumbers a program in source form. Only the line
+// numbers at the start of lines and the line numbers they are referred
+// to by change; comments, spacing and everything else are kept byte for
+// byte. Source whose lines don't each make one program line, because of
+// preprocessor directives, labels or structured blocks, is refused.
+func RenumberSource(source []byte, start, step int, options ...RenumberOption) ([]byte, *Renumbering, error) {
+	lines := strings.SplitAfter(string(source), "\n")
+	for i, text := range lines {
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			if directive, _ := splitDirective(trimmed); directive != "" {
+				return nil, nil, fmt.Errorf("line %d: source with #%s can't be renumbered", i+1, directive)
+			}
+		case !isDigit(trimmed[0]):
+			return nil, nil, fmt.Errorf("line %d has no line number; source with labels or structured blocks can't be renumbered", i+1)
+		}
+	}
+
+	program, err := NewParser(WithFakeNumbers(true)).ParseProgram(bytes.NewReader(source))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing BASIC: %w", err)
+	}
+	before := make([][]byte, len(program.Lines))
+	for i, line := range program.Lines {
+		before[i] = line.Body
+	}
+	result, err := program.Renumber(start, step, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, line := range program.Lines {
+		index := line.SourceLine - 1
+		text, err := renumberSourceLine(lines[index], line.Number, before[i], line.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line.SourceLine, err)
+		}
+		lines[index] = text
+	}
+	return []byte(strings.Join(lines, "")), result, nil
+}
+
+// bodyNumber is a number stored in a line, with the digits shown for it
+type bodyNumber struct {
+	digits string
+	value  string // The 5 bytes stored after the number marker
+}
+
+// renumberSourceLine gives the source text of a line its new number,
+// and replaces the numbers that differ between the old and new bodies
+func renumberSourceLine(text string, number int, old, new []byte) (string, error) {
+	lead := len(text) - len(strings.TrimLeft(text, " \t"))
+	end := lead
+	for end < len(text) && isDigit(text[end]) {
+		end++
+	}
+	head := text[:lead] + strconv.Itoa(number)
+	rest := text[end:]
+	if bytes.Equal(old, new) {
+		return head + rest, nil
+	}
+
+	oldNumbers, newNumbers := bodyNumbers(old), bodyNumbers(new)
+	if len(oldNumbers) != len(newNumbers) {
+		return "", fmt.Errorf("numbers in the line changed unexpectedly")
+	}
+	var out strings.Builder
+	out.WriteString(head)
+	pos := 0
+	for i, n := range oldNumbers {
+		start, stop, ok := findSourceNumber(rest, pos, n.digits)
+		if !ok {
+			return "", fmt.Errorf("can't find the number %q in the source text", n.digits)
+		}
+		if n == newNumbers[i] {
+			out.WriteString(rest[pos:stop])
+		} else {
+			out.WriteString(rest[pos:start])
+			out.WriteString(newNumbers[i].digits)
+		}
+		pos = stop
+	}
+	out.WriteString(rest[pos:])
+	return out.String(), nil
+}
+
+// bodyNumbers returns the numbers in a line body outside strings and
+// REM, leaving out the places DEF FN keeps for its parameters
+func bodyNumbers(body []byte) []bodyNumber {
+	var numbers []bodyNumber
+	forEachCode(body, func(pos int) {
+		if body[pos] != numberMarker || pos+6 > len(body) {
+			return
+		}
+		digits, _ := visibleNumber(body[:pos])
+		if digits == "" && pos > 0 && (isAlpha(body[pos-1]) || body[pos-1] == '$') {
+			return
+		}
+		numbers = append(numbers, bodyNumber{digits: digits, value: string(body[pos+1 : pos+6])})
+	})
+	return numbers
+}
+
+// findSourceNumber finds the next number in source text from pos with
+// the given digits, or a {=value} on its own when digits is empty. It
+// returns where the number starts and ends, taking in any {=value}
+// after the digits. Strings and {...} sequences are skipped, as are
+// digits that are part of a name.
+func findSourceNumber(text string, pos int, digits string) (int, int, bool) {
+	inString := false
+	for i := pos; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			if digits == "" && strings.HasPrefix(text[i:], "{=") {
+				return i, sequenceEnd(text, i), true
+			}
+			i = sequenceEnd(text, i) - 1
+		case digits != "" && strings.HasPrefix(text[i:], digits):
+			end := i + len(digits)
+			before := i > 0 && (isAlpha(text[i-1]) || isDigit(text[i-1]) || strings.IndexByte(".$", text[i-1]) >= 0)
+			after := end < len(text) && (isDigit(text[end]) || text[end] == '.')
+			if before || after {
+				continue
+			}
+			if strings.HasPrefix(text[end:], "{=") {
+				end = sequenceEnd(text, end)
+			}
+			return i, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// sequenceEnd returns the offset just after the {...} sequence starting
+// at pos, or the end of text if it isn't closed
+func sequenceEnd(text string, pos int) int {
+	if end := strings.IndexByte(text[pos:], '}'); end >= 0 {
+		return pos + end + 1
+	}
+	return len(text)
+}
@@ -0,0 +1,207 @@
+package basic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenumber(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		start, step int
+		options     []RenumberOption
+		want        string
+		warnings    int
+	}{
+		{
+			name:  "Simple",
+			input: "1 GO TO 3\n2 GO SUB 1\n3 RUN 2: LIST 1: LLIST 3\n",
+			start: 10, step: 10,
+			want: "10 GO TO 30\n20 GO SUB 10\n30 RUN 20: LIST 10: LLIST 30\n",
+		},
+		{
+			name:  "RESTORE and SAVE LINE",
+			input: "5 RESTORE 7\n7 DATA 1\n9 SAVE \"x\" LINE 5\n",
+			start: 100, step: 5,
+			want: "100 RESTORE 105\n105 DATA 1\n110 SAVE \"x\" LINE 100\n",
+		},
+		{
+			name:  "Missing target goes to the next line",
+			input: "10 GO TO 15\n20 STOP\n",
+			start: 1, step: 1,
+			want: "1 GO TO 2\n2 STOP\n",
+		},
+		{
+			name:  "Target past the end is kept",
+			input: "10 GO TO 9000\n",
+			start: 100, step: 10,
+			want: "100 GO TO 9000\n",
+		},
+		{
+			name:  "After THEN",
+			input: "10 IF a THEN GO TO 20\n20 RUN\n",
+			start: 1, step: 1,
+			want: "1 IF a THEN GO TO 2\n2 RUN\n",
+		},
+		{
+			name:  "Strings and other numbers are left alone",
+			input: "10 PRINT \"GO TO 10\";10: GO TO 10\n",
+			start: 50, step: 10,
+			want: "50 PRINT \"GO TO 10\";10: GO TO 50\n",
+		},
+		{
+			name:  "Computed targets",
+			input: "10 GO TO a\n20 GO SUB 10*b: RESTORE 20+1\n",
+			start: 100, step: 10,
+			want:     "100 GO TO a\n110 GO SUB 10*b: RESTORE 20+1\n",
+			warnings: 3,
+		},
+		{
+			name:  "Line range",
+			input: "10 GO TO 30\n20 GO TO 10\n30 GO TO 20\n40 GO TO 30\n",
+			start: 21, step: 1,
+			options: []RenumberOption{WithLineRange(20, 30)},
+			want:    "10 GO TO 22\n21 GO TO 10\n22 GO TO 21\n40 GO TO 22\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := NewParser().ParseProgram(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ParseProgram() error = %v", err)
+			}
+			result, err := program.Renumber(tt.start, tt.step, tt.options...)
+			if err != nil {
+				t.Fatalf("Renumber() error = %v", err)
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("got %d warnings, want %d: %v", len(result.Warnings), tt.warnings, result.Warnings)
+			}
+
+			data, err := program.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() error = %v", err)
+			}
+			got, err := ListProgram(data)
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Renumber() gave\n%s\nwant\n%s", got, tt.want)
+			}
+
+			// The digits and the hidden values must agree, so the listing
+			// parses back to the same bytes
+			again, err := NewParser().Parse(strings.NewReader(got))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if string(again) != string(data) {
+				t.Errorf("hidden values do not match the digits")
+			}
+		})
+	}
+}
+
+func TestRenumberErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, step int
+		options     []RenumberOption
+	}{
+		{name: "Above 9999", start: 9990, step: 10},
+		{name: "Overlaps following line", start: 25, step: 10, options: []RenumberOption{WithLineRange(10, 20)}},
+		{name: "Overlaps previous line", start: 5, step: 1, options: []RenumberOption{WithLineRange(20, 30)}},
+		{name: "Zero step", start: 10, step: 0},
+		{name: "Empty range", start: 10, step: 10, options: []RenumberOption{WithLineRange(30, 20)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := NewParser().ParseProgram(strings.NewReader("10 CLS\n20 CLS\n30 CLS\n"))
+			if err != nil {
+				t.Fatalf("ParseProgram() error = %v", err)
+			}
+			if _, err := program.Renumber(tt.start, tt.step, tt.options...); err == nil {
+				t.Error("Renumber() error = nil")
+			}
+			if program.Lines[0].Number != 10 || program.Lines[2].Number != 30 {
+				t.Error("Renumber() changed the program after failing")
+			}
+		})
+	}
+}
+
+func TestRenumberingTarget(t *testing.T) {
+	program, _ := NewParser().ParseProgram(strings.NewReader("10 CLS\n20 CLS\n"))
+	result, err := program.Renumber(100, 100)
+	if err != nil {
+		t.Fatalf("Renumber() error = %v", err)
+	}
+	for _, tt := range []struct{ old, want int }{{0, 100}, {10, 100}, {15, 200}, {20, 200}, {21, 21}} {
+		if got := result.Target(tt.old); got != tt.want {
+			t.Errorf("Target(%d) = %d, want %d", tt.old, got, tt.want)
+		}
+	}
+}
+
+func TestRenumberSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		start, step int
+		want        string
+	}{
+		{
+			name:  "Comments and spacing are kept",
+			input: "# Main loop\n\n  1 GO TO   3 : REM GO TO 1\n2 GOSUB 1\n# The end\n3 PRINT \"GO TO 1\";1,x1: RUN 2\n",
+			start: 10, step: 10,
+			want: "# Main loop\n\n  10 GO TO   30 : REM GO TO 1\n20 GOSUB 10\n# The end\n30 PRINT \"GO TO 1\";1,x1: RUN 20\n",
+		},
+		{
+			name:  "Fake numbers",
+			input: "5 GO TO 7{=6}\n6 GO SUB 5{=5}: PRINT 0{=1}\n7 DEF FN f(x)=x: GO TO {=5}\n",
+			start: 100, step: 100,
+			want: "100 GO TO 200\n200 GO SUB 100: PRINT 0{=1}\n300 DEF FN f(x)=x: GO TO 100\n",
+		},
+		{
+			name:  "Numbers the same as a target",
+			input: "1 PRINT 2: GO TO 2\n2 STOP\r\n",
+			start: 1, step: 1,
+			want: "1 PRINT 2: GO TO 2\n2 STOP\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := RenumberSource([]byte(tt.input), tt.start, tt.step)
+			if err != nil {
+				t.Fatalf("RenumberSource() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RenumberSource() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenumberSourceRefused(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Directives", input: "#define SPEED 5\n10 PAUSE SPEED\n#ifdef DEBUG\n20 PRINT \"debug\"\n#endif\n"},
+		{name: "Labels", input: "@loop:\nGO TO @loop\n"},
+		{name: "Structured blocks", input: "10 IF a THEN\n20 PRINT 1\nEND IF\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _, err := RenumberSource([]byte(tt.input), 10, 10); err == nil {
+				t.Errorf("RenumberSource() = %q, want an error", got)
+			}
+		})
+	}
+}
@@ -15,6 +15,12 @@ type SequenceMatch struct {
 // expandSequence tries to expand special sequences like {AT}, {INK}, etc.
 // Returns nil if no sequence was found at the current position.
 func (p *Parser) expandSequence(text string, stripSpaces bool) (*SequenceMatch, error) {
+	if match, err := p.unicodeCharacter(text); match != nil || err != nil {
+		return match, err
+	}
+	if p.dialect == Zmakebas {
+		return p.zmakebasEscape(text)
+	}
 	if !strings.HasPrefix(text, "{") {
 		return nil, nil
 	}
@@ -23,7 +29,7 @@ func (p *Parser) expandSequence(text string, stripSpaces bool) (*SequenceMatch,
 	end := strings.IndexByte(text, '}')
 	if end == -1 {
 		if len(text) > 10 { // Only warn if it's not just the start of a longer sequence
-			return nil, fmt.Errorf("line %d: unclosed sequence", p.lineCount)
+			return nil, fmt.Errorf("unclosed sequence")
 		}
 		return nil, nil
 	}
@@ -109,7 +115,7 @@ func (p *Parser) tryUDG(seq string, end int) (*SequenceMatch, error) {
 		case -1: // unknown
 			p.is48K = 1 // mark as 48K
 		case 0: // already marked as 128K
-			return nil, fmt.Errorf("line %d: UDG '%c' not available in 128K mode", p.lineCount, udg)
+			return nil, fmt.Errorf("UDG '%c' not available in 128K mode", udg)
 		}
 	}
 
@@ -140,15 +146,10 @@ func (p *Parser) tryBlockGraphics(seq string, end int) (*SequenceMatch, error) {
 		return nil, nil
 	}
 
-	var value byte
-	if prefix == 0x88 {
-		value = byte((n % 8) ^ 7)
-	} else {
-		value = byte(n % 8)
-	}
-
+	// {-1} to {-8} are 0x80 to 0x87, {+1} to {+8} are 0x88 to 0x8F,
+	// matching the names in TokenMap
 	return &SequenceMatch{
-		Bytes:  []byte{prefix + value},
+		Bytes:  []byte{prefix + byte(n-1)},
 		Length: end + 1,
 	}, nil
 }
@@ -192,7 +193,7 @@ func (p *Parser) tryControlSequence(seq string, end int) (*SequenceMatch, error)
 			}
 			// Validate individual parameter
 			if err := p.validateControlParam(cmd, n, len(params)); err != nil {
-				return nil, fmt.Errorf("line %d: %w", p.lineCount, err)
+				return nil, err
 			}
 			params = append(params, n)
 			p.currentParams = append(p.currentParams, n)
@@ -202,7 +203,7 @@ func (p *Parser) tryControlSequence(seq string, end int) (*SequenceMatch, error)
 	// Get control sequence bytes
 	result, err := p.getControlBytes(cmd, params)
 	if err != nil {
-		return nil, fmt.Errorf("line %d: %w", p.lineCount, err)
+		return nil, err
 	}
 	if result == nil {
 		return nil, nil
@@ -10,6 +10,7 @@ func TestExpandSequence(t *testing.T) {
 		name        string
 		input       string
 		stripSpaces bool
+		inPrint     bool
 		want        []byte
 		wantLength  int
 		wantErr     bool
@@ -54,6 +55,7 @@ func TestExpandSequence(t *testing.T) {
 			name:        "AT with spaces",
 			input:       "{AT 10 20}  ",
 			stripSpaces: true,
+			inPrint:     true,
 			want:        []byte{0x16, 10, 20},
 			wantLength:  12,
 		},
@@ -68,18 +70,22 @@ func TestExpandSequence(t *testing.T) {
 			wantErr: true,
 		},
 		{
+			// Only a brace with more than 10 characters after it is
+			// reported, so that a lone { in a string stays as it is
 			name:    "Unclosed sequence",
-			input:   "{UNCLOSED",
+			input:   "{UNCLOSED SEQUENCE",
 			wantErr: true,
 		},
+		{
+			name:  "Short unclosed brace",
+			input: "{x\"",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := NewParser()
-			if tt.input == "{AT 0 0}" {
-				p.inPrint = true
-			}
+			p.inPrint = tt.inPrint
 
 			got, err := p.expandSequence(tt.input, tt.stripSpaces)
 
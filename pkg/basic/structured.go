@@ -0,0 +1,441 @@
+package basic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Structured mode
+//
+// With WithStructured, source lines may use these blocks, each keyword
+// on a line of its own:
+//
+//	WHILE cond ... WEND
+//	REPEAT ... UNTIL cond
+//	IF cond THEN ... ELSE ... END IF
+//	DEF PROC name ... ENDPROC
+//
+// and PROC name anywhere a statement can go to call a procedure. Before
+// the lines are numbered, the blocks are lowered to plain BASIC using
+// labels, so
+//
+//	WHILE a<10
+//	  LET a=a+1
+//	WEND
+//
+// becomes
+//
+//	@_1: IF NOT (a<10) THEN GO TO @_2
+//	  LET a=a+1
+//	  GO TO @_1
+//	@_2:
+//
+// Labels starting with _ are kept for these generated lines. Each line
+// made by lowering remembers which parts of its text came from the
+// source line, so errors are reported at the original text.
+
+// WithStructured turns structured mode on or off. Structured source has
+// no line numbers, so it also turns on labels mode, numbering from 10
+// in steps of 10 unless WithLabels is given too.
+func WithStructured(v bool) Option {
+	return func(p *Parser) {
+		p.structured = v
+	}
+}
+
+// Kinds of block
+const (
+	blockWhile  = "WHILE"
+	blockRepeat = "REPEAT"
+	blockIf     = "IF"
+	blockProc   = "DEF PROC"
+)
+
+// block is a structured block that hasn't been closed yet
+type block struct {
+	kind       string
+	source     sourceLine // The line that opened the block
+	start, end string     // Labels for the top and the bottom of the block
+	orElse     string     // Label for the ELSE part of an IF
+	seenElse   bool
+}
+
+// lowering holds the state of lowering structured blocks
+type lowering struct {
+	p      *Parser
+	out    []sourceLine
+	blocks []block // Open blocks, innermost last
+	labels int     // Number of labels generated so far
+}
+
+// origin maps positions in a line made by lowering back to the source
+// line it was made from
+type origin struct {
+	spans   []span // Parts of the text copied from the source line
+	keyword int    // Source position reported for generated text
+}
+
+// span is a part of a generated line copied from the source line
+type span struct {
+	at     int // Position in the generated line
+	length int
+	source int // Position in the source line
+}
+
+// position returns the position in the source line for a position in
+// the generated line
+func (o *origin) position(pos int) int {
+	for _, s := range o.spans {
+		if pos >= s.at && pos <= s.at+s.length {
+			return s.source + pos - s.at
+		}
+	}
+	return o.keyword
+}
+
+// lineBuilder makes a generated line from a source line
+type lineBuilder struct {
+	source sourceLine
+	text   strings.Builder
+	origin origin
+}
+
+// newLineBuilder starts a line generated from source, reporting errors
+// in generated text at keyword
+func newLineBuilder(source sourceLine, keyword int) *lineBuilder {
+	return &lineBuilder{source: source, origin: origin{keyword: keyword}}
+}
+
+// add appends generated text
+func (b *lineBuilder) add(text string) *lineBuilder {
+	b.text.WriteString(text)
+	return b
+}
+
+// copy appends the source text between from and to
+func (b *lineBuilder) copy(from, to int) *lineBuilder {
+	b.origin.spans = append(b.origin.spans, span{at: b.text.Len(), length: to - from, source: from})
+	b.text.WriteString(b.source.text[from:to])
+	return b
+}
+
+// line returns the generated line
+func (b *lineBuilder) line() sourceLine {
+	line := b.source
+	line.text = b.text.String()
+	o := b.origin
+	line.origin = &o
+	return line
+}
+
+// lower replaces the structured blocks in lines with plain BASIC using
+// generated labels
+func (p *Parser) lower(lines []sourceLine) []sourceLine {
+	l := &lowering{p: p}
+	for _, source := range lines {
+		l.line(source)
+	}
+
+	for i := len(l.blocks) - 1; i >= 0; i-- {
+		b := l.blocks[i]
+		l.errorAt(b.source, -1, fmt.Sprintf("%s without %s", b.kind, closerOf(b.kind)))
+		l.closeBlock(b, b.source)
+	}
+	return l.out
+}
+
+// closerOf returns the keyword that ends a kind of block
+func closerOf(kind string) string {
+	switch kind {
+	case blockWhile:
+		return "WEND"
+	case blockRepeat:
+		return "UNTIL"
+	case blockIf:
+		return "END IF"
+	}
+	return "ENDPROC"
+}
+
+// line lowers one source line
+func (l *lowering) line(source sourceLine) {
+	text := source.text
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		l.out = append(l.out, source)
+		return
+	}
+
+	// Statements start after any label
+	start := len(text) - len(strings.TrimLeft(text, " \t"))
+	pos := start
+	if label, _, err := splitLabel(trimmed); err == nil && label != "" {
+		pos = start + 2 + len(label)
+		for pos < len(text) && text[pos] == ' ' {
+			pos++
+		}
+	}
+
+	kind, arg, argEnd := l.keyword(text, pos)
+	if kind == "" {
+		if line, ok := l.calls(source); ok {
+			l.out = append(l.out, line)
+		}
+		return
+	}
+	if pos > start {
+		// The label names the first line the block turns into
+		l.out = append(l.out, newLineBuilder(source, start).copy(start, start+strings.Index(text[start:], ":")+1).line())
+	}
+
+	switch kind {
+	case "REPEAT", "ELSE", "WEND", "END IF", "ENDPROC":
+		if arg != argEnd {
+			l.errorAt(source, arg, fmt.Sprintf("%s must be on a line of its own", kind))
+			return
+		}
+	}
+
+	switch kind {
+	case "WHILE":
+		if arg == argEnd {
+			l.errorAt(source, pos, "WHILE needs a condition")
+			return
+		}
+		b := block{kind: blockWhile, source: source, start: l.newLabel(), end: l.newLabel()}
+		l.blocks = append(l.blocks, b)
+		l.out = append(l.out, newLineBuilder(source, pos).
+			add("@"+b.start+": IF NOT (").copy(arg, argEnd).add(") THEN GO TO @"+b.end).line())
+
+	case "REPEAT":
+		b := block{kind: blockRepeat, source: source, start: l.newLabel()}
+		l.blocks = append(l.blocks, b)
+		l.labelLine(source, pos, b.start)
+
+	case "IF":
+		b := block{kind: blockIf, source: source, orElse: l.newLabel(), end: l.newLabel()}
+		l.blocks = append(l.blocks, b)
+		l.out = append(l.out, newLineBuilder(source, pos).
+			add("IF NOT (").copy(arg, argEnd).add(") THEN GO TO @"+b.orElse).line())
+
+	case "ELSE":
+		b := l.top(blockIf)
+		if b == nil {
+			l.errorAt(source, pos, "ELSE without IF ... THEN")
+			return
+		}
+		if b.seenElse {
+			l.errorAt(source, pos, fmt.Sprintf("second ELSE for the IF at %s", b.source.location()))
+			return
+		}
+		b.seenElse = true
+		l.out = append(l.out, newLineBuilder(source, pos).add("GO TO @"+b.end).line())
+		l.labelLine(source, pos, b.orElse)
+
+	case "DEF PROC":
+		name := text[arg:argEnd]
+		if name == "" || labelLength(name) != len(name) {
+			l.errorAt(source, arg, "DEF PROC needs a name")
+			return
+		}
+		if len(l.blocks) > 0 {
+			l.errorAt(source, pos, fmt.Sprintf("DEF PROC inside the %s at %s", l.blocks[len(l.blocks)-1].kind,
+				l.blocks[len(l.blocks)-1].source.location()))
+			return
+		}
+		b := block{kind: blockProc, source: source, start: name, end: l.newLabel()}
+		l.blocks = append(l.blocks, b)
+		l.out = append(l.out, newLineBuilder(source, pos).add("GO TO @"+b.end).line())
+		l.out = append(l.out, newLineBuilder(source, pos).add("@").copy(arg, argEnd).add(":").line())
+
+	default: // WEND, UNTIL, END IF and ENDPROC
+		opener := map[string]string{"WEND": blockWhile, "UNTIL": blockRepeat, "END IF": blockIf, "ENDPROC": blockProc}[kind]
+		b := l.top(opener)
+		if b == nil && len(l.blocks) > 0 {
+			inner := l.blocks[len(l.blocks)-1]
+			l.errorAt(source, pos, fmt.Sprintf("%s before the %s that ends the %s at %s",
+				kind, closerOf(inner.kind), inner.kind, inner.source.location()))
+			return
+		}
+		if b == nil {
+			l.errorAt(source, pos, fmt.Sprintf("%s without %s", kind, opener))
+			return
+		}
+		if kind == "UNTIL" {
+			if arg == argEnd {
+				l.errorAt(source, pos, "UNTIL needs a condition")
+				return
+			}
+			l.out = append(l.out, newLineBuilder(source, pos).
+				add("IF NOT (").copy(arg, argEnd).add(") THEN GO TO @"+b.start).line())
+		}
+		l.blocks = l.blocks[:len(l.blocks)-1]
+		l.closeBlock(*b, source)
+	}
+}
+
+// closeBlock adds the lines that end a block, made from source
+func (l *lowering) closeBlock(b block, source sourceLine) {
+	pos := len(source.text) - len(strings.TrimLeft(source.text, " \t"))
+	switch b.kind {
+	case blockWhile:
+		l.out = append(l.out, newLineBuilder(source, pos).add("GO TO @"+b.start).line())
+		l.labelLine(source, pos, b.end)
+	case blockIf:
+		if !b.seenElse {
+			l.labelLine(source, pos, b.orElse)
+		}
+		l.labelLine(source, pos, b.end)
+	case blockProc:
+		l.out = append(l.out, newLineBuilder(source, pos).add("RETURN").line())
+		l.labelLine(source, pos, b.end)
+	}
+}
+
+// top returns the innermost open block if it is of the given kind
+func (l *lowering) top(kind string) *block {
+	if len(l.blocks) == 0 || l.blocks[len(l.blocks)-1].kind != kind {
+		return nil
+	}
+	return &l.blocks[len(l.blocks)-1]
+}
+
+// newLabel returns the name of a new generated label
+func (l *lowering) newLabel() string {
+	l.labels++
+	return "_" + strconv.Itoa(l.labels)
+}
+
+// labelLine adds a line holding just a generated label, which names the
+// line that follows
+func (l *lowering) labelLine(source sourceLine, pos int, label string) {
+	l.out = append(l.out, newLineBuilder(source, pos).add("@"+label+":").line())
+}
+
+// keyword returns the block keyword that text starts with at pos, and
+// where its argument starts and ends. It returns an empty keyword for
+// ordinary lines.
+func (l *lowering) keyword(text string, pos int) (string, int, int) {
+	end := len(strings.TrimRight(text, " \t"))
+
+	if next, ok := l.word(text, pos, "END"); ok {
+		if next, ok := l.word(text, next, "IF"); ok {
+			return "END IF", next, end
+		}
+		return "", 0, 0
+	}
+	for _, kind := range []string{"ENDIF", "ENDPROC", "WEND", "ELSE", "WHILE", "REPEAT", "UNTIL"} {
+		if next, ok := l.word(text, pos, kind); ok {
+			if kind == "ENDIF" {
+				kind = "END IF"
+			}
+			return kind, next, end
+		}
+	}
+	if next, ok := l.word(text, pos, "DEF"); ok {
+		if next, ok := l.word(text, next, "PROC"); ok {
+			return "DEF PROC", next, end
+		}
+		return "", 0, 0
+	}
+	// IF cond THEN with nothing after THEN opens a block, when it is the
+	// first statement and not the end of a single-line IF
+	if next, ok := l.word(text, pos, "IF"); ok && end-4 > next {
+		then := end - 4
+		if _, ok := l.word(text, then, "THEN"); ok && !isWordChar(text[then-1]) && l.condition(text[next:then]) {
+			return "IF", next, len(strings.TrimRight(text[:then], " "))
+		}
+	}
+	return "", 0, 0
+}
+
+// condition reports whether text between IF and THEN is a condition
+// alone, with no ':' or THEN outside strings
+func (l *lowering) condition(text string) bool {
+	inString := false
+	for pos := 0; pos < len(text); pos++ {
+		switch c := text[pos]; {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == ':':
+			return false
+		case pos == 0 || !isWordChar(text[pos-1]):
+			if _, ok := l.word(text, pos, "THEN"); ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// word reports whether text has the keyword word at pos, not followed
+// by another letter, and returns the position after it and any spaces
+func (l *lowering) word(text string, pos int, word string) (int, bool) {
+	if pos+len(word) > len(text) {
+		return 0, false
+	}
+	found := text[pos : pos+len(word)]
+	if found != word && !(l.p.caseIndependent && strings.EqualFold(found, word)) {
+		return 0, false
+	}
+	next := pos + len(word)
+	if next < len(text) && isWordChar(text[next]) {
+		return 0, false
+	}
+	for next < len(text) && text[next] == ' ' {
+		next++
+	}
+	return next, true
+}
+
+// calls replaces PROC name with GO SUB @name, outside strings and REM.
+// It returns false if a call has no name.
+func (l *lowering) calls(source sourceLine) (sourceLine, bool) {
+	text := source.text
+	var b *lineBuilder
+	copied := 0 // Source text before this has been added to b
+
+	inString := false
+	for pos := 0; pos < len(text); pos++ {
+		c := text[pos]
+		if c == '"' {
+			inString = !inString
+		}
+		if inString || !isWordStart(c) || (pos > 0 && isWordChar(text[pos-1])) {
+			continue
+		}
+		if _, ok := l.word(text, pos, "REM"); ok {
+			break
+		}
+		next, ok := l.word(text, pos, "PROC")
+		if !ok {
+			continue
+		}
+
+		length := labelLength(text[next:])
+		if length == 0 {
+			l.errorAt(source, next, "PROC needs a name")
+			return source, false
+		}
+		if b == nil {
+			b = newLineBuilder(source, pos)
+		}
+		b.origin.keyword = pos
+		b.copy(copied, pos).add("GO SUB @").copy(next, next+length)
+		copied = next + length
+		pos = copied - 1
+	}
+
+	if b == nil {
+		return source, true
+	}
+	return b.copy(copied, len(text)).line(), true
+}
+
+// errorAt reports a structure error at pos in a source line
+func (l *lowering) errorAt(source sourceLine, pos int, message string) {
+	l.p.setSource(source)
+	l.p.report(SeverityError, pos, CodeStructure, message)
+}
@@ -0,0 +1,121 @@
+package basic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStructured(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "While",
+			input: "LET a=0\nWHILE a<3 AND INKEY$=\"\"\n  LET a=a+1\nWEND\nPRINT a\n",
+			want:  "10 LET a=0\n20 IF NOT (a<3 AND INKEY$=\"\") THEN GO TO 50\n30 LET a=a+1\n40 GO TO 20\n50 PRINT a\n",
+		},
+		{
+			name:  "Repeat",
+			input: "REPEAT\n  LET a=a+1\nUNTIL a>=10\n",
+			want:  "10 LET a=a+1\n20 IF NOT (a>=10) THEN GO TO 10\n",
+		},
+		{
+			name:  "If else",
+			input: "IF a THEN\n  PRINT 1\nELSE\n  PRINT 2\nEND IF\nSTOP\n",
+			want:  "10 IF NOT (a) THEN GO TO 40\n20 PRINT 1\n30 GO TO 50\n40 PRINT 2\n50 STOP\n",
+		},
+		{
+			name:  "If without else",
+			input: "IF a THEN\n  PRINT 1\nENDIF\nIF b THEN PRINT 2\n",
+			want:  "10 IF NOT (a) THEN GO TO 30\n20 PRINT 1\n30 IF b THEN PRINT 2\n",
+		},
+		{
+			name:  "Single-line IF ending in THEN",
+			input: "IF a THEN PRINT 1: IF b THEN\nIF a THEN IF b THEN\nSTOP\n",
+			want:  "10 IF a THEN PRINT 1: IF b THEN\n20 IF a THEN IF b THEN\n30 STOP\n",
+		},
+		{
+			name:  "Procedure",
+			input: "PROC hello: PRINT \"PROC hello\": REM PROC x\nSTOP\nDEF PROC hello\n  PRINT \"hello\"\nENDPROC\n",
+			want:  "10 GO SUB 40: PRINT \"PROC hello\": REM PROC x\n20 STOP\n30 GO TO 60\n40 PRINT \"hello\"\n50 RETURN\n",
+		},
+		{
+			name:  "Nested with labels",
+			input: "@top: WHILE 1\n  REPEAT\n  UNTIL INKEY$<>\"\"\n  IF INKEY$=\"q\" THEN\n    STOP\n  END IF\nWEND\nGO TO @top\n",
+			want:  "10 IF NOT (1) THEN GO TO 60\n20 IF NOT (INKEY$<>\"\") THEN GO TO 20\n30 IF NOT (INKEY$=\"q\") THEN GO TO 50\n40 STOP\n50 GO TO 10\n60 GO TO 10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := NewParser(WithStructured(true)).Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := ListProgram(data)
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructuredErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		line   int
+		column int
+		code   string
+	}{
+		{name: "Wend without while", input: "CLS\nWEND\n", line: 2, column: 1, code: CodeStructure},
+		{name: "Missing wend", input: "CLS\n WHILE a\n", line: 2, code: CodeStructure},
+		{name: "Crossed blocks", input: "IF a THEN\nUNTIL a\nEND IF\n", line: 2, column: 1, code: CodeStructure},
+		{name: "Second else", input: "IF a THEN\nELSE\nELSE\nEND IF\n", line: 3, column: 1, code: CodeStructure},
+		{name: "Else with statements", input: "IF a THEN\nELSE PRINT\nEND IF\n", line: 2, column: 6, code: CodeStructure},
+		{name: "Procedure in a block", input: "WHILE a\nDEF PROC x\nWEND\n", line: 2, column: 1, code: CodeStructure},
+		{name: "Call without name", input: "PROC 1\n", line: 1, column: 6, code: CodeStructure},
+		{name: "Error in condition", input: "CLS\n  WHILE a$+1\nWEND\n", line: 2, column: 11, code: CodeSyntax},
+		{name: "Error after a call", input: "PROC x: POKE 1\nDEF PROC x\nENDPROC\n", line: 1, column: 15, code: CodeSyntax},
+		{name: "Undefined procedure", input: "CLS: PROC nowhere\n", line: 1, column: 6, code: CodeLabel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(WithStructured(true)).Parse(strings.NewReader(tt.input))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			d := diags[0]
+			if d.Line != tt.line || d.Column != tt.column || d.Code != tt.code {
+				t.Errorf("got %v [%s], want line %d:%d [%s]", d, d.Code, tt.line, tt.column, tt.code)
+			}
+		})
+	}
+}
+
+func TestStructuredSourceLines(t *testing.T) {
+	program, err := NewParser(WithStructured(true)).ParseProgram(strings.NewReader("CLS\nWHILE 1\n  BEEP 1,0\nWEND\n"))
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+
+	// Generated lines point at the line they were made from
+	want := []int{1, 2, 3, 4}
+	if len(program.Lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(program.Lines), len(want))
+	}
+	for i, line := range program.Lines {
+		if line.SourceLine != want[i] {
+			t.Errorf("line %d from source line %d, want %d", line.Number, line.SourceLine, want[i])
+		}
+	}
+}
@@ -0,0 +1,879 @@
+package basic
+
+import "fmt"
+
+// Statement syntax checking
+//
+// Once a line has been tokenized, every statement is checked against the
+// class sequence of its keyword in TokenMap, following the ROM's own
+// syntax checker. Expressions are parsed into Expr trees and the type of
+// every operand is checked, so LEN 5 and LET a$=1 are errors.
+
+// syntaxChecker walks the tokenized body of a single line
+type syntaxChecker struct {
+	data []byte
+	pos  int
+}
+
+// syntaxError is a syntax error at a byte offset in the tokenized line
+type syntaxError struct {
+	pos int
+	msg string
+}
+
+func (e *syntaxError) Error() string {
+	return e.msg
+}
+
+// Token values used by the checker
+const (
+	tokenLine   = 0xCA
+	tokenThen   = 0xCB
+	tokenTo     = 0xCC
+	tokenStep   = 0xCD
+	tokenDefFn  = 0xCE
+	tokenCircle = 0xD8
+	tokenLList  = 0xE1
+	tokenDim    = 0xE9
+	tokenDraw   = 0xFC
+	tokenRem    = 0xEA
+	tokenInput  = 0xEE
+	tokenList   = 0xF0
+	tokenSave   = 0xF8
+)
+
+// checkSyntax checks every statement in the body of a tokenized line,
+// which excludes the line number, length and final ENTER
+func checkSyntax(body []byte) error {
+	c := &syntaxChecker{data: body}
+
+	for {
+		then, err := c.statement()
+		if err != nil {
+			return err
+		}
+		if then {
+			// A new statement follows THEN directly
+			continue
+		}
+
+		c.skip()
+		if c.atEnd() {
+			return nil
+		}
+		if c.peek() != ':' {
+			return c.errorf("unexpected %s at end of statement", c.describe())
+		}
+		c.pos++
+	}
+}
+
+// statement checks one statement. It reports whether the statement
+// ended with THEN, in which case another statement follows.
+func (c *syntaxChecker) statement() (bool, error) {
+	c.skip()
+	if c.endOfStatement() {
+		return false, nil // Empty statement
+	}
+
+	keyword := c.peek()
+	if keyword < 0xA3 || (TokenMap[keyword].Type != TokenKeyword && TokenMap[keyword].Type != TokenColour) {
+		return false, c.errorf("statement must start with a keyword, found %s", c.describe())
+	}
+	c.pos++
+
+	switch keyword {
+	case tokenRem:
+		// The rest of the line is a comment
+		c.pos = len(c.data)
+		return false, nil
+	case tokenDefFn:
+		return false, c.defFn()
+	}
+
+	return c.classes(keyword, TokenMap[keyword].KeywordClass)
+}
+
+// classes checks the operands of a statement against its keyword's class
+// sequence. It reports whether the sequence ended with THEN.
+func (c *syntaxChecker) classes(keyword byte, classes KeywordClass) (bool, error) {
+	target := NumericType // Type of the variable LET assigns to
+
+	for i, class := range classes {
+		var err error
+
+		switch class {
+		case ClassNone:
+			return false, nil
+		case ClassLet:
+			// A name followed by '(' in the sequence is an array or
+			// function name, which is a single letter
+			single := i+1 < len(classes) && classes[i+1] == '('
+			var v *Variable
+			if v, err = c.variable(single, !single); err == nil {
+				target = v.Type()
+			}
+		case ClassLetExpr:
+			_, err = c.typed(target)
+		case ClassNumExpr, ClassColour:
+			_, err = c.typed(NumericType)
+		case ClassStrExpr:
+			_, err = c.typed(StringType)
+		case ClassExprOpt:
+			if keyword == tokenList || keyword == tokenLList {
+				err = c.listStream()
+			}
+			if err == nil && !c.endOfStatement() {
+				_, err = c.typed(NumericType)
+			}
+		case ClassVarChar:
+			err = c.controlVariable()
+		case ClassItems:
+			err = c.printItems(keyword)
+		case ClassTwoNum:
+			_, err = c.numbers(2)
+		case ClassTwoNumCol:
+			if err = c.colourItems(); err == nil {
+				_, err = c.numbers(2)
+			}
+		case ClassTape:
+			err = c.tape(keyword)
+		case ClassStrList:
+			err = c.list(func() error {
+				_, err := c.typed(StringType)
+				return err
+			})
+		case ClassExprList:
+			// DIM takes the sizes of an array, DATA items of either type
+			err = c.list(func() error {
+				var err error
+				if keyword == tokenDim {
+					_, err = c.typed(NumericType)
+				} else {
+					_, err = c.expression()
+				}
+				return err
+			})
+		case ClassVarList:
+			err = c.list(func() error {
+				_, err := c.variable(false, true)
+				return err
+			})
+		case tokenStep:
+			// STEP is optional
+			c.skip()
+			if c.peek() != tokenStep {
+				return false, nil
+			}
+			c.pos++
+		case ',':
+			// The angle of DRAW is optional, the radius of CIRCLE is not
+			c.skip()
+			if keyword == tokenDraw && c.endOfStatement() {
+				return false, nil
+			}
+			err = c.expect(',')
+		case tokenThen:
+			return true, c.expect(tokenThen)
+		default:
+			err = c.expect(class)
+		}
+
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// expression parses a numeric or string expression
+func (c *syntaxChecker) expression() (Expr, error) {
+	return c.binary(0)
+}
+
+// typed parses an expression that must be of type want
+func (c *syntaxChecker) typed(want ExprType) (Expr, error) {
+	c.skip()
+	start := c.pos
+	expr, err := c.expression()
+	if err != nil {
+		return nil, err
+	}
+	if expr.Type() != want {
+		return nil, c.errorAt(start, "%s expression expected", want)
+	}
+	return expr, nil
+}
+
+// numbers parses count numeric expressions separated by commas
+func (c *syntaxChecker) numbers(count int) ([]Expr, error) {
+	var exprs []Expr
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			if err := c.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		expr, err := c.typed(NumericType)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+// list checks one or more items separated by commas
+func (c *syntaxChecker) list(item func() error) error {
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		c.skip()
+		if c.peek() != ',' {
+			return nil
+		}
+		c.pos++
+	}
+}
+
+// binary parses an operand followed by any operators that bind more
+// tightly than minPriority, with their operands
+func (c *syntaxChecker) binary(minPriority int) (Expr, error) {
+	left, err := c.operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		c.skip()
+		op := c.peek()
+		priority := binaryPriority(op)
+		if c.atEnd() || priority <= minPriority {
+			return left, nil
+		}
+		pos := c.pos
+		c.pos++
+		right, err := c.binary(priority)
+		if err != nil {
+			return nil, err
+		}
+
+		node := &Binary{Pos: pos, Op: op, Left: left, Right: right}
+		if msg := operandTypes(node); msg != "" {
+			return nil, c.errorAt(pos, "%s", msg)
+		}
+		left = node
+	}
+}
+
+// binaryPriority returns the ROM priority of a binary operator, or 0
+// if b is not one
+func binaryPriority(b byte) int {
+	switch b {
+	case 0xC5: // OR
+		return 2
+	case 0xC6: // AND
+		return 3
+	case '=', '<', '>', 0xC7, 0xC8, 0xC9: // Comparisons
+		return 5
+	case '+', '-':
+		return 6
+	case '*', '/':
+		return 8
+	case '^':
+		return 10
+	}
+	return 0
+}
+
+// operandTypes checks the operands of a binary operator the way the ROM
+// does and returns a message if they don't fit. '+' and the comparisons
+// take two numbers or two strings, AND takes a number or a string on its
+// left and a number on its right, and the rest take numbers.
+func operandTypes(n *Binary) string {
+	name := describeByte(n.Op)
+	left, right := n.Left.Type(), n.Right.Type()
+
+	switch {
+	case n.Op == '+' || binaryPriority(n.Op) == 5:
+		if left != right {
+			return fmt.Sprintf("%s needs two numbers or two strings", name)
+		}
+	case n.Op == 0xC6: // AND
+		if right != NumericType {
+			return "AND needs a numeric right operand"
+		}
+	default:
+		if left != NumericType || right != NumericType {
+			return fmt.Sprintf("%s needs numeric operands", name)
+		}
+	}
+	return ""
+}
+
+// operand parses a single operand, including any prefix operators
+func (c *syntaxChecker) operand() (Expr, error) {
+	c.skip()
+	if c.atEnd() {
+		return nil, c.errorf("expression expected")
+	}
+
+	pos := c.pos
+	b := c.peek()
+	switch {
+	case b == '+':
+		// The ROM ignores unary plus
+		c.pos++
+		return c.operand()
+	case b == '-':
+		c.pos++
+		return c.unary(pos, b, 9)
+	case b == 0xC3: // NOT
+		c.pos++
+		return c.unary(pos, b, 4)
+	case b == '(':
+		c.pos++
+		expr, err := c.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.expect(')'); err != nil {
+			return nil, err
+		}
+		return c.slice(pos, expr)
+	case b == '"':
+		str, err := c.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return c.slice(pos, str)
+	case b == numberMarker || isDigit(b) || b == '.':
+		return c.number(pos)
+	case b == 0xC4: // BIN
+		c.pos++
+		return c.number(pos)
+	case isAlpha(b):
+		return c.variable(false, true)
+	case b == 0xA5 || b == 0xA6 || b == 0xA7: // RND, INKEY$, PI
+		c.pos++
+		return &Function{Pos: pos, Token: b}, nil
+	case b == 0xA8: // FN
+		c.pos++
+		return c.fnCall(pos)
+	case b == 0xA9 || b == 0xAA || b == 0xAB: // POINT, SCREEN$, ATTR
+		c.pos++
+		if err := c.expect('('); err != nil {
+			return nil, err
+		}
+		args, err := c.numbers(2)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.expect(')'); err != nil {
+			return nil, err
+		}
+		return &Function{Pos: pos, Token: b, Args: args}, nil
+	case b >= 0xAE && b <= 0xC2: // Functions taking one operand
+		c.pos++
+		arg, err := c.binary(16)
+		if err != nil {
+			return nil, err
+		}
+		// USR takes the address of machine code or the letter of a UDG
+		want := argumentType(b)
+		if b != 0xC0 && arg.Type() != want {
+			return nil, c.errorAt(pos, "%s needs a %s operand", TokenMap[b].Text, want)
+		}
+		return &Function{Pos: pos, Token: b, Args: []Expr{arg}}, nil
+	}
+
+	return nil, c.errorf("expression expected, found %s", c.describe())
+}
+
+// unary parses the operand of '-' or NOT, which must be a number
+func (c *syntaxChecker) unary(pos int, op byte, priority int) (Expr, error) {
+	operand, err := c.binary(priority)
+	if err != nil {
+		return nil, err
+	}
+	if operand.Type() != NumericType {
+		return nil, c.errorAt(pos, "%s needs a numeric operand", describeByte(op))
+	}
+	return &Unary{Pos: pos, Op: op, Operand: operand}, nil
+}
+
+// argumentType returns the operand type of a function from its class
+func argumentType(token byte) ExprType {
+	if TokenMap[token].KeywordClass[0] == ClassStrExpr {
+		return StringType
+	}
+	return NumericType
+}
+
+// number parses a number: its digits, if any, and the hidden value
+func (c *syntaxChecker) number(pos int) (*Number, error) {
+	c.skip()
+	for !c.atEnd() && c.peek() != numberMarker && isNumberChar(c.peek()) {
+		c.pos++
+	}
+	if c.atEnd() || c.peek() != numberMarker {
+		return nil, c.errorf("number expected")
+	}
+	if c.pos+6 > len(c.data) {
+		return nil, c.errorf("number is truncated")
+	}
+	value, err := DecodeNumber(c.data[c.pos+1 : c.pos+6])
+	if err != nil {
+		return nil, c.errorf("%v", err)
+	}
+	c.pos += 6
+	return &Number{Pos: pos, Value: value}, nil
+}
+
+// isNumberChar reports whether b can appear in the digits of a number
+func isNumberChar(b byte) bool {
+	return isDigit(b) || b == '.' || b == 'e' || b == 'E' || b == '+' || b == '-'
+}
+
+// stringLiteral parses a string in quotes, where "" stands for a quote
+func (c *syntaxChecker) stringLiteral() (*String, error) {
+	start := c.pos
+	var value []byte
+	c.pos++
+	for {
+		for c.pos < len(c.data) && c.data[c.pos] != '"' {
+			value = append(value, c.data[c.pos])
+			c.pos++
+		}
+		if c.pos >= len(c.data) {
+			c.pos = start
+			return nil, c.errorf("unterminated string")
+		}
+		c.pos++
+		if c.pos >= len(c.data) || c.data[c.pos] != '"' {
+			return &String{Pos: start, Value: string(value)}, nil
+		}
+		value = append(value, '"')
+		c.pos++
+	}
+}
+
+// variable parses a variable name. Array and function names must be a
+// single letter; subscripts allows an index list or slicer to follow.
+func (c *syntaxChecker) variable(single, subscripts bool) (*Variable, error) {
+	c.skip()
+	if c.atEnd() || !isAlpha(c.peek()) {
+		return nil, c.errorf("variable expected, found %s", c.describe())
+	}
+
+	start := c.pos
+	c.pos++
+	for !c.atEnd() && (isAlpha(c.peek()) || isDigit(c.peek())) {
+		c.pos++
+	}
+	long := c.pos-start > 1
+
+	if !c.atEnd() && c.peek() == '$' {
+		if long {
+			c.pos = start
+			return nil, c.errorf("string variable name must be a single letter")
+		}
+		c.pos++
+	}
+	if single && long {
+		c.pos = start
+		return nil, c.errorf("array name must be a single letter")
+	}
+
+	v := &Variable{Pos: start, Name: string(c.data[start:c.pos])}
+	if !subscripts {
+		return v, nil
+	}
+	c.skip()
+	if c.peek() != '(' {
+		return v, nil
+	}
+	if long {
+		c.pos = start
+		return nil, c.errorf("array name must be a single letter")
+	}
+
+	var err error
+	v.Subscripts, err = c.subscripts(v.Type() == StringType)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// slice parses an optional slicer after a string literal or bracketed
+// expression, as in "text"( TO 3)
+func (c *syntaxChecker) slice(pos int, operand Expr) (Expr, error) {
+	c.skip()
+	if c.peek() != '(' {
+		return operand, nil
+	}
+	if operand.Type() != StringType {
+		return nil, c.errorf("only strings can be sliced")
+	}
+
+	open := c.pos
+	subscripts, err := c.subscripts(true)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscripts) != 1 {
+		return nil, c.errorAt(open, "a string takes a single slice")
+	}
+	return &Slice{Pos: pos, Operand: operand, Subscript: subscripts[0]}, nil
+}
+
+// subscripts parses a list of indexes or slices in brackets, as in
+// a(1,2) and a$(2 TO). Only strings can be sliced.
+func (c *syntaxChecker) subscripts(slices bool) ([]Subscript, error) {
+	if err := c.expect('('); err != nil {
+		return nil, err
+	}
+
+	var list []Subscript
+	for {
+		var sub Subscript
+		var err error
+
+		c.skip()
+		if c.peek() != tokenTo {
+			if sub.From, err = c.typed(NumericType); err != nil {
+				return nil, err
+			}
+			c.skip()
+		}
+		if c.peek() == tokenTo {
+			if !slices {
+				return nil, c.errorf("only strings can be sliced")
+			}
+			sub.Range = true
+			c.pos++
+			c.skip()
+			if c.peek() != ')' && c.peek() != ',' {
+				if sub.To, err = c.typed(NumericType); err != nil {
+					return nil, err
+				}
+			}
+		}
+		list = append(list, sub)
+
+		c.skip()
+		if c.peek() != ',' {
+			return list, c.expect(')')
+		}
+		c.pos++
+	}
+}
+
+// fnCall parses the name and arguments of a user defined function
+func (c *syntaxChecker) fnCall(pos int) (*FnCall, error) {
+	name, err := c.variable(true, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.expect('('); err != nil {
+		return nil, err
+	}
+
+	call := &FnCall{Pos: pos, Name: name.Name}
+	c.skip()
+	if c.peek() == ')' {
+		c.pos++
+		return call, nil
+	}
+	err = c.list(func() error {
+		arg, err := c.expression()
+		call.Args = append(call.Args, arg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call, c.expect(')')
+}
+
+// controlVariable checks the variable of FOR or NEXT, which is a single
+// letter numeric variable
+func (c *syntaxChecker) controlVariable() error {
+	c.skip()
+	if c.atEnd() || !isAlpha(c.peek()) {
+		return c.errorf("variable expected, found %s", c.describe())
+	}
+	c.pos++
+	if !c.atEnd() && (isAlpha(c.peek()) || isDigit(c.peek()) || c.peek() == '$') {
+		c.pos--
+		return c.errorf("control variable must be a single letter")
+	}
+	return nil
+}
+
+// printItems checks the items of PRINT, LPRINT and INPUT. Items are
+// separated by ';', ',' or "'", and colour items, AT and TAB may appear
+// among them.
+func (c *syntaxChecker) printItems(keyword byte) error {
+	needSeparator := false
+	for {
+		c.skip()
+		if c.endOfStatement() {
+			return nil
+		}
+
+		b := c.peek()
+		if b == ';' || b == ',' || b == '\'' {
+			c.pos++
+			needSeparator = false
+			continue
+		}
+		if needSeparator {
+			return c.errorf("';' or ',' expected before %s", c.describe())
+		}
+
+		var err error
+		switch {
+		case b == 0xAC: // AT
+			c.pos++
+			_, err = c.numbers(2)
+		case b == 0xAD, b >= 0xD9 && b <= 0xDE: // TAB and colour items
+			c.pos++
+			_, err = c.typed(NumericType)
+		case b == '#': // Stream
+			c.pos++
+			_, err = c.typed(NumericType)
+		case b == tokenLine && keyword == tokenInput:
+			c.pos++
+			var v *Variable
+			if v, err = c.variable(false, false); err == nil && v.Type() != StringType {
+				err = c.errorAt(v.Pos, "INPUT LINE needs a string variable")
+			}
+		default:
+			_, err = c.expression()
+		}
+		if err != nil {
+			return err
+		}
+		needSeparator = true
+	}
+}
+
+// listStream checks the optional stream of LIST and LLIST, as in
+// LIST #3;100, which may be followed by ';' or ','
+func (c *syntaxChecker) listStream() error {
+	c.skip()
+	if c.peek() != '#' {
+		return nil
+	}
+	c.pos++
+	if _, err := c.typed(NumericType); err != nil {
+		return err
+	}
+	c.skip()
+	if c.peek() == ';' || c.peek() == ',' {
+		c.pos++
+	}
+	return nil
+}
+
+// colourItems checks the colour items that may precede the coordinates
+// of PLOT, DRAW and CIRCLE, each followed by ';' or ','
+func (c *syntaxChecker) colourItems() error {
+	for {
+		c.skip()
+		if b := c.peek(); c.atEnd() || b < 0xD9 || b > 0xDE {
+			return nil
+		}
+		c.pos++
+		if _, err := c.typed(NumericType); err != nil {
+			return err
+		}
+		c.skip()
+		if c.peek() != ';' && c.peek() != ',' {
+			return c.errorf("';' expected after colour item")
+		}
+		c.pos++
+	}
+}
+
+// tape checks SAVE, LOAD, VERIFY and MERGE. The Interface 1 and 128K
+// forms (with '*' or '!') and the microdrive commands are not checked.
+func (c *syntaxChecker) tape(keyword byte) error {
+	c.skip()
+	if keyword < 0xD5 || c.peek() == '*' || c.peek() == '!' {
+		c.skipStatement()
+		return nil
+	}
+
+	if _, err := c.typed(StringType); err != nil {
+		return err
+	}
+
+	c.skip()
+	if c.endOfStatement() {
+		return nil
+	}
+
+	b := c.peek()
+	c.pos++
+	switch {
+	case b == tokenLine && keyword == tokenSave:
+		_, err := c.typed(NumericType)
+		return err
+	case b == 0xAF: // CODE
+		if keyword == tokenSave {
+			_, err := c.numbers(2)
+			return err
+		}
+		if c.endOfStatement() {
+			return nil
+		}
+		if _, err := c.typed(NumericType); err != nil {
+			return err
+		}
+		c.skip()
+		if c.peek() == ',' {
+			c.pos++
+			_, err := c.typed(NumericType)
+			return err
+		}
+		return nil
+	case b == 0xAA: // SCREEN$
+		return nil
+	case b == 0xE4: // DATA
+		if _, err := c.variable(true, false); err != nil {
+			return err
+		}
+		if err := c.expect('('); err != nil {
+			return err
+		}
+		return c.expect(')')
+	}
+
+	c.pos--
+	return c.errorf("unexpected %s after file name", c.describe())
+}
+
+// defFn checks the expression of a DEF FN statement, whose type must
+// match the function name. The name and parameters were checked when
+// the line was tokenized.
+func (c *syntaxChecker) defFn() error {
+	c.skip()
+	want := NumericType
+	if c.pos+1 < len(c.data) && c.data[c.pos+1] == '$' {
+		want = StringType
+	}
+
+	for !c.atEnd() && c.peek() != '=' {
+		if c.peek() == numberMarker {
+			c.pos += 5
+		}
+		c.pos++
+	}
+	if err := c.expect('='); err != nil {
+		return err
+	}
+	_, err := c.typed(want)
+	return err
+}
+
+// skipStatement moves to the end of the statement, stepping over strings
+func (c *syntaxChecker) skipStatement() {
+	for !c.atEnd() && c.peek() != ':' {
+		switch c.peek() {
+		case '"':
+			if _, err := c.stringLiteral(); err != nil {
+				c.pos = len(c.data)
+			}
+			continue
+		case numberMarker:
+			c.pos += 5
+		}
+		c.pos++
+	}
+	if c.pos > len(c.data) {
+		c.pos = len(c.data)
+	}
+}
+
+// expect consumes the byte b or reports what was found instead
+func (c *syntaxChecker) expect(b byte) error {
+	c.skip()
+	if c.atEnd() || c.peek() != b {
+		return c.errorf("%s expected, found %s", describeByte(b), c.describe())
+	}
+	c.pos++
+	return nil
+}
+
+// skip moves past spaces and embedded colour control codes, which the
+// ROM ignores outside strings
+func (c *syntaxChecker) skip() {
+	for c.pos < len(c.data) {
+		switch b := c.data[c.pos]; {
+		case b == ' ':
+			c.pos++
+		case b >= 0x10 && b <= 0x15: // INK to OVER, one parameter
+			c.pos += 2
+		case b == 0x16 || b == 0x17: // AT and TAB, two parameters
+			c.pos += 3
+		default:
+			return
+		}
+	}
+	if c.pos > len(c.data) {
+		c.pos = len(c.data)
+	}
+}
+
+// peek returns the current byte, or ENTER at the end of the line
+func (c *syntaxChecker) peek() byte {
+	if c.atEnd() {
+		return 0x0D
+	}
+	return c.data[c.pos]
+}
+
+// atEnd reports whether the whole line has been checked
+func (c *syntaxChecker) atEnd() bool {
+	return c.pos >= len(c.data)
+}
+
+// endOfStatement reports whether the current statement has no more bytes
+func (c *syntaxChecker) endOfStatement() bool {
+	c.skip()
+	return c.atEnd() || c.peek() == ':'
+}
+
+// describe names the current byte for error messages
+func (c *syntaxChecker) describe() string {
+	if c.atEnd() {
+		return "end of line"
+	}
+	return describeByte(c.peek())
+}
+
+// describeByte names a tokenized byte for error messages
+func describeByte(b byte) string {
+	switch {
+	case b >= 0xA3:
+		return TokenMap[b].Text
+	case b == numberMarker:
+		return "number"
+	case b >= 0x20 && b < 0x7F:
+		return fmt.Sprintf("'%c'", b)
+	}
+	return fmt.Sprintf("character 0x%02X", b)
+}
+
+// errorf returns a syntax error at the current position
+func (c *syntaxChecker) errorf(format string, args ...interface{}) error {
+	return c.errorAt(c.pos, format, args...)
+}
+
+// errorAt returns a syntax error at pos
+func (c *syntaxChecker) errorAt(pos int, format string, args ...interface{}) error {
+	return &syntaxError{pos: pos, msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,188 @@
+package basic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxValid(t *testing.T) {
+	statements := []string{
+		"PRINT",
+		"PRINT \"A\";b;c$,d'e",
+		"PRINT AT 1,2;\"x\";TAB 5;INK 2;PAPER 1;\"y\"",
+		"PRINT #4;\"printer\"",
+		"LPRINT \"x\";",
+		"INPUT \"Name? \";n$",
+		"INPUT AT 0,0;LINE a$",
+		"LET a=1",
+		"LET a$(2 TO 3)=\"xy\"",
+		"LET b(1,2)=-a*2^3+SIN x",
+		"LET s$=STR$ INT (RND*10)+\"\"\"\"",
+		"LET x=NOT a=b AND c<>d OR e<=f",
+		"LET t$=\"hello\"( TO 3)+a$(2 TO )+a$( TO )",
+		"LET v=VAL \"1\"+CODE INKEY$+LEN a$+USR 3e4+PEEK 23672",
+		"LET p=POINT (1,2)+ATTR (3,4)+PI+BIN 101",
+		"LET q$=SCREEN$ (1,2)",
+		"LET long1=FN f(1,2)+FN g()",
+		"LET a$=b$ AND x=1",
+		"LET u=USR \"a\"+USR 32768",
+		"LET c=+\"a\"<\"b\"",
+		"IF a$=\"y\" THEN PRINT (a$+b$)(2)",
+		"DIM a(10,5)",
+		"DIM b$(3,4)",
+		"FOR i=1 TO 10",
+		"FOR i=10 TO 1 STEP -1",
+		"NEXT i",
+		"IF a=1 THEN PRINT \"one\": GO TO 10",
+		"IF x THEN IF y THEN STOP",
+		"GO TO 10",
+		"GO SUB 100*a",
+		"RETURN",
+		"RUN",
+		"RUN 100",
+		"CLEAR 32767",
+		"RANDOMIZE",
+		"RESTORE 100",
+		"LIST",
+		"LIST 100",
+		"LIST #3",
+		"LIST #3;100",
+		"LLIST #3",
+		"LLIST #3,100",
+		"READ a,b$,c(1)",
+		"DATA 1,\"two\",3+4",
+		"POKE 23658,8",
+		"OUT 254,7",
+		"BEEP .5,12",
+		"PLOT 10,10",
+		"PLOT INK 2;10,10",
+		"DRAW 10,10",
+		"DRAW OVER 1;10,10,PI",
+		"CIRCLE 128,88,50",
+		"BORDER 0: PAPER 0: INK 7: CLS",
+		"PAUSE 0",
+		"SAVE \"prog\" LINE 10",
+		"SAVE \"code\" CODE 32768,100",
+		"SAVE \"scr\" SCREEN$",
+		"SAVE \"arr\" DATA a()",
+		"LOAD \"\"",
+		"LOAD \"\" CODE",
+		"LOAD \"\" CODE 32768",
+		"VERIFY \"x\" DATA n$()",
+		"MERGE \"\"",
+		"STOP",
+		"COPY",
+		"REM anything : goes \"here",
+		"DEF FN f(x,y)=x*y",
+		"DEF FN a$(s$)=s$+\"!\"",
+		"PRINT 1: : PRINT 2",
+	}
+
+	for _, stmt := range statements {
+		t.Run(stmt, func(t *testing.T) {
+			if _, err := NewParser().Parse(strings.NewReader("10 " + stmt + "\n")); err != nil {
+				t.Errorf("Parse() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		column int
+	}{
+		{name: "FOR with a number", input: "FOR 1=1 TO 10", column: 8},
+		{name: "FOR without TO", input: "FOR i=1", column: 11},
+		{name: "FOR with long name", input: "FOR ab=1 TO 2", column: 8},
+		{name: "POKE with one value", input: "POKE a", column: 10},
+		{name: "CIRCLE without radius", input: "CIRCLE x,y", column: 14},
+		{name: "GO TO without line", input: "GO TO", column: 9},
+		{name: "Missing keyword", input: "a=1", column: 4},
+		{name: "Operator at statement start", input: "PRINT 1: AND 2", column: 13},
+		{name: "Items without separator", input: "PRINT 1 2", column: 12},
+		{name: "IF without THEN", input: "IF a=1 GO TO 10", column: 11},
+		{name: "THEN followed by line number", input: "IF a THEN 20", column: 14},
+		{name: "Trailing operator", input: "LET a=1+", column: 12},
+		{name: "Long array name", input: "DIM ab(5)", column: 8},
+		{name: "Long string name", input: "LET ab$=\"x\"", column: 8},
+		{name: "Extra operand", input: "CLS 1", column: 8},
+		{name: "SAVE CODE without length", input: "SAVE \"x\" CODE 1", column: 19},
+		{name: "LOAD LINE", input: "LOAD \"x\" LINE 10", column: 13},
+		{name: "Unterminated string", input: "PRINT \"abc", column: 10},
+		{name: "NEXT with string", input: "NEXT a$", column: 9},
+		{name: "LIST stream without number", input: "LIST #", column: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser().Parse(strings.NewReader("10 " + tt.input + "\n"))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			if diags[0].Code != CodeSyntax {
+				t.Errorf("code = %s (%v), want %s", diags[0].Code, diags[0], CodeSyntax)
+			}
+			if diags[0].Column != tt.column {
+				t.Errorf("column = %d, want %d (%v)", diags[0].Column, tt.column, diags[0])
+			}
+		})
+	}
+}
+
+func TestSyntaxTypes(t *testing.T) {
+	tests := []struct {
+		input  string
+		column int
+		msg    string
+	}{
+		{input: "PRINT LEN 5", column: 10, msg: "LEN needs a string operand"},
+		{input: "PRINT STR$ \"a\"", column: 10, msg: "STR$ needs a numeric operand"},
+		{input: "PRINT VAL 1", column: 10, msg: "VAL needs a string operand"},
+		{input: "PRINT VAL$ x", column: 10, msg: "VAL$ needs a string operand"},
+		{input: "LET a$=1", column: 11, msg: "string expression expected"},
+		{input: "LET a=\"x\"", column: 10, msg: "numeric expression expected"},
+		{input: "IF a$ THEN STOP", column: 7, msg: "numeric expression expected"},
+		{input: "PRINT a$+1", column: 12, msg: "'+' needs two numbers or two strings"},
+		{input: "PRINT a$=1", column: 12, msg: "'=' needs two numbers or two strings"},
+		{input: "PRINT a$*2", column: 12, msg: "'*' needs numeric operands"},
+		{input: "PRINT 1 AND a$", column: 12, msg: "AND needs a numeric right operand"},
+		{input: "PRINT -a$", column: 10, msg: "'-' needs a numeric operand"},
+		{input: "PRINT NOT a$", column: 10, msg: "NOT needs a numeric operand"},
+		{input: "PRINT a(1 TO 2)", column: 14, msg: "only strings can be sliced"},
+		{input: "GO TO \"x\"", column: 10, msg: "numeric expression expected"},
+		{input: "SAVE 1", column: 9, msg: "string expression expected"},
+		{input: "INPUT LINE a", column: 15, msg: "INPUT LINE needs a string variable"},
+		{input: "DEF FN s$(x)=x*2", column: 17, msg: "string expression expected"},
+		{input: "PLAY \"a\",1", column: 13, msg: "string expression expected"},
+		{input: "DIM ab(3)", column: 8, msg: "array name must be a single letter"},
+		{input: "LET ab(1)=2", column: 8, msg: "array name must be a single letter"},
+		{input: "PRINT ab(1)", column: 10, msg: "array name must be a single letter"},
+		{input: "READ ab(1)", column: 9, msg: "array name must be a single letter"},
+		{input: "INPUT ab(1)", column: 10, msg: "array name must be a single letter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := NewParser().Parse(strings.NewReader("10 " + tt.input + "\n"))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			if diags[0].Message != tt.msg || diags[0].Column != tt.column {
+				t.Errorf("got %v, want column %d: %s", diags[0], tt.column, tt.msg)
+			}
+		})
+	}
+}
+
+func TestSyntaxCheckDisabled(t *testing.T) {
+	if _, err := NewParser(WithSyntaxCheck(false)).Parse(strings.NewReader("10 POKE a\n")); err != nil {
+		t.Errorf("Parse() error = %v, want none with syntax checking off", err)
+	}
+}
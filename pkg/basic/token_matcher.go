@@ -14,37 +14,35 @@ type TokenMatch struct {
 // matchToken looks for a token at the start of the text
 // Returns nil if no token matched
 // wantKeyword indicates whether we're expecting a keyword at this position
+//
+// The space in keywords such as GO TO and OPEN # may be left out or
+// doubled, so GOTO and OPEN#3 are read too. A keyword ending in a letter
+// must not run into a following letter or digit, so that TOTAL, INTEREST
+// and ATN2 stay names.
 func (p *Parser) matchToken(text string, wantKeyword bool) (*TokenMatch, error) {
 	var longestMatch int
 	var matchedToken byte
 	found := false
 
 	// Check all tokens from 0xA3 (first keyword) up
-	for token := byte(0xA3); token <= 0xFF; token++ {
+	for i := 0xA3; i <= 0xFF; i++ {
+		token := byte(i)
 		tokenDef := TokenMap[token]
 		if tokenDef.Text == "" {
 			continue
 		}
 
-		var matches bool
-		if p.caseIndependent {
-			matches = strings.HasPrefix(strings.ToUpper(text), strings.ToUpper(tokenDef.Text))
-		} else {
-			matches = strings.HasPrefix(text, tokenDef.Text)
-		}
-
-		if matches {
-			length := len(tokenDef.Text)
+		if length := p.keywordLength(text, tokenDef.Text); length > 0 {
 			if length > longestMatch {
 				// Make sure we don't match part of a longer word
 				// e.g., "INT" shouldn't match in "PRINT"
 				if length < len(text) {
 					nextChar := text[length]
-					if isAlpha(nextChar) && isAlpha(text[length-1]) {
+					if (isAlpha(nextChar) || isDigit(nextChar)) && isAlpha(text[length-1]) {
 						continue
 					}
 				}
-				
+
 				longestMatch = length
 				matchedToken = token
 				found = true
@@ -93,63 +91,7 @@ func (p *Parser) validateTokenContext(token byte, tokenType TokenType, tokenClas
 
 	// Check for AT/TAB in PRINT context
 	if (token == 0xAC || token == 0xAD) && !p.inPrint { // AT or TAB
-		return fmt.Errorf("%s: AT/TAB only allowed in PRINT statements", p.errorPrefix)
-	}
-
-	// Check keyword class sequence
-	if tokenType == TokenKeyword {
-		if err := p.validateKeywordClass(token, tokenClass); err != nil {
-			return err
-		}
-	}
-
-	// Validate expression tokens in correct context
-	if tokenType == TokenNumExpr || tokenType == TokenStrExpr {
-		if p.handlingDEFFN && !p.insideDEFFN {
-			return fmt.Errorf("%s: expression not allowed here in DEF FN", p.errorPrefix)
-		}
-	}
-
-	return nil
-}
-
-// validateKeywordClass checks if the keyword's class is valid in current context
-func (p *Parser) validateKeywordClass(token byte, class KeywordClass) error {
-	if len(class) == 0 {
-		return nil // No class restrictions
-	}
-
-	// Special cases
-	switch token {
-	case 0xEA: // REM
-		return nil // REM can appear anywhere
-	case 0xFA: // IF
-		if p.bracketCount > 0 {
-			return fmt.Errorf("%s: IF not allowed within brackets", p.errorPrefix)
-		}
-	case 0xF1: // LET
-		if p.bracketCount > 0 {
-			return fmt.Errorf("%s: LET not allowed within brackets", p.errorPrefix)
-		}
-	}
-
-	// Check first class requirement
-	firstClass := class[0]
-	switch firstClass {
-	case ClassNone:
-		return nil
-	case ClassLet: // Variable required
-		if p.tokenBracket {
-			return fmt.Errorf("%s: variable required here", p.errorPrefix)
-		}
-	case ClassLetExpr: // Expression required
-		if !p.tokenBracket && p.bracketCount == 0 {
-			return fmt.Errorf("%s: expression required here", p.errorPrefix)
-		}
-	case ClassVarChar: // Single character variable required
-		if p.tokenBracket {
-			return fmt.Errorf("%s: single character variable required here", p.errorPrefix)
-		}
+		return fmt.Errorf("AT/TAB only allowed in PRINT and INPUT statements")
 	}
 
 	return nil
@@ -163,7 +105,7 @@ func (p *Parser) handleProgramType(token byte) error {
 		case -1: // unknown
 			p.is48K = 0 // mark as 128K
 		case 1: // already marked as 48K
-			return fmt.Errorf("%s: program contains 128K keywords but was already marked as 48K", p.errorPrefix)
+			return fmt.Errorf("program contains 128K keywords but was already marked as 48K")
 		}
 	}
 
@@ -176,7 +118,7 @@ func (p *Parser) handleProgramType(token byte) error {
 			case -1: // unknown
 				p.is48K = 1 // mark as 48K
 			case 0: // already marked as 128K
-				return fmt.Errorf("%s: program contains 48K UDGs but was already marked as 128K", p.errorPrefix)
+				return fmt.Errorf("program contains 48K UDGs but was already marked as 128K")
 			}
 		}
 	}
@@ -184,6 +126,39 @@ func (p *Parser) handleProgramType(token byte) error {
 	return nil
 }
 
+// keywordLength returns the length of keyword at the start of text, or 0
+// if text doesn't start with it. A space in the keyword matches any
+// number of spaces, including none.
+func (p *Parser) keywordLength(text, keyword string) int {
+	pos := 0
+	for i := 0; i < len(keyword); i++ {
+		if keyword[i] == ' ' {
+			for pos < len(text) && text[pos] == ' ' {
+				pos++
+			}
+			continue
+		}
+		if pos >= len(text) {
+			return 0
+		}
+		c, k := text[pos], keyword[i]
+		if c != k && !(p.caseIndependent && isAlpha(c) && c|0x20 == k|0x20) {
+			return 0
+		}
+		pos++
+	}
+	return pos
+}
+
+// hasKeywordPrefix reports whether text starts with the keyword,
+// honouring case independent matching
+func (p *Parser) hasKeywordPrefix(text, keyword string) bool {
+	if p.caseIndependent {
+		return len(text) >= len(keyword) && strings.EqualFold(text[:len(keyword)], keyword)
+	}
+	return strings.HasPrefix(text, keyword)
+}
+
 // isAlpha returns true if the byte is an ASCII letter
 func isAlpha(c byte) bool {
 	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
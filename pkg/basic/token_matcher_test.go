@@ -1,6 +1,7 @@
 package basic
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -41,6 +42,33 @@ func TestMatchToken(t *testing.T) {
 			wantToken:   0,
 			wantLength:  0,
 		},
+		{
+			name:        "GOTO without a space",
+			input:       "GOTO 10",
+			wantKeyword: true,
+			wantToken:   0xEC,
+			wantLength:  4,
+		},
+		{
+			name:        "GO SUB with two spaces",
+			input:       "GO  SUB 10",
+			wantKeyword: true,
+			wantToken:   0xED,
+			wantLength:  7,
+		},
+		{
+			name:        "OPEN# without a space",
+			input:       "OPEN#3",
+			wantKeyword: true,
+			wantToken:   0xD3,
+			wantLength:  5,
+		},
+		{
+			name:        "ATN followed by a digit",
+			input:       "ATN2",
+			wantKeyword: false,
+			wantToken:   0,
+		},
 		{
 			name:        "Case sensitivity",
 			input:       "print",
@@ -80,4 +108,40 @@ func TestMatchToken(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestKeywordsAndNames(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		caseIndependent bool
+		want            string
+	}{
+		{name: "TOTAL", input: "10 LET TOTAL=1: PRINT TOTAL", want: "10 LET TOTAL=1: PRINT TOTAL"},
+		{name: "INTEREST", input: "10 LET INTEREST=2: PRINT INTEREST*2", want: "10 LET INTEREST=2: PRINT INTEREST*2"},
+		{name: "ATN2", input: "10 LET ATN2=3: PRINT ATN2+ATN 2", want: "10 LET ATN2=3: PRINT ATN2+ATN 2"},
+		{name: "Keyword at the end of a name", input: "10 LET aTO=1: LET xSIN=aTO", want: "10 LET aTO=1: LET xSIN=aTO"},
+		{name: "Keyword after a name and a space", input: "10 IF a AND b THEN PRINT a OR b", want: "10 IF a AND b THEN PRINT a OR b"},
+		{name: "Keyword after a number", input: "10 FOR i=1TO 10STEP 2", want: "10 FOR i=1 TO 10 STEP 2"},
+		{name: "Spacing variants", input: "10 GOTO 20: GOSUB 20: OPEN#3,\"p\": CLOSE#3", want: "10 GO TO 20: GO SUB 20: OPEN #3,\"p\": CLOSE #3"},
+		{name: "DEFFN", input: "10 DEFFN f(x)=x*2", want: "10 DEF FN f(x)=x*2"},
+		{name: "Lower case names", input: "10 let printer=1: print printer", caseIndependent: true, want: "10 LET printer=1: PRINT printer"},
+		{name: "Keyword as a variable", input: "10 let print=1: let step=print", caseIndependent: true, want: "10 LET print=1: LET step=print"},
+		{name: "Lower case GOTO", input: "10 goto 10", caseIndependent: true, want: "10 GO TO 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := NewParser(WithCaseIndependent(tt.caseIndependent)).Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := ListProgram(data)
+			if err != nil {
+				t.Fatalf("ListProgram() error = %v", err)
+			}
+			if got = strings.TrimSuffix(got, "\n"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package basic
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Unicode characters
+//
+// The Spectrum character set is ASCII apart from £ (0x60) and © (0x7F),
+// followed by the block graphics (0x80-0x8F) and the UDGs (0x90-0xA4).
+// With WithUnicode the parser reads UTF-8 source that uses the Unicode
+// characters for these, as listings copied from web pages and PDFs do,
+// and WithUnicodeListing makes the lister write them.
+
+// unicodeRunes holds the Unicode character for each Spectrum character
+// that has one outside ASCII. The block graphics are made of quadrants:
+// bit 0 is top right, bit 1 top left, bit 2 bottom right and bit 3
+// bottom left. 0x80 is left out, as Unicode has no empty quadrant
+// character apart from the space.
+var unicodeRunes = map[byte]rune{
+	0x60: '£',
+	0x7F: '©',
+	0x81: '▝',
+	0x82: '▘',
+	0x83: '▀',
+	0x84: '▗',
+	0x85: '▐',
+	0x86: '▚',
+	0x87: '▜',
+	0x88: '▖',
+	0x89: '▞',
+	0x8A: '▌',
+	0x8B: '▛',
+	0x8C: '▄',
+	0x8D: '▟',
+	0x8E: '▙',
+	0x8F: '█',
+}
+
+// spectrumChars maps Unicode characters to Spectrum characters. It also
+// accepts ↑, which the Spectrum shows for ^.
+var spectrumChars = func() map[rune]byte {
+	chars := map[rune]byte{'↑': '^'}
+	for b, r := range unicodeRunes {
+		chars[r] = b
+	}
+	return chars
+}()
+
+// maxUDGs is the number of UDGs, A to U
+const maxUDGs = 21
+
+// WithUnicode lets the source use Unicode characters for £, © and the
+// block graphics. udgs holds characters to read as the UDGs A, B, C and
+// so on, and may be empty. Other characters outside ASCII are errors.
+func WithUnicode(udgs string) Option {
+	return func(p *Parser) {
+		p.unicode = true
+		p.udgRunes = []rune(udgs)
+	}
+}
+
+// WithUnicodeListing writes £, © and the block graphics as Unicode
+// characters, and the UDGs A, B, C and so on as the characters in udgs,
+// which may be empty
+func WithUnicodeListing(udgs string) ListerOption {
+	return func(l *Lister) {
+		l.unicode = true
+		l.udgRunes = []rune(udgs)
+	}
+}
+
+// unicodeCharacter converts the UTF-8 character at the start of text to
+// a Spectrum character. It returns nil for ASCII.
+func (p *Parser) unicodeCharacter(text string) (*SequenceMatch, error) {
+	if !p.unicode || text == "" || text[0] < utf8.RuneSelf {
+		return nil, nil
+	}
+
+	r, size := utf8.DecodeRuneInString(text)
+	if r == utf8.RuneError {
+		return nil, fmt.Errorf("invalid UTF-8")
+	}
+	for i, udg := range p.udgRunes {
+		if udg == r && i < maxUDGs {
+			match, err := p.tryUDG(string(rune('A'+i)), 0)
+			if err != nil {
+				return nil, err
+			}
+			match.Length = size
+			return match, nil
+		}
+	}
+	if b, ok := spectrumChars[r]; ok {
+		return &SequenceMatch{Bytes: []byte{b}, Length: size}, nil
+	}
+	return nil, fmt.Errorf("character %q has no Spectrum equivalent", r)
+}
+
+// unicodeRune returns the character the lister writes for b, or 0 if b
+// is written as ASCII or a {...} sequence
+func (l *Lister) unicodeRune(b byte) rune {
+	if !l.unicode {
+		return 0
+	}
+	if b >= 0x90 && int(b-0x90) < len(l.udgRunes) && b-0x90 < maxUDGs {
+		return l.udgRunes[b-0x90]
+	}
+	return unicodeRunes[b]
+}
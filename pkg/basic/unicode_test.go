@@ -0,0 +1,120 @@
+package basic
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnicodeParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		udgs  string
+		want  []byte // Line body without the ENTER
+	}{
+		{
+			name:  "Pound and copyright",
+			input: `10 PRINT "£5 ©"`,
+			want:  []byte{0xF5, '"', 0x60, '5', ' ', 0x7F, '"'},
+		},
+		{
+			name:  "Block graphics",
+			input: `10 PRINT "▝▘▀▗▐▚▜▖▞▌▛▄▟▙█"`,
+			want: []byte{0xF5, '"', 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88,
+				0x89, 0x8A, 0x8B, 0x8C, 0x8D, 0x8E, 0x8F, '"'},
+		},
+		{
+			name:  "UDGs",
+			input: `10 REM ♥♦{C}▌`,
+			udgs:  "♥♦",
+			want:  []byte{0xEA, ' ', 0x90, 0x91, 0x92, 0x8A},
+		},
+		{
+			name:  "Power",
+			input: "10 LET a=2↑3",
+			want:  append([]byte{0xF1, 'a', '='}, append(mustNumber(t, "2"), append([]byte{'^'}, mustNumber(t, "3")...)...)...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := NewParser(WithUnicode(tt.udgs)).ParseLine(tt.input)
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			if got := bytes.TrimSuffix(line.Body, []byte{0x0D}); !bytes.Equal(got, tt.want) {
+				t.Errorf("got % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustNumber(t *testing.T, text string) []byte {
+	t.Helper()
+	encoded, _, err := NewParser().parseNumber(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestUnicodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		column int
+	}{
+		{name: "No equivalent", input: `10 PRINT "é"`, column: 11},
+		{name: "Invalid UTF-8", input: "10 REM \xFF", column: 8},
+		{name: "UDG T in 128K program", input: `10 PLAY "a": PRINT "♠"`, column: 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			udgs := strings.Repeat("x", 19) + "♠"
+			_, err := NewParser(WithUnicode(udgs)).Parse(strings.NewReader(tt.input))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			if d := diags[0]; d.Column != tt.column || d.Code != CodeSequence {
+				t.Errorf("got %v [%s], want column %d", d, d.Code, tt.column)
+			}
+		})
+	}
+
+	// Without WithUnicode the bytes are copied as before
+	if _, err := NewParser().Parse(strings.NewReader(`10 PRINT "é"`)); err != nil {
+		t.Errorf("Parse() without Unicode error = %v", err)
+	}
+}
+
+func TestUnicodeListing(t *testing.T) {
+	source := "10 PRINT \"£ © ▐█ ♥{-1}\": REM ▚♦\n20 LET a$=\"^`\"\n"
+	data, err := NewParser(WithUnicode("♥♦")).Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got, err := ListProgram(data, WithUnicodeListing("♥♦"))
+	if err != nil {
+		t.Fatalf("ListProgram() error = %v", err)
+	}
+	want := "10 PRINT \"£ © ▐█ ♥{-1}\": REM ▚♦\n20 LET a$=\"^£\"\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// The default listing stays ASCII
+	got, err = ListProgram(data)
+	if err != nil {
+		t.Fatalf("ListProgram() error = %v", err)
+	}
+	want = "10 PRINT \"` {(C)} {-6}{+8} {A}{-1}\": REM {-7}{B}\n20 LET a$=\"^`\"\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
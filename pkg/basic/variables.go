@@ -0,0 +1,418 @@
+package basic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Variables area
+//
+// A saved program is followed by its variables, which LOAD puts back, so
+// a program can come with a high score table or arrays already set up.
+// Each variable starts with its letter, with the top three bits giving
+// its type:
+//
+//	011  number with a one letter name, then 5 bytes
+//	101  number with a longer name: the other characters follow, the
+//	     last with bit 7 set, then 5 bytes
+//	010  string: 2 bytes of length, then the characters
+//	100  numeric array: 2 bytes of length, then the array as in SAVE DATA
+//	110  character array, in the same way
+//	111  FOR control variable: the value, limit and step in 5 bytes each,
+//	     then the line (2 bytes) and statement (1 byte) to loop back to
+//
+// In memory the area ends with 0x80, which SAVE leaves off.
+
+// VariableType is the kind of a variable
+type VariableType int
+
+const (
+	NumberVariable VariableType = iota
+	StringVariable
+	NumberArrayVariable
+	CharArrayVariable
+	ForVariable
+)
+
+// Type bits at the top of a variable's first byte
+const (
+	varString    = 0x40
+	varNumber    = 0x60
+	varNumArray  = 0x80
+	varLongName  = 0xA0
+	varCharArray = 0xC0
+	varFor       = 0xE0
+
+	varsEnd = 0x80
+)
+
+// SavedVariable is one variable in the variables area of a saved program
+type SavedVariable struct {
+	Type VariableType
+	Name string // In lower case; only numbers may have more than one letter
+
+	Value   float64      // NumberVariable and ForVariable
+	Text    []byte       // StringVariable
+	Numbers *NumberArray // NumberArrayVariable
+	Chars   *CharArray   // CharArrayVariable
+
+	// ForVariable: the loop's limit and step, and the line and
+	// statement that NEXT goes back to
+	Limit, Step     float64
+	Line, Statement int
+}
+
+// Variables is the variables area of a program, in the order stored
+type Variables []SavedVariable
+
+// Key returns the variable's name as written in BASIC, with $ for
+// strings and () for arrays
+func (v *SavedVariable) Key() string {
+	switch v.Type {
+	case StringVariable:
+		return v.Name + "$"
+	case NumberArrayVariable:
+		return v.Name + "()"
+	case CharArrayVariable:
+		return v.Name + "$()"
+	}
+	return v.Name
+}
+
+// MarshalBinary encodes the variables as SAVE stores them, without the
+// 0x80 that ends the area in memory
+func (vars Variables) MarshalBinary() ([]byte, error) {
+	var out []byte
+	for _, v := range vars {
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", v.Key(), err)
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// MarshalBinary encodes one variable
+func (v *SavedVariable) MarshalBinary() ([]byte, error) {
+	if err := checkVariableName(v.Name, v.Type == NumberVariable); err != nil {
+		return nil, err
+	}
+	letter := v.Name[0] & 0x1F
+
+	switch v.Type {
+	case NumberVariable:
+		out := []byte{varNumber | letter}
+		if len(v.Name) > 1 {
+			out[0] = varLongName | letter
+			out = append(out, v.Name[1:]...)
+			out[len(out)-1] |= 0x80
+		}
+		return appendNumbers(out, v.Value)
+
+	case ForVariable:
+		out, err := appendNumbers([]byte{varFor | letter}, v.Value, v.Limit, v.Step)
+		if err != nil {
+			return nil, err
+		}
+		if v.Line < 0 || v.Line > 0x3FFF || v.Statement < 0 || v.Statement > 0xFF {
+			return nil, fmt.Errorf("loop goes back to line %d statement %d", v.Line, v.Statement)
+		}
+		out = binary.LittleEndian.AppendUint16(out, uint16(v.Line))
+		return append(out, byte(v.Statement)), nil
+
+	case StringVariable:
+		return withLength(varString|letter, v.Text)
+
+	case NumberArrayVariable:
+		if v.Numbers == nil {
+			return nil, fmt.Errorf("no array")
+		}
+		data, err := v.Numbers.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return withLength(varNumArray|letter, data)
+
+	case CharArrayVariable:
+		if v.Chars == nil {
+			return nil, fmt.Errorf("no array")
+		}
+		data, err := v.Chars.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return withLength(varCharArray|letter, data)
+	}
+	return nil, fmt.Errorf("unknown variable type %d", v.Type)
+}
+
+// checkVariableName checks that name is a lower case letter, or for a
+// number, a letter followed by lower case letters and digits
+func checkVariableName(name string, long bool) error {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return fmt.Errorf("name %q must start with a lower case letter", name)
+	}
+	if !long && len(name) > 1 {
+		return fmt.Errorf("name %q must be a single letter", name)
+	}
+	for i := 1; i < len(name); i++ {
+		if c := name[i]; !(c >= 'a' && c <= 'z') && !isDigit(c) {
+			return fmt.Errorf("name %q must be lower case letters and digits", name)
+		}
+	}
+	return nil
+}
+
+// appendNumbers appends values in the ROM's 5-byte form
+func appendNumbers(out []byte, values ...float64) ([]byte, error) {
+	for _, val := range values {
+		num, err := EncodeNumber(val)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, num...)
+	}
+	return out, nil
+}
+
+// withLength returns a variable made of its first byte, the length of
+// data and data
+func withLength(first byte, data []byte) ([]byte, error) {
+	if len(data) > 0xFFFF {
+		return nil, fmt.Errorf("%d bytes is too long", len(data))
+	}
+	out := binary.LittleEndian.AppendUint16([]byte{first}, uint16(len(data)))
+	return append(out, data...), nil
+}
+
+// UnmarshalBinary decodes a variables area, such as the data after the
+// program length in a saved program. It stops at 0x80 if there is one.
+func (vars *Variables) UnmarshalBinary(data []byte) error {
+	var out Variables
+	for pos := 0; pos < len(data) && data[pos] != varsEnd; {
+		v, length, err := decodeVariable(data[pos:])
+		if err != nil {
+			return fmt.Errorf("variable at offset %d: %w", pos, err)
+		}
+		out = append(out, v)
+		pos += length
+	}
+	*vars = out
+	return nil
+}
+
+// decodeVariable decodes the variable at the start of data and returns
+// the number of bytes it takes
+func decodeVariable(data []byte) (SavedVariable, int, error) {
+	v := SavedVariable{Name: string(data[0]&0x1F | 0x60)}
+	need := func(n int) error {
+		if len(data) < n {
+			return fmt.Errorf("%s is truncated", v.Key())
+		}
+		return nil
+	}
+
+	switch data[0] & 0xE0 {
+	case varNumber:
+		v.Type = NumberVariable
+		if err := need(6); err != nil {
+			return v, 0, err
+		}
+		value, err := DecodeNumber(data[1:6])
+		v.Value = value
+		return v, 6, err
+
+	case varLongName:
+		v.Type = NumberVariable
+		end := 1
+		for end < len(data) && data[end]&0x80 == 0 {
+			end++
+		}
+		v.Name += string(data[1:end])
+		if end < len(data) {
+			v.Name += string(data[end] & 0x7F)
+		}
+		if err := need(end + 6); err != nil {
+			return v, 0, err
+		}
+		value, err := DecodeNumber(data[end+1 : end+6])
+		v.Value = value
+		return v, end + 6, err
+
+	case varFor:
+		v.Type = ForVariable
+		if err := need(19); err != nil {
+			return v, 0, err
+		}
+		var values [3]float64
+		for i := range values {
+			var err error
+			if values[i], err = DecodeNumber(data[1+5*i : 6+5*i]); err != nil {
+				return v, 0, err
+			}
+		}
+		v.Value, v.Limit, v.Step = values[0], values[1], values[2]
+		v.Line = int(binary.LittleEndian.Uint16(data[16:]))
+		v.Statement = int(data[18])
+		return v, 19, nil
+	}
+
+	// The rest hold their length
+	if err := need(3); err != nil {
+		return v, 0, err
+	}
+	length := 3 + int(binary.LittleEndian.Uint16(data[1:]))
+	if err := need(length); err != nil {
+		return v, 0, err
+	}
+	body := data[3:length]
+
+	switch data[0] & 0xE0 {
+	case varString:
+		v.Type = StringVariable
+		v.Text = append([]byte(nil), body...)
+		return v, length, nil
+	case varNumArray:
+		v.Type = NumberArrayVariable
+		v.Numbers = &NumberArray{}
+		return v, length, v.Numbers.UnmarshalBinary(body)
+	case varCharArray:
+		v.Type = CharArrayVariable
+		v.Chars = &CharArray{}
+		return v, length, v.Chars.UnmarshalBinary(body)
+	}
+	return v, 0, fmt.Errorf("unknown variable type 0x%02X", data[0])
+}
+
+// forLoop is the JSON form of a FOR control variable
+type forLoop struct {
+	Value     float64 `json:"value"`
+	Limit     float64 `json:"limit"`
+	Step      float64 `json:"step"`
+	Line      int     `json:"line"`
+	Statement int     `json:"statement"`
+}
+
+// MarshalJSON encodes the variables as a JSON object keyed by their
+// names as written in BASIC, in the order stored:
+//
+//	{"score": 100, "n$": "ELITE", "h()": [90, 80], "t$()": ["AB", "CD"],
+//	 "i": {"value": 1, "limit": 10, "step": 1, "line": 20, "statement": 2}}
+//
+// Strings use the same characters as arrays in JSON.
+func (vars Variables) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, v := range vars {
+		var value interface{}
+		switch v.Type {
+		case NumberVariable:
+			value = v.Value
+		case StringVariable:
+			value = spectrumToString(v.Text)
+		case NumberArrayVariable:
+			value = v.Numbers
+		case CharArrayVariable:
+			value = v.Chars
+		case ForVariable:
+			value = forLoop{v.Value, v.Limit, v.Step, v.Line, v.Statement}
+		}
+
+		key, err := json.Marshal(v.Key())
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", v.Key(), err)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes variables written as by MarshalJSON, keeping
+// their order. Names may be in upper case.
+func (vars *Variables) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("variables must be a JSON object")
+	}
+
+	var out Variables
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("variable %s: %w", key, err)
+		}
+
+		v, err := variableFromJSON(key, raw)
+		if err != nil {
+			return fmt.Errorf("variable %s: %w", key, err)
+		}
+		out = append(out, v)
+	}
+	*vars = out
+	return nil
+}
+
+// variableFromJSON decodes the variable named key
+func variableFromJSON(key string, raw json.RawMessage) (SavedVariable, error) {
+	name := strings.ToLower(key)
+	v := SavedVariable{Type: NumberVariable}
+	switch {
+	case strings.HasSuffix(name, "$()"):
+		v.Type = CharArrayVariable
+	case strings.HasSuffix(name, "()"):
+		v.Type = NumberArrayVariable
+	case strings.HasSuffix(name, "$"):
+		v.Type = StringVariable
+	case bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")):
+		v.Type = ForVariable
+	}
+	v.Name = strings.TrimRight(name, "$()")
+	if err := checkVariableName(v.Name, v.Type == NumberVariable); err != nil {
+		return v, err
+	}
+
+	switch v.Type {
+	case NumberVariable:
+		return v, json.Unmarshal(raw, &v.Value)
+	case StringVariable:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return v, err
+		}
+		text, err := stringToSpectrum(s)
+		v.Text = []byte(text)
+		return v, err
+	case NumberArrayVariable:
+		v.Numbers = &NumberArray{}
+		return v, json.Unmarshal(raw, v.Numbers)
+	case CharArrayVariable:
+		v.Chars = &CharArray{}
+		return v, json.Unmarshal(raw, v.Chars)
+	}
+
+	var loop forLoop
+	if err := json.Unmarshal(raw, &loop); err != nil {
+		return v, err
+	}
+	v.Value, v.Limit, v.Step, v.Line, v.Statement = loop.Value, loop.Limit, loop.Step, loop.Line, loop.Statement
+	return v, nil
+}
@@ -0,0 +1,100 @@
+package basic
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestVariablesBinary(t *testing.T) {
+	vars := Variables{
+		{Type: NumberVariable, Name: "a", Value: 1},
+		{Type: NumberVariable, Name: "hi2", Value: 1000},
+		{Type: StringVariable, Name: "n", Text: []byte("AB")},
+		{Type: NumberArrayVariable, Name: "h", Numbers: &NumberArray{Dims: []int{2}, Values: []float64{5, 6}}},
+		{Type: CharArrayVariable, Name: "t", Chars: &CharArray{Dims: []int{2, 1}, Data: []byte("xy")}},
+		{Type: ForVariable, Name: "i", Value: 1, Limit: 10, Step: 1, Line: 20, Statement: 2},
+	}
+	want := []byte{
+		0x61, 0x00, 0x00, 0x01, 0x00, 0x00, // a=1
+		0xA8, 'i', '2' | 0x80, 0x00, 0x00, 0xE8, 0x03, 0x00, // hi2=1000
+		0x4E, 0x02, 0x00, 'A', 'B', // n$="AB"
+		0x88, 0x0D, 0x00, 0x01, 0x02, 0x00, 0, 0, 5, 0, 0, 0, 0, 6, 0, 0, // h(2)
+		0xD4, 0x07, 0x00, 0x02, 0x02, 0x00, 0x01, 0x00, 'x', 'y', // t$(2,1)
+		0xE9, 0, 0, 1, 0, 0, 0, 0, 10, 0, 0, 0, 0, 1, 0, 0, 20, 0, 2, // FOR i
+	}
+
+	got, err := vars.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("MarshalBinary() = % X, want % X", got, want)
+	}
+
+	// The end marker left in memory is ignored
+	var decoded Variables
+	if err := decoded.UnmarshalBinary(append(got, 0x80)); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, vars) {
+		t.Errorf("UnmarshalBinary() = %+v, want %+v", decoded, vars)
+	}
+}
+
+func TestVariablesJSON(t *testing.T) {
+	input := `{"Score": 100, "n$": "ELITE", "h()": [90, 80], "t$()": ["AB", "C"],
+		"i": {"value": 1, "limit": 10, "step": 1, "line": 20, "statement": 2}}`
+
+	var vars Variables
+	if err := json.Unmarshal([]byte(input), &vars); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	var keys []string
+	for _, v := range vars {
+		keys = append(keys, v.Key())
+	}
+	if want := []string{"score", "n$", "h()", "t$()", "i"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got variables %v, want %v", keys, want)
+	}
+	if v := vars[4]; v.Type != ForVariable || v.Limit != 10 || v.Line != 20 || v.Statement != 2 {
+		t.Errorf("FOR variable = %+v", v)
+	}
+
+	data, err := json.Marshal(vars)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"score":100,"n$":"ELITE","h()":[90,80],"t$()":["AB","C "],` +
+		`"i":{"value":1,"limit":10,"step":1,"line":20,"statement":2}}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
+
+func TestVariablesErrors(t *testing.T) {
+	for _, input := range []string{
+		`{"ab$": "x"}`,
+		`{"1a": 1}`,
+		`{"a b": 1}`,
+		`{"ab()": [1]}`,
+		`[1]`,
+	} {
+		var vars Variables
+		if err := json.Unmarshal([]byte(input), &vars); err == nil {
+			t.Errorf("Unmarshal(%s) error = nil", input)
+		}
+	}
+
+	for _, data := range [][]byte{
+		{0x61, 0x00, 0x00},       // Truncated number
+		{0x4E, 0x05, 0x00, 'A'},  // String shorter than its length
+		{0x20, 0x00, 0x00, 0x00}, // Unknown type
+	} {
+		var vars Variables
+		if err := vars.UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary(% X) error = nil", data)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package basic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects the escapes the parser accepts in source text
+type Dialect int
+
+const (
+	// Standard uses {...} sequences such as {A}, {+3} and {INK 2}
+	Standard Dialect = iota
+
+	// Zmakebas reads source written for zmakebas: backslash escapes
+	// instead of {...} sequences, and lines ending with a backslash
+	// continued on the next line
+	Zmakebas
+)
+
+// String returns the name of the dialect
+func (d Dialect) String() string {
+	switch d {
+	case Standard:
+		return "standard"
+	case Zmakebas:
+		return "zmakebas"
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// ParseDialect returns the dialect with the given name
+func ParseDialect(name string) (Dialect, error) {
+	for _, d := range []Dialect{Standard, Zmakebas} {
+		if strings.EqualFold(name, d.String()) {
+			return d, nil
+		}
+	}
+	return Standard, fmt.Errorf("unknown dialect %q", name)
+}
+
+// WithDialect sets the dialect of the source. The default is Standard.
+//
+// In the Zmakebas dialect these escapes are read instead of {...}
+// sequences, which are kept as plain text:
+//
+//	\a to \u   UDGs A to U
+//	\'' \.: ...  block graphics, two characters from space, ', . and :
+//	           for the left and right halves
+//	\*         ©
+//	\{n}       the character with code n, in decimal, 0x hex or 0 octal
+//	\@ \\      @ and \
+//
+// zmakebas's -l mode is labels mode (WithLabels), with zmakebas's
+// default line step of 2 left to the caller.
+func WithDialect(d Dialect) Option {
+	return func(p *Parser) {
+		p.dialect = d
+	}
+}
+
+// zmakebasEscape expands the zmakebas escape at the start of text. It
+// returns nil if text doesn't start with a backslash.
+func (p *Parser) zmakebasEscape(text string) (*SequenceMatch, error) {
+	if !strings.HasPrefix(text, `\`) {
+		return nil, nil
+	}
+	if len(text) < 2 {
+		return nil, fmt.Errorf(`\ at the end of the line`)
+	}
+
+	c := text[1]
+	switch {
+	case c >= 'a' && c <= 'u':
+		match, err := p.tryUDG(string(c), 0)
+		if err != nil {
+			return nil, err
+		}
+		match.Length = 2
+		return match, nil
+
+	case c == '*':
+		return &SequenceMatch{Bytes: []byte{0x7F}, Length: 2}, nil
+
+	case c == '@' || c == '\\':
+		return &SequenceMatch{Bytes: []byte{c}, Length: 2}, nil
+
+	case c == '{':
+		end := strings.IndexByte(text, '}')
+		if end < 0 {
+			return nil, fmt.Errorf(`unclosed \{`)
+		}
+		code, err := strconv.ParseUint(text[2:end], 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf(`\{%s} must be a character code from 0 to 255`, text[2:end])
+		}
+		return &SequenceMatch{Bytes: []byte{byte(code)}, Length: end + 1}, nil
+	}
+
+	// Block graphics: bit 0 is top right, bit 1 top left, bit 2 bottom
+	// right and bit 3 bottom left
+	if len(text) >= 3 {
+		left, okLeft := quadrants(text[1])
+		right, okRight := quadrants(text[2])
+		if okLeft && okRight {
+			return &SequenceMatch{Bytes: []byte{0x80 | left<<1 | right}, Length: 3}, nil
+		}
+	}
+	return nil, fmt.Errorf(`unknown escape \%c`, c)
+}
+
+// quadrants returns the bits for the top (bit 0) and bottom (bit 2)
+// quadrants that a zmakebas block graphics character stands for
+func quadrants(c byte) (byte, bool) {
+	switch c {
+	case ' ':
+		return 0, true
+	case '\'':
+		return 1, true
+	case '.':
+		return 4, true
+	case ':':
+		return 5, true
+	}
+	return 0, false
+}
+
+// joinContinuations joins each line ending with a backslash to the line
+// after it, as zmakebas does. The joined line keeps the position of its
+// first part.
+func joinContinuations(lines []sourceLine) []sourceLine {
+	var out []sourceLine
+	continued := false
+	for _, source := range lines {
+		if continued {
+			last := &out[len(out)-1]
+			last.text = last.text[:len(last.text)-1] + source.text
+		} else {
+			out = append(out, source)
+		}
+		text := out[len(out)-1].text
+		continued = strings.HasSuffix(text, `\`) && !strings.HasSuffix(text, `\\`)
+	}
+	return out
+}
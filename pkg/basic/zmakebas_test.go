@@ -0,0 +1,111 @@
+package basic
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestZmakebasEscapes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []byte // Line body without the ENTER
+	}{
+		{
+			name:  "UDGs",
+			input: `10 PRINT "\a\u"`,
+			want:  []byte{0xF5, '"', 0x90, 0xA4, '"'},
+		},
+		{
+			name:  "Block graphics",
+			input: `10 PRINT "\  \' \'.\::\ :"`,
+			want:  []byte{0xF5, '"', 0x80, 0x82, 0x86, 0x8F, 0x85, '"'},
+		},
+		{
+			name:  "Character codes",
+			input: `10 REM \*\{65}\{0x42}\{0103}\@\\`,
+			want:  []byte{0xEA, ' ', 0x7F, 'A', 'B', 'C', '@', '\\'},
+		},
+		{
+			name:  "Braces are plain text",
+			input: `10 PRINT "{A}{INK 2}"`,
+			want:  []byte{0xF5, '"', '{', 'A', '}', '{', 'I', 'N', 'K', ' ', '2', '}', '"'},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := NewParser(WithDialect(Zmakebas)).ParseLine(tt.input)
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			if got := bytes.TrimSuffix(line.Body, []byte{0x0D}); !bytes.Equal(got, tt.want) {
+				t.Errorf("got % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZmakebasErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		column int
+	}{
+		{name: "Unknown escape", input: `10 PRINT "\z"`, column: 11},
+		{name: "Code out of range", input: `10 PRINT "\{256}"`, column: 11},
+		{name: "Unclosed code", input: `10 PRINT "\{1"`, column: 11},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(WithDialect(Zmakebas)).Parse(strings.NewReader(tt.input))
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) || len(diags) != 1 {
+				t.Fatalf("Parse() error = %v, want one diagnostic", err)
+			}
+			if d := diags[0]; d.Column != tt.column || d.Code != CodeSequence {
+				t.Errorf("got %v [%s], want column %d", d, d.Code, tt.column)
+			}
+		})
+	}
+}
+
+func TestZmakebasSource(t *testing.T) {
+	// A zmakebas -l source gives the same program as the numbered
+	// source written in the standard dialect
+	source := `# zmakebas -l
+@loop:
+PRINT "\a\..\{96}"; \
+    "done"
+IF INKEY$="" THEN GO TO @loop
+`
+	want := "10 PRINT \"{A}{+5}{60}\"; \"done\"\n12 IF INKEY$=\"\" THEN GO TO 10\n"
+
+	data, err := NewParser(WithDialect(Zmakebas), WithLabels(10, 2)).Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	standard, err := NewParser().Parse(strings.NewReader(want))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !bytes.Equal(data, standard) {
+		got, _ := ListProgram(data)
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	for _, d := range []Dialect{Standard, Zmakebas} {
+		if got, err := ParseDialect(d.String()); err != nil || got != d {
+			t.Errorf("ParseDialect(%q) = %v, %v", d.String(), got, err)
+		}
+	}
+	if _, err := ParseDialect("bas2tap"); err == nil {
+		t.Error("ParseDialect(\"bas2tap\") succeeded")
+	}
+}
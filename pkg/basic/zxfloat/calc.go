@@ -0,0 +1,253 @@
+package zxfloat
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Arithmetic as done by the ROM's calculator
+//
+// Small integers are added and multiplied as integers when the result
+// fits, and stay small integers. Everything else is worked out in
+// floating point with the ROM's own rounding:
+//
+//   - Addition lines up the smaller number by shifting it right, and
+//     rounds up when the last bit shifted out was set.
+//   - Multiplication and division keep the bits just past the 32-bit
+//     mantissa, and round up when the first of them is set.
+//
+// The ROM turns -65536 into 0 when it makes a small integer floating
+// point or negates it, and so do these functions.
+
+// Neg returns -n
+func Neg(n Number) Number {
+	if n.IsZero() {
+		return n
+	}
+	if n.IsInt() {
+		mag, sign := intFetch(n)
+		return intStore(mag, ^sign)
+	}
+	n[1] ^= signBit
+	return n
+}
+
+// Add returns a+b
+func Add(a, b Number) (Number, error) {
+	if a.IsInt() && b.IsInt() {
+		if sum, ok := addInts(a, b); ok {
+			return sum, nil
+		}
+	}
+
+	// Both numbers as 40-bit two's complement values, the first byte
+	// being the sign
+	expA, x := prepAdd(restack(a))
+	expB, y := prepAdd(restack(b))
+	exp := expA
+	if expB >= expA {
+		exp, x, y = expB, y, x
+	}
+	// x has the larger exponent, y is shifted to line up with it
+	sum := x + shiftFP(y, exp-min(expA, expB))
+
+	if sum >= 1<<32 || sum < -1<<32 {
+		sum = shiftFP(sum, 1)
+		if exp++; exp == 0 {
+			return Zero, ErrOverflow
+		}
+	}
+	neg := sum < 0
+	if neg {
+		sum = -sum
+	}
+	if sum == 1<<32 {
+		sum >>= 1
+		if exp++; exp == 0 {
+			return Zero, ErrOverflow
+		}
+	}
+	return normalise(exp, neg, uint32(sum), 0)
+}
+
+// Sub returns a-b
+func Sub(a, b Number) (Number, error) {
+	return Add(a, Neg(b))
+}
+
+// Mul returns a*b
+func Mul(a, b Number) (Number, error) {
+	if a.IsInt() && b.IsInt() {
+		magA, signA := intFetch(a)
+		magB, signB := intFetch(b)
+		if hi, lo := bits.Mul32(uint32(magA), uint32(magB)); hi == 0 && lo <= maxSmall {
+			sign := signA ^ signB
+			if lo == 0 {
+				sign = 0
+			}
+			return intStore(uint16(lo), sign), nil
+		}
+	}
+
+	a, b = restack(a), restack(b)
+	if a.IsZero() {
+		return a, nil
+	}
+	if b.IsZero() {
+		return Zero, nil
+	}
+	expA, negA, mantA := unpack(a)
+	expB, negB, mantB := unpack(b)
+	product := uint64(mantA) * uint64(mantB)
+	exp := int(expA) + int(expB) - expBias
+	return finish(exp, negA != negB, uint32(product>>32), byte(product>>24))
+}
+
+// Div returns a/b, which is always floating point
+func Div(a, b Number) (Number, error) {
+	a, b = restack(a), restack(b)
+	if b.IsZero() {
+		return Zero, fmt.Errorf("division by zero: %w", ErrOverflow)
+	}
+	if a.IsZero() {
+		return a, nil
+	}
+	expA, negA, mantA := unpack(a)
+	expB, negB, mantB := unpack(b)
+
+	// 34 bits of quotient, the first being 1 when mantA >= mantB
+	quotient, _ := bits.Div64(uint64(mantA>>31), uint64(mantA)<<33, uint64(mantB))
+	exp := int(expA) - int(expB) + expBias + 1
+	return finish(exp, negA != negB, uint32(quotient>>2), byte(quotient<<6))
+}
+
+// Compare returns -1, 0 or 1 as a is less than, equal to or greater than
+// b. Like the ROM, it looks at the sign of a-b, so numbers too close for
+// the subtraction to tell apart are equal.
+func Compare(a, b Number) (int, error) {
+	diff, err := Sub(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return diff.Sign(), nil
+}
+
+// addInts adds two small integers as the ROM does, reporting false when
+// the sum doesn't fit. Unlike elsewhere, -65536 is a possible sum.
+func addInts(a, b Number) (Number, bool) {
+	low := uint32(a[2]) | uint32(a[3])<<8
+	low += uint32(b[2]) | uint32(b[3])<<8
+	signs := uint32(a[1]) + uint32(b[1]) + low>>16
+
+	// The signs and carry must come to 00 or FF
+	if byte(signs) != 0 && byte(signs) != 0xFF {
+		return Zero, false
+	}
+	sign := byte(0)
+	if byte(signs) == 0xFF {
+		sign = 0xFF
+	}
+	return Number{0, sign, byte(low), byte(low >> 8), 0}, true
+}
+
+// restack returns a small integer in floating point form, as the ROM's
+// RE-STACK does
+func restack(n Number) Number {
+	if !n.IsInt() {
+		return n
+	}
+	mag, sign := intFetch(n)
+	if mag == 0 {
+		return Zero
+	}
+	length := bits.Len16(mag)
+	return pack(byte(expBias+length), sign&1 != 0, uint32(mag)<<(32-length))
+}
+
+// prepAdd returns the exponent of a floating point number and its
+// mantissa as a signed value, as the ROM's PREP-ADD does
+func prepAdd(n Number) (byte, int64) {
+	if n[0] == 0 {
+		return 0, 0
+	}
+	exp, neg, mant := unpack(n)
+	if neg {
+		return exp, -int64(mant)
+	}
+	return exp, int64(mant)
+}
+
+// shiftFP shifts a 40-bit value right, adding back the last bit shifted
+// out to the low 32 bits. A value that is shifted out altogether, or
+// whose low 32 bits carry over, is zero.
+func shiftFP(val int64, shift byte) int64 {
+	if shift == 0 {
+		return val
+	}
+	if shift > 32 {
+		return 0
+	}
+	last := val >> (shift - 1) & 1
+	val >>= shift
+	if last == 0 {
+		return val
+	}
+	low := uint32(val) + 1
+	if low == 0 {
+		return 0
+	}
+	return val>>32<<32 | int64(low)
+}
+
+// finish stores the result of a multiplication or division with the
+// exponent it should have, before normalising
+func finish(exp int, neg bool, mant uint32, guard byte) (Number, error) {
+	switch {
+	case exp > 0x100 || exp == 0x100 && mant&(1<<31) != 0:
+		return Zero, ErrOverflow
+	case exp == 0:
+		return nearZero(neg, mant), nil
+	case exp < 0:
+		return Zero, nil
+	}
+	// 0x100 wraps to 0 and comes back to 0xFF as the mantissa is shifted
+	return normalise(byte(exp), neg, mant, guard)
+}
+
+// normalise shifts the mantissa left until its top bit is set, bringing
+// in bits from the guard byte, then rounds up if the next guard bit is
+// set. This is the ROM's NORMALISE, exponent byte and all.
+func normalise(exp byte, neg bool, mant uint32, guard byte) (Number, error) {
+	for i := 0; ; i++ {
+		if i == 32 {
+			return Zero, nil
+		}
+		if mant&(1<<31) != 0 {
+			break
+		}
+		guard = bits.RotateLeft8(guard, 1)
+		mant = mant<<1 | uint32(guard&1)
+		if exp--; exp == 0 {
+			return nearZero(neg, mant), nil
+		}
+	}
+
+	if guard&signBit != 0 {
+		if mant++; mant == 0 {
+			mant = 1 << 31
+			if exp++; exp == 0 {
+				return Zero, ErrOverflow
+			}
+		}
+	}
+	return pack(exp, neg, mant), nil
+}
+
+// nearZero returns the smallest number the ROM keeps for a result whose
+// exponent fell to 0, or zero if the mantissa wasn't normalised yet
+func nearZero(neg bool, mant uint32) Number {
+	if mant&(1<<31) == 0 {
+		return Zero
+	}
+	return pack(1, neg, 1<<31)
+}
@@ -0,0 +1,181 @@
+package zxfloat
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	tenth := Number{0x7D, 0x4C, 0xCC, 0xCC, 0xCD}
+	tests := []struct {
+		name string
+		op   func(a, b Number) (Number, error)
+		a, b Number
+		want Number
+	}{
+		{name: "Integers add as integers", op: Add, a: FromInt(1000), b: FromInt(-1), want: FromInt(999)},
+		{name: "Integer sum too big", op: Add, a: FromInt(65535), b: FromInt(1), want: Number{0x91, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Integer sum of -65536", op: Add, a: FromInt(-65535), b: FromInt(-1), want: Number{0x00, 0xFF, 0x00, 0x00, 0x00}},
+		{name: "Floating point sum", op: Add, a: Number{0x80, 0x00, 0x00, 0x00, 0x00}, b: Number{0x7F, 0x00, 0x00, 0x00, 0x00}, want: Number{0x80, 0x40, 0x00, 0x00, 0x00}},
+		{name: "Sum to zero", op: Add, a: tenth, b: Neg(tenth), want: Zero},
+		{name: "Difference", op: Sub, a: FromInt(1), b: tenth, want: Number{0x80, 0x66, 0x66, 0x66, 0x66}},
+		{name: "Integers multiply as integers", op: Mul, a: FromInt(-255), b: FromInt(257), want: FromInt(-65535)},
+		{name: "Integer product too big", op: Mul, a: FromInt(256), b: FromInt(256), want: Number{0x91, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Product", op: Mul, a: FromInt(3), b: tenth, want: Number{0x7F, 0x19, 0x99, 0x99, 0x9A}},
+		{name: "Product of zero", op: Mul, a: Zero, b: tenth, want: Zero},
+		{name: "Quotient", op: Div, a: FromInt(1), b: FromInt(10), want: tenth},
+		{name: "Quotient of integers", op: Div, a: FromInt(10), b: FromInt(2), want: Number{0x83, 0x20, 0x00, 0x00, 0x00}},
+		{name: "Negative quotient", op: Div, a: FromInt(-1), b: FromInt(4), want: Number{0x7F, 0x80, 0x00, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got % X, want % X", got[:], tt.want[:])
+			}
+		})
+	}
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	largest := Number{0xFF, 0x7F, 0xFF, 0xFF, 0xFF}
+	tests := []struct {
+		name string
+		op   func(a, b Number) (Number, error)
+		a, b Number
+	}{
+		{name: "Sum", op: Add, a: largest, b: largest},
+		{name: "Difference", op: Sub, a: largest, b: Neg(largest)},
+		{name: "Product", op: Mul, a: largest, b: FromInt(2)},
+		{name: "Quotient", op: Div, a: largest, b: Number{0x80, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Division by zero", op: Div, a: FromInt(1), b: Zero},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.op(tt.a, tt.b); !errors.Is(err, ErrOverflow) {
+				t.Errorf("got % X, %v, want %v", got[:], err, ErrOverflow)
+			}
+		})
+	}
+}
+
+func TestUnderflow(t *testing.T) {
+	smallest := Number{0x01, 0x00, 0x00, 0x00, 0x00}
+	if got, err := Div(smallest, FromInt(4)); err != nil || got != Zero {
+		t.Errorf("Div() = % X, %v, want zero", got[:], err)
+	}
+	if got, err := Mul(smallest, FromInt(-1)); err != nil || got != Neg(smallest) {
+		t.Errorf("Mul() = % X, %v, want % X", got[:], err, Neg(smallest))
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	for a := -65535; a <= 65535; a += 97 {
+		for b := -65535; b <= 65535; b += 89 {
+			sum, err := Add(FromInt(a), FromInt(b))
+			if err != nil {
+				t.Fatalf("Add(%d, %d) error = %v", a, b, err)
+			}
+			if want := a + b; sum.Float64() != float64(want) || sum.IsInt() != (want >= -65536 && want <= 65535) {
+				t.Fatalf("Add(%d, %d) = % X", a, b, sum[:])
+			}
+
+			product, err := Mul(FromInt(a), FromInt(b))
+			if err != nil {
+				t.Fatalf("Mul(%d, %d) error = %v", a, b, err)
+			}
+			want := a * b
+			if product.IsInt() != (abs(want) <= 65535) {
+				t.Fatalf("Mul(%d, %d) = % X", a, b, product[:])
+			}
+			checkClose(t, "Mul", product, float64(want), ulp(float64(want)))
+		}
+	}
+}
+
+func TestMinus65536(t *testing.T) {
+	// The ROM reads the magnitude of -65536 as 0 outside of adding two
+	// small integers
+	n, _ := Add(FromInt(-65535), FromInt(-1))
+	if got := n.Float64(); got != -65536 {
+		t.Errorf("Float64() = %v, want -65536", got)
+	}
+	if got := Neg(n); got != Zero {
+		t.Errorf("Neg() = % X, want zero", got[:])
+	}
+	if got, _ := Mul(n, FromInt(1)); got != Zero {
+		t.Errorf("Mul() = % X, want zero", got[:])
+	}
+	if got, _ := Add(n, FromInt(-1)); got.Float64() != -1 {
+		t.Errorf("Add() = % X, want -1", got[:])
+	}
+}
+
+func TestFloatingPointAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() (Number, float64) {
+		n := pack(byte(96+r.Intn(64)), r.Intn(2) == 0, r.Uint32()|1<<31)
+		return n, n.Float64()
+	}
+	for i := 0; i < 100000; i++ {
+		a, x := random()
+		b, y := random()
+
+		sum, err := Add(a, b)
+		if err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		// The smaller number loses bits as it is lined up with the larger
+		checkClose(t, "Add", sum, x+y, 2*ulp(math.Max(math.Abs(x), math.Abs(y))))
+		product, err := Mul(a, b)
+		if err != nil {
+			t.Fatalf("Mul() error = %v", err)
+		}
+		checkClose(t, "Mul", product, x*y, ulp(x*y))
+		quotient, err := Div(a, b)
+		if err != nil {
+			t.Fatalf("Div() error = %v", err)
+		}
+		checkClose(t, "Div", quotient, x/y, ulp(x/y))
+
+		want := 0
+		if x < y {
+			want = -1
+		} else if x > y {
+			want = 1
+		}
+		if got, err := Compare(a, b); err != nil || got != want {
+			t.Fatalf("Compare(%v, %v) = %d, %v, want %d", x, y, got, err, want)
+		}
+	}
+}
+
+func TestExactResults(t *testing.T) {
+	// Results that fit in 32 bits are exact
+	for _, tt := range []struct{ a, b float64 }{
+		{1.5, 0.25}, {1e9, 3}, {-7.75, 2}, {4294967295, 1}, {0.1, 0},
+	} {
+		a, _ := FromFloat(tt.a)
+		b, _ := FromFloat(tt.b)
+		x, y := a.Float64(), b.Float64()
+		if got, _ := Add(a, b); got.Float64() != x+y {
+			t.Errorf("Add(%v, %v) = %v", a, b, got)
+		}
+		if got, _ := Sub(a, b); got.Float64() != x-y {
+			t.Errorf("Sub(%v, %v) = %v", a, b, got)
+		}
+		if got, _ := Compare(a, a); got != 0 {
+			t.Errorf("Compare(%v, %v) = %d", tt.a, tt.a, got)
+		}
+	}
+	if got, _ := Mul(FromInt(65535), FromInt(65535)); got.Float64() != math.Pow(65535, 2) {
+		t.Errorf("Mul(65535, 65535) = %v", got)
+	}
+}
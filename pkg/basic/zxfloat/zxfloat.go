@@ -0,0 +1,300 @@
+// Package zxfloat handles numbers in the ZX Spectrum's 5-byte form the
+// way the ROM does, so that values converted or calculated here have the
+// same bytes as on a real machine.
+//
+// A number is either a small integer:
+//
+//	00 sign low high 00
+//
+// with the sign byte 00 or FF and the value in two's complement, or a
+// floating point number:
+//
+//	exponent mantissa(4 bytes)
+//
+// with the exponent biased by 128 and a 32-bit mantissa from 0.5 to just
+// under 1. The top mantissa bit is always set, so its place holds the
+// sign. An exponent of 0 with the rest zero is zero.
+package zxfloat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrOverflow is the ROM's report 6, Number too big
+var ErrOverflow = errors.New("number too big")
+
+const (
+	signBit  = 0x80
+	expBias  = 128
+	maxSmall = 65535
+)
+
+// Number is a value in the 5-byte form
+type Number [5]byte
+
+// Zero is the number 0, in the small integer form
+var Zero = Number{}
+
+// FromBytes returns the number held in 5 bytes
+func FromBytes(b []byte) (Number, error) {
+	var n Number
+	if len(b) != len(n) {
+		return n, fmt.Errorf("number must be 5 bytes, got %d", len(b))
+	}
+	copy(n[:], b)
+	return n, nil
+}
+
+// FromInt returns val in the small integer form. Values beyond
+// -65535 to 65535 are stored as floating point.
+func FromInt(val int) Number {
+	if val < -maxSmall || val > maxSmall {
+		n, _ := FromFloat(float64(val))
+		return n
+	}
+	sign := byte(0)
+	if val < 0 {
+		sign = 0xFF
+	}
+	return intStore(uint16(abs(val)), sign)
+}
+
+// FromFloat returns the number nearest to val. Integers from -65535 to
+// 65535 use the small integer form, as the ROM does for numbers typed
+// in a program. Values too small to hold become zero.
+func FromFloat(val float64) (Number, error) {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return Zero, fmt.Errorf("can't store %v", val)
+	}
+	if val == math.Trunc(val) && math.Abs(val) <= maxSmall {
+		return FromInt(int(val)), nil
+	}
+
+	frac, exp := math.Frexp(math.Abs(val))
+	mant := uint64(math.Floor(math.Ldexp(frac, 32) + 0.5))
+	if mant == 1<<32 {
+		mant >>= 1
+		exp++
+	}
+	exp += expBias
+	if exp > 0xFF {
+		return Zero, fmt.Errorf("%v: %w", val, ErrOverflow)
+	}
+	if exp < 1 {
+		return Zero, nil
+	}
+	return pack(byte(exp), val < 0, uint32(mant)), nil
+}
+
+// Parse converts a number as typed in a program, such as 12, .5 or
+// 1.5e-3, with the ROM's DEC-TO-FP. It works digit by digit with the
+// calculator, so the result can differ from the nearest number in the
+// last bit, exactly as on a Spectrum. There is no sign, as a minus in a
+// program is an operator.
+func Parse(s string) (Number, error) {
+	ten := FromInt(10)
+	x := Zero
+	digits := 0
+	var err error
+
+	// Whole part, as x*10+digit
+	i := 0
+	for ; i < len(s) && isDigit(s[i]); i++ {
+		if x, err = Mul(x, ten); err == nil {
+			x, err = Add(x, FromInt(int(s[i]-'0')))
+		}
+		if err != nil {
+			return Zero, fmt.Errorf("%s: %w", s, err)
+		}
+		digits++
+	}
+
+	// Fraction, adding each digit times a scale divided by 10 each time
+	if i < len(s) && s[i] == '.' {
+		scale := FromInt(1)
+		for i++; i < len(s) && isDigit(s[i]); i++ {
+			var d Number
+			if scale, err = Div(scale, ten); err == nil {
+				if d, err = Mul(FromInt(int(s[i]-'0')), scale); err == nil {
+					x, err = Add(x, d)
+				}
+			}
+			if err != nil {
+				return Zero, fmt.Errorf("%s: %w", s, err)
+			}
+			digits++
+		}
+	}
+	if digits == 0 {
+		return Zero, fmt.Errorf("no digits in number %q", s)
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		neg := false
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			neg = s[i] == '-'
+			i++
+		}
+		start := i
+		exp := 0
+		for ; i < len(s) && isDigit(s[i]); i++ {
+			if exp = exp*10 + int(s[i]-'0'); exp > 127 {
+				return Zero, fmt.Errorf("%s: exponent too big: %w", s, ErrOverflow)
+			}
+		}
+		if i == start {
+			return Zero, fmt.Errorf("no digits in exponent of %q", s)
+		}
+		if x, err = scale(x, exp, neg); err != nil {
+			return Zero, fmt.Errorf("%s: %w", s, err)
+		}
+	}
+
+	if i != len(s) {
+		return Zero, fmt.Errorf("invalid number %q", s)
+	}
+	return x, nil
+}
+
+// scale multiplies or divides x by 10 to the power exp, going through
+// the bits of exp and squaring the power of 10 each time, as the ROM's
+// E-TO-FP does
+func scale(x Number, exp int, divide bool) (Number, error) {
+	power := FromInt(10)
+	var err error
+	for exp != 0 {
+		if exp&1 != 0 {
+			if divide {
+				x, err = Div(x, power)
+			} else {
+				x, err = Mul(x, power)
+			}
+			if err != nil {
+				return Zero, err
+			}
+		}
+		if exp >>= 1; exp != 0 {
+			if power, err = Mul(power, power); err != nil {
+				return Zero, err
+			}
+		}
+	}
+	return x, nil
+}
+
+// Float64 returns the value of n. Every number fits a float64 exactly.
+func (n Number) Float64() float64 {
+	if n.IsInt() {
+		val := int(n[2]) | int(n[3])<<8
+		if n[1] == 0xFF {
+			val -= 0x10000
+		}
+		return float64(val)
+	}
+	exp, neg, mant := unpack(n)
+	val := math.Ldexp(float64(mant), int(exp)-expBias-32)
+	if neg {
+		val = -val
+	}
+	return val
+}
+
+// IsInt reports whether n is in the small integer form
+func (n Number) IsInt() bool {
+	return n[0] == 0
+}
+
+// IsZero reports whether n is zero, in either form. Like the ROM, it
+// looks at the first four bytes only.
+func (n Number) IsZero() bool {
+	return n[0]|n[1]|n[2]|n[3] == 0
+}
+
+// Sign returns -1, 0 or 1 as n is negative, zero or positive
+func (n Number) Sign() int {
+	switch {
+	case n.IsZero():
+		return 0
+	case n[1]&signBit != 0:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// String returns the value of n with the fewest significant digits that
+// FromFloat turns back into n, without an exponent unless the value is
+// very large or small
+func (n Number) String() string {
+	val := n.Float64()
+	for digits := 1; digits < 17; digits++ {
+		back, _ := strconv.ParseFloat(strconv.FormatFloat(val, 'g', digits, 64), 64)
+		if m, err := FromFloat(back); err == nil && m == n {
+			val = back
+			break
+		}
+	}
+	if abs := math.Abs(val); abs != 0 && (abs < 1e-5 || abs >= 1e14) {
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// unpack returns the exponent, sign and mantissa of a floating point
+// number, with the top mantissa bit restored
+func unpack(n Number) (exp byte, neg bool, mant uint32) {
+	mant = uint32(n[1]|signBit)<<24 | uint32(n[2])<<16 | uint32(n[3])<<8 | uint32(n[4])
+	return n[0], n[1]&signBit != 0, mant
+}
+
+// pack stores a floating point number, putting the sign in place of the
+// top mantissa bit
+func pack(exp byte, neg bool, mant uint32) Number {
+	top := byte(mant>>24) &^ signBit
+	if neg {
+		top |= signBit
+	}
+	return Number{exp, top, byte(mant >> 16), byte(mant >> 8), byte(mant)}
+}
+
+// intFetch returns the magnitude and sign byte of a small integer, as
+// the ROM's INT-FETCH does. The magnitude of -65536 comes out as 0.
+func intFetch(n Number) (uint16, byte) {
+	sign := n[1]
+	low := n[2] ^ sign
+	borrow := low < sign
+	low -= sign
+	high := n[3] + sign
+	if borrow {
+		high++
+	}
+	return uint16(high^sign)<<8 | uint16(low), sign
+}
+
+// intStore stores a magnitude and sign byte as a small integer, as the
+// ROM's INT-STORE does
+func intStore(mag uint16, sign byte) Number {
+	low := byte(mag) ^ sign
+	borrow := low < sign
+	low -= sign
+	high := byte(mag>>8) + sign
+	if borrow {
+		high++
+	}
+	return Number{0, sign, low, high ^ sign, 0}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func abs(val int) int {
+	if val < 0 {
+		return -val
+	}
+	return val
+}
@@ -0,0 +1,169 @@
+package zxfloat
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestSmallIntegers(t *testing.T) {
+	for val := -65535; val <= 65535; val++ {
+		n := FromInt(val)
+		want := Number{0, 0, byte(val), byte(val >> 8), 0}
+		if val < 0 {
+			want[1] = 0xFF
+		}
+		if n != want {
+			t.Fatalf("FromInt(%d) = % X, want % X", val, n[:], want[:])
+		}
+		if got := n.Float64(); got != float64(val) {
+			t.Fatalf("Float64() = %v, want %d", got, val)
+		}
+		if f, err := FromFloat(float64(val)); err != nil || f != n {
+			t.Fatalf("FromFloat(%d) = % X, %v", val, f[:], err)
+		}
+		if got := n.String(); got != strconv.Itoa(val) {
+			t.Fatalf("String() = %q, want %d", got, val)
+		}
+		if val >= 0 {
+			if p, err := Parse(strconv.Itoa(val)); err != nil || p != n {
+				t.Fatalf("Parse(%d) = % X, %v", val, p[:], err)
+			}
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		name string
+		val  float64
+		want Number
+	}{
+		{name: "Half", val: 0.5, want: Number{0x80, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Negative quarter", val: -0.25, want: Number{0x7F, 0x80, 0x00, 0x00, 0x00}},
+		{name: "Tenth", val: 0.1, want: Number{0x7D, 0x4C, 0xCC, 0xCC, 0xCD}},
+		{name: "PI", val: math.Pi, want: Number{0x82, 0x49, 0x0F, 0xDA, 0xA2}},
+		{name: "Beyond small integers", val: 65536, want: Number{0x91, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Negative beyond small integers", val: -65536, want: Number{0x91, 0x80, 0x00, 0x00, 0x00}},
+		{name: "Largest", val: math.Ldexp(1-math.Ldexp(1, -32), 127), want: Number{0xFF, 0x7F, 0xFF, 0xFF, 0xFF}},
+		{name: "Smallest", val: math.Ldexp(1, -128), want: Number{0x01, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Too small", val: math.Ldexp(1, -130), want: Zero},
+		{name: "Rounds up to the next power of 2", val: 1 - math.Ldexp(1, -34), want: Number{0x81, 0x00, 0x00, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromFloat(tt.val)
+			if err != nil {
+				t.Fatalf("FromFloat() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FromFloat() = % X, want % X", got[:], tt.want[:])
+			}
+		})
+	}
+
+	for _, val := range []float64{math.Ldexp(1, 127), -1e39, math.Inf(1), math.NaN()} {
+		if _, err := FromFloat(val); err == nil {
+			t.Errorf("FromFloat(%v) error = nil", val)
+		}
+	}
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		n := pack(byte(1+r.Intn(255)), r.Intn(2) == 0, r.Uint32()|1<<31)
+
+		val := n.Float64()
+		if val == math.Trunc(val) && math.Abs(val) <= 65535 {
+			continue // Stored as a small integer
+		}
+		if back, err := FromFloat(val); err != nil || back != n {
+			t.Fatalf("FromFloat(%v) = % X, %v, want % X", val, back[:], err, n[:])
+		}
+		s := n.String()
+		parsed, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			t.Fatalf("String() = %q: %v", s, err)
+		}
+		if back, err := FromFloat(parsed); err != nil || back != n {
+			t.Fatalf("String() = %q, which is % X, want % X", s, back[:], n[:])
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Number
+	}{
+		{input: "0.1", want: Number{0x7D, 0x4C, 0xCC, 0xCC, 0xCD}},
+		{input: ".5", want: Number{0x80, 0x00, 0x00, 0x00, 0x00}},
+		{input: "0.3", want: Number{0x7F, 0x19, 0x99, 0x99, 0x9A}},
+		{input: "1e-1", want: Number{0x7D, 0x4C, 0xCC, 0xCC, 0xCD}},
+		{input: "65536", want: Number{0x91, 0x00, 0x00, 0x00, 0x00}},
+		{input: "1e5", want: Number{0x91, 0x43, 0x50, 0x00, 0x00}},
+		{input: "123456789", want: Number{0x9B, 0x6B, 0x79, 0xA2, 0xA0}},
+
+		// Whole numbers end up as small integers however they are typed
+		{input: "1.0", want: FromInt(1)},
+		{input: "1.", want: FromInt(1)},
+		{input: "1e3", want: FromInt(1000)},
+		{input: "1E+3", want: FromInt(1000)},
+		{input: "0065535", want: FromInt(65535)},
+
+		// Adding digit by digit isn't always as close as it could be
+		{input: "31847.84059", want: Number{0x8F, 0x78, 0xCF, 0xAE, 0x63}},
+		{input: "7387.66831", want: Number{0x8D, 0x66, 0xDD, 0x58, 0xB2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = % X, want % X", got[:], tt.want[:])
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"", ".", ".e3", "1e", "1e+", "1.2.3", "1x", "-1", "1e39", "1e128", "1e-64"} {
+		if got, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) = % X, want an error", input, got[:])
+		}
+	}
+}
+
+func TestParseAccuracy(t *testing.T) {
+	// Each digit and power of 10 rounds, but only in the last bits
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		s := strconv.Itoa(r.Intn(100000)) + "." + strconv.Itoa(r.Intn(100000)) + "e" + strconv.Itoa(r.Intn(60)-30)
+		n, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", s, err)
+		}
+		want, _ := strconv.ParseFloat(s, 64)
+		checkClose(t, s, n, want, 4*ulp(want))
+	}
+}
+
+// checkClose fails if n is further than maxErr from want
+func checkClose(t *testing.T, what string, n Number, want, maxErr float64) {
+	t.Helper()
+	if got := n.Float64(); math.Abs(got-want) > maxErr {
+		t.Fatalf("%s = %v (% X), want %v", what, got, n[:], want)
+	}
+}
+
+// ulp returns the value of the last mantissa bit of a number near val
+func ulp(val float64) float64 {
+	_, exp := math.Frexp(val)
+	return math.Ldexp(1, exp-32)
+}
@@ -0,0 +1,167 @@
+package tap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Block represents a single block read from a TAP file
+type Block struct {
+	Flag     byte    // Flag byte (HeaderFlag, DataFlag or a custom value)
+	Data     []byte  // Block payload, excluding flag and checksum
+	Checksum byte    // Checksum stored in the file
+	Computed byte    // Checksum computed from flag and payload
+	Header   *Header // Decoded header, nil if this is not a header block
+	Missing  int     // Bytes of a block cut short by the end of the file
+}
+
+// ErrTruncated reports a file that ends part way through a block
+var ErrTruncated = errors.New("file ends part way through a block")
+
+// Length returns the block length as stored in the TAP file
+func (b *Block) Length() uint16 {
+	return uint16(len(b.Data) + 2) // +2 for flag and checksum
+}
+
+// Valid reports whether the stored checksum matches the computed one.
+// A block cut short has lost its checksum, so it is never valid.
+func (b *Block) Valid() bool {
+	return b.Missing == 0 && b.Checksum == b.Computed
+}
+
+// Bytes returns the raw block contents: flag, payload and stored checksum
+func (b *Block) Bytes() []byte {
+	raw := make([]byte, 0, len(b.Data)+2)
+	raw = append(raw, b.Flag)
+	raw = append(raw, b.Data...)
+	raw = append(raw, b.Checksum)
+	return raw
+}
+
+// UpdateChecksum recalculates the checksum from the flag and payload
+func (b *Block) UpdateChecksum() {
+	b.Computed = calculateChecksum(append([]byte{b.Flag}, b.Data...))
+	b.Checksum = b.Computed
+}
+
+// SetHeader replaces the block contents with the given header
+// and recalculates the checksum
+func (b *Block) SetHeader(h *Header) {
+	b.Flag = HeaderFlag
+	b.Data = h.payload()
+	b.UpdateChecksum()
+
+	header := *h
+	header.BlockLength = HeaderLength
+	header.Flag = HeaderFlag
+	header.Checksum = b.Checksum
+	b.Header = &header
+}
+
+// Name returns the header filename with trailing spaces removed
+func (h *Header) Name() string {
+	return strings.TrimRight(string(h.Filename[:]), " ")
+}
+
+// Reader decodes TAP blocks one at a time from an io.Reader
+type Reader struct {
+	r     io.Reader
+	index int
+}
+
+// NewReader creates a new TAP reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next reads the next block from the input.
+// It returns io.EOF when there are no more blocks. If the input ends part
+// way through a block, the error wraps ErrTruncated, and whatever there
+// is of the block is returned with it, without its checksum.
+func (r *Reader) Next() (*Block, error) {
+	var length uint16
+	if err := binary.Read(r.r, binary.LittleEndian, &length); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = ErrTruncated
+		}
+		return nil, fmt.Errorf("block %d: reading block length: %w", r.index, err)
+	}
+
+	if length < 2 {
+		return nil, fmt.Errorf("block %d: invalid block length %d", r.index, length)
+	}
+
+	raw := make([]byte, length)
+	if n, err := io.ReadFull(r.r, raw); err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("block %d: reading block data: %w", r.index, err)
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("block %d: nothing after the block length: %w", r.index, ErrTruncated)
+		}
+		block := &Block{
+			Flag:     raw[0],
+			Data:     raw[1:n],
+			Computed: calculateChecksum(raw[:n]),
+			Missing:  int(length) - n,
+		}
+		r.index++
+		return block, fmt.Errorf("block %d: %d of %d bytes: %w", r.index-1, n, length, ErrTruncated)
+	}
+
+	block := &Block{
+		Flag:     raw[0],
+		Data:     raw[1 : length-1],
+		Checksum: raw[length-1],
+		Computed: calculateChecksum(raw[:length-1]),
+	}
+
+	// A header block has flag 0x00 and exactly 17 bytes of payload
+	if block.Flag == HeaderFlag && length == HeaderLength {
+		block.Header = decodeHeader(block.Data, block.Checksum)
+	}
+
+	r.index++
+	return block, nil
+}
+
+// ReadBlocks reads all remaining blocks from r. On an error it returns
+// the blocks read so far, including what there is of a block cut short.
+func ReadBlocks(r io.Reader) ([]*Block, error) {
+	tr := NewReader(r)
+	var blocks []*Block
+	for {
+		block, err := tr.Next()
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			if block != nil {
+				blocks = append(blocks, block)
+			}
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+// decodeHeader creates a Header from the 17 byte payload of a header block
+func decodeHeader(data []byte, checksum byte) *Header {
+	header := &Header{
+		BlockLength: HeaderLength,
+		Flag:        HeaderFlag,
+		Type:        data[0],
+		DataLength:  binary.LittleEndian.Uint16(data[11:13]),
+		Param1:      binary.LittleEndian.Uint16(data[13:15]),
+		Param2:      binary.LittleEndian.Uint16(data[15:17]),
+		Checksum:    checksum,
+	}
+	copy(header.Filename[:], data[1:11])
+	return header
+}
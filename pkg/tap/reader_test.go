@@ -0,0 +1,94 @@
+package tap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	var input bytes.Buffer
+	input.Write(createHeaderBlock(Bytes, "screen", 3, 16384, 32768))
+	input.Write(createDataBlock([]byte{1, 2, 3}))
+
+	r := NewReader(&input)
+
+	header, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if header.Header == nil {
+		t.Fatal("Next() header = nil, want decoded header")
+	}
+	if got := header.Header.Name(); got != "screen" {
+		t.Errorf("Header.Name() = %q, want %q", got, "screen")
+	}
+	if header.Header.Type != Bytes || header.Header.DataLength != 3 ||
+		header.Header.Param1 != 16384 || header.Header.Param2 != 32768 {
+		t.Errorf("Header = %+v, want CODE 16384,3", header.Header)
+	}
+	if !header.Valid() {
+		t.Errorf("header checksum 0x%02X, computed 0x%02X", header.Checksum, header.Computed)
+	}
+
+	data, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if data.Header != nil {
+		t.Error("data block decoded as header")
+	}
+	if data.Flag != DataFlag || !bytes.Equal(data.Data, []byte{1, 2, 3}) {
+		t.Errorf("data block = %02X %v, want FF [1 2 3]", data.Flag, data.Data)
+	}
+	if data.Length() != 5 {
+		t.Errorf("Length() = %d, want 5", data.Length())
+	}
+	if !data.Valid() {
+		t.Errorf("data checksum 0x%02X, computed 0x%02X", data.Checksum, data.Computed)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next() at end error = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderBadChecksum(t *testing.T) {
+	raw := createDataBlock([]byte{0xAA, 0x55})
+	raw[len(raw)-1] ^= 0xFF
+
+	blocks, err := ReadBlocks(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadBlocks() error = %v", err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("ReadBlocks() returned %d blocks, want 1", len(blocks))
+	}
+	if blocks[0].Valid() {
+		t.Error("Valid() = true for corrupted checksum")
+	}
+	if !bytes.Equal(blocks[0].Bytes(), raw[2:]) {
+		t.Errorf("Bytes() = %v, want %v", blocks[0].Bytes(), raw[2:])
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "Partial length", input: []byte{0x05}},
+		{name: "Short block", input: []byte{0x05, 0x00, 0xFF, 0x01}},
+		{name: "Length too small", input: []byte{0x01, 0x00, 0xFF}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tt.input)).Next()
+			if err == nil || errors.Is(err, io.EOF) {
+				t.Errorf("Next() error = %v, want decoding error", err)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -52,49 +53,45 @@ func createHeaderBlock(blockType byte, filename string, dataLength uint16, param
 		Param1:      param1,
 		Param2:      param2,
 	}
+	header.SetName(filename)
 
-	// Pad filename with spaces
-	copy(header.Filename[:], []byte(filename))
-	for i := len(filename); i < 10; i++ {
-		header.Filename[i] = ' '
+	return createBlock(HeaderFlag, header.payload())
+}
+
+// SetName sets the header filename, padding it with spaces
+func (h *Header) SetName(name string) {
+	copy(h.Filename[:], []byte(name))
+	for i := len(name); i < 10; i++ {
+		h.Filename[i] = ' '
 	}
+}
 
-	// Create buffer for header data
-	headerData := make([]byte, 0, HeaderLength+2) // +2 for block length
+// payload returns the 17 header bytes between the flag and the checksum
+func (h *Header) payload() []byte {
+	data := make([]byte, 0, HeaderLength-2) // -2 for flag and checksum
+	data = append(data, h.Type)
+	data = append(data, h.Filename[:]...)
 
-	// Write block length
 	buf := make([]byte, 2)
-	binary.LittleEndian.PutUint16(buf, header.BlockLength)
-	headerData = append(headerData, buf...)
-
-	// Build header data for checksum calculation
-	checksumData := make([]byte, 0, HeaderLength-1) // -1 as checksum isn't included
-	checksumData = append(checksumData, header.Flag)
-	checksumData = append(checksumData, header.Type)
-	checksumData = append(checksumData, header.Filename[:]...)
+	binary.LittleEndian.PutUint16(buf, h.DataLength)
+	data = append(data, buf...)
 
-	buf = make([]byte, 2)
-	binary.LittleEndian.PutUint16(buf, header.DataLength)
-	checksumData = append(checksumData, buf...)
-
-	binary.LittleEndian.PutUint16(buf, header.Param1)
-	checksumData = append(checksumData, buf...)
-
-	binary.LittleEndian.PutUint16(buf, header.Param2)
-	checksumData = append(checksumData, buf...)
-
-	// Calculate and append checksum
-	header.Checksum = calculateChecksum(checksumData)
+	binary.LittleEndian.PutUint16(buf, h.Param1)
+	data = append(data, buf...)
 
-	// Build final header block
-	headerData = append(headerData, checksumData...)
-	headerData = append(headerData, header.Checksum)
+	binary.LittleEndian.PutUint16(buf, h.Param2)
+	data = append(data, buf...)
 
-	return headerData
+	return data
 }
 
 // createDataBlock creates a TAP data block
 func createDataBlock(data []byte) []byte {
+	return createBlock(DataFlag, data)
+}
+
+// createBlock creates a TAP block with the given flag byte
+func createBlock(flag byte, data []byte) []byte {
 	blockLength := uint16(len(data) + 2) // +2 for flag and checksum
 
 	// Create buffer for data block
@@ -106,7 +103,7 @@ func createDataBlock(data []byte) []byte {
 	dataBlock = append(dataBlock, buf...)
 
 	// Write flag
-	dataBlock = append(dataBlock, DataFlag)
+	dataBlock = append(dataBlock, flag)
 
 	// Write data
 	dataBlock = append(dataBlock, data...)
@@ -119,21 +116,42 @@ func createDataBlock(data []byte) []byte {
 	return dataBlock
 }
 
-// BinaryToTAP converts a binary file to TAP format
+// BinaryFile is one input file of BinariesToTAP
+type BinaryFile struct {
+	Path    string
+	Name    string // Header name, derived from the file name if empty
+	Address uint16 // Start address stored in the header
+}
+
+// BinaryOptions controls how binary files are written by BinariesToTAP
+type BinaryOptions struct {
+	Headerless bool // Write data blocks only, without headers
+	Flag       byte // Flag byte of the data blocks
+}
+
+// BinaryToTAP converts a binary file to TAP format. The header's Param2
+// is 32768, as SAVE ... CODE stores it in the ROM; versions before the
+// TAP writer stored 0, which loaders ignore.
 func BinaryToTAP(inputPath, outputPath, name string, startAddress uint16) error {
-	// Read input file
-	inputData, err := os.ReadFile(inputPath)
-	if err != nil {
-		return fmt.Errorf("reading input file: %w", err)
-	}
+	return BinariesToTAP([]BinaryFile{{Path: inputPath, Name: name, Address: startAddress}}, outputPath,
+		BinaryOptions{Flag: DataFlag})
+}
 
-	// Use input filename if no name provided
-	if name == "" {
-		name = filepath.Base(inputPath)
-		name = strings.TrimSuffix(name, filepath.Ext(name))
-		if len(name) > 10 {
-			name = name[:10]
+// BinariesToTAP converts one or more binary files into consecutive blocks
+// of a single TAP file. Unless opts.Headerless is set, each data block is
+// preceded by a CODE header with the file's own name and address.
+func BinariesToTAP(files []BinaryFile, outputPath string, opts BinaryOptions) error {
+	// Read all input files first so a bad path doesn't leave a partial tape
+	inputs := make([][]byte, len(files))
+	for i, file := range files {
+		inputData, err := os.ReadFile(file.Path)
+		if err != nil {
+			return fmt.Errorf("reading input file: %w", err)
+		}
+		if len(inputData) > MaxDataLength {
+			return fmt.Errorf("%s: too long for a TAP block (%d bytes, maximum is %d)", file.Path, len(inputData), MaxDataLength)
 		}
+		inputs[i] = inputData
 	}
 
 	// Create output file
@@ -143,34 +161,73 @@ func BinaryToTAP(inputPath, outputPath, name string, startAddress uint16) error
 	}
 	defer outFile.Close()
 
-	// Create and write header block for bytes
-	headerBlock := createHeaderBlock(Bytes, name, uint16(len(inputData)), startAddress, 0)
-	if _, err := outFile.Write(headerBlock); err != nil {
-		return fmt.Errorf("writing header block: %w", err)
-	}
+	w := NewWriter(outFile)
+	for i, inputData := range inputs {
+		file := files[i]
+		if !opts.Headerless {
+			// Use input filename if no name provided
+			name := file.Name
+			if name == "" {
+				name = filepath.Base(file.Path)
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+				if len(name) > 10 {
+					name = name[:10]
+				}
+			}
+
+			if err := w.WriteHeader(Bytes, name, uint16(len(inputData)), file.Address, defaultParam2); err != nil {
+				return fmt.Errorf("%s: %w", file.Path, err)
+			}
+		}
 
-	// Create and write data block
-	dataBlock := createDataBlock(inputData)
-	if _, err := outFile.Write(dataBlock); err != nil {
-		return fmt.Errorf("writing data block: %w", err)
+		if err := w.WriteBlock(opts.Flag, inputData); err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
 	}
 
 	return nil
 }
 
-// WriteBasicToTAP writes a BASIC program to TAP format
-func WriteBasicToTAP(w io.Writer, name string, data []byte, autostart uint16) error {
-	// Create and write header block for BASIC program
-	headerBlock := createHeaderBlock(Program, name, uint16(len(data)), autostart, uint16(len(data)))
-	if _, err := w.Write(headerBlock); err != nil {
-		return fmt.Errorf("writing header block: %w", err)
+// ListBinaryFiles pairs input paths with comma-separated lists of header
+// names and start addresses, one entry for each file in order. A file
+// without a name, or with an empty one, is named after the file; a file
+// without an address, or with an empty one, starts at 32768.
+func ListBinaryFiles(paths []string, names, addresses string) ([]BinaryFile, error) {
+	files := make([]BinaryFile, len(paths))
+	for i, path := range paths {
+		files[i] = BinaryFile{Path: path, Address: 32768}
 	}
 
-	// Create and write data block
-	dataBlock := createDataBlock(data)
-	if _, err := w.Write(dataBlock); err != nil {
-		return fmt.Errorf("writing data block: %w", err)
+	if names != "" {
+		list := strings.Split(names, ",")
+		if len(list) > len(files) {
+			return nil, fmt.Errorf("%d names given for %d files", len(list), len(files))
+		}
+		for i, name := range list {
+			files[i].Name = strings.TrimSpace(name)
+		}
 	}
+	if addresses != "" {
+		list := strings.Split(addresses, ",")
+		if len(list) > len(files) {
+			return nil, fmt.Errorf("%d addresses given for %d files", len(list), len(files))
+		}
+		for i, address := range list {
+			address = strings.TrimSpace(address)
+			if address == "" {
+				continue
+			}
+			value, err := strconv.ParseUint(address, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", address, err)
+			}
+			files[i].Address = uint16(value)
+		}
+	}
+	return files, nil
+}
 
-	return nil
-}
\ No newline at end of file
+// WriteBasicToTAP writes a BASIC program to TAP format
+func WriteBasicToTAP(w io.Writer, name string, data []byte, autostart uint16) error {
+	return NewWriter(w).WriteProgram(name, data, autostart)
+}
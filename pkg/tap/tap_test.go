@@ -0,0 +1,173 @@
+package tap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBinariesToTAP(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.bin")
+	second := filepath.Join(dir, "second.bin")
+	if err := os.WriteFile(first, []byte{1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte{4, 5}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		files     []BinaryFile
+		opts      BinaryOptions
+		wantFlags []byte
+	}{
+		{
+			name:      "With headers",
+			files:     []BinaryFile{{Path: first, Address: 40000}, {Path: second, Name: "two", Address: 50000}},
+			opts:      BinaryOptions{Flag: DataFlag},
+			wantFlags: []byte{HeaderFlag, DataFlag, HeaderFlag, DataFlag},
+		},
+		{
+			name:      "Headerless custom flag",
+			files:     []BinaryFile{{Path: first}, {Path: second}},
+			opts:      BinaryOptions{Headerless: true, Flag: 0x42},
+			wantFlags: []byte{0x42, 0x42},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(dir, "out.tap")
+			if err := BinariesToTAP(tt.files, output, tt.opts); err != nil {
+				t.Fatalf("BinariesToTAP() error = %v", err)
+			}
+
+			file, err := os.Open(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			blocks, err := ReadBlocks(file)
+			if err != nil {
+				t.Fatalf("ReadBlocks() error = %v", err)
+			}
+			if len(blocks) != len(tt.wantFlags) {
+				t.Fatalf("got %d blocks, want %d", len(blocks), len(tt.wantFlags))
+			}
+			for i, block := range blocks {
+				if block.Flag != tt.wantFlags[i] {
+					t.Errorf("block %d flag = 0x%02X, want 0x%02X", i, block.Flag, tt.wantFlags[i])
+				}
+				if !block.Valid() {
+					t.Errorf("block %d: invalid checksum", i)
+				}
+			}
+			if !tt.opts.Headerless {
+				for i, want := range []struct {
+					name    string
+					address uint16
+				}{{"first", 40000}, {"two", 50000}} {
+					h := blocks[2*i].Header
+					if h.Name() != want.name || h.Param1 != want.address {
+						t.Errorf("header %d = %q at %d, want %q at %d", i, h.Name(), h.Param1, want.name, want.address)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBinaryToTAPHeader(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "code.bin")
+	if err := os.WriteFile(input, []byte{0xC9}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.tap")
+	if err := BinaryToTAP(input, output, "", 40000); err != nil {
+		t.Fatalf("BinaryToTAP() error = %v", err)
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	blocks, err := ReadBlocks(file)
+	if err != nil {
+		t.Fatalf("ReadBlocks() error = %v", err)
+	}
+	h := blocks[0].Header
+	if h == nil || h.Type != Bytes || h.Name() != "code" || h.DataLength != 1 || h.Param1 != 40000 {
+		t.Fatalf("header = %+v, want CODE 40000,1 named code", h)
+	}
+	// SAVE ... CODE stores 32768 in Param2
+	if h.Param2 != 32768 {
+		t.Errorf("Param2 = %d, want 32768", h.Param2)
+	}
+}
+
+func TestListBinaryFiles(t *testing.T) {
+	paths := []string{"a.bin", "b.bin", "c.bin"}
+	tests := []struct {
+		name      string
+		names     string
+		addresses string
+		want      []BinaryFile
+	}{
+		{
+			name: "Defaults",
+			want: []BinaryFile{{Path: "a.bin", Address: 32768}, {Path: "b.bin", Address: 32768}, {Path: "c.bin", Address: 32768}},
+		},
+		{
+			name:      "Fewer entries than files",
+			names:     "one",
+			addresses: "0x8000",
+			want:      []BinaryFile{{Path: "a.bin", Name: "one", Address: 0x8000}, {Path: "b.bin", Address: 32768}, {Path: "c.bin", Address: 32768}},
+		},
+		{
+			name:      "Empty name",
+			names:     "one,,three",
+			addresses: "0x8000,40000",
+			want:      []BinaryFile{{Path: "a.bin", Name: "one", Address: 0x8000}, {Path: "b.bin", Address: 40000}, {Path: "c.bin", Name: "three", Address: 32768}},
+		},
+		{
+			name:      "Empty address",
+			addresses: "30000,,40000",
+			want:      []BinaryFile{{Path: "a.bin", Address: 30000}, {Path: "b.bin", Address: 32768}, {Path: "c.bin", Address: 40000}},
+		},
+		{
+			name:      "Empty name and address",
+			names:     ",two",
+			addresses: ",",
+			want:      []BinaryFile{{Path: "a.bin", Address: 32768}, {Path: "b.bin", Name: "two", Address: 32768}, {Path: "c.bin", Address: 32768}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := ListBinaryFiles(paths, tt.names, tt.addresses)
+			if err != nil {
+				t.Fatalf("ListBinaryFiles() error = %v", err)
+			}
+			if !reflect.DeepEqual(files, tt.want) {
+				t.Errorf("ListBinaryFiles() = %+v, want %+v", files, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct{ names, addresses string }{
+		{names: "a,b,c,d"},
+		{addresses: "1,2,3,4"},
+		{addresses: "65536"},
+		{addresses: "x"},
+	} {
+		if _, err := ListBinaryFiles([]string{"a.bin", "b.bin", "c.bin"}, tt.names, tt.addresses); err == nil {
+			t.Errorf("ListBinaryFiles(%q, %q) error = nil", tt.names, tt.addresses)
+		}
+	}
+}
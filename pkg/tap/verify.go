@@ -0,0 +1,110 @@
+package tap
+
+import "fmt"
+
+// ProblemKind identifies the kind of inconsistency found in a TAP file
+type ProblemKind int
+
+const (
+	BadChecksum    ProblemKind = iota // Stored checksum differs from the computed one
+	LengthMismatch                    // Header DataLength differs from the following block
+	MissingData                       // Header is not followed by a data block
+	Truncated                         // Block is cut short by the end of the file
+)
+
+// Problem describes an inconsistency found in a TAP file
+type Problem struct {
+	Block   int         // Index of the affected block
+	Kind    ProblemKind // What is wrong
+	Message string      // Human readable description
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("block %d: %s", p.Block, p.Message)
+}
+
+// Verify checks the checksum of every block and that every header's
+// DataLength matches the length of the data block that follows it
+func Verify(blocks []*Block) []Problem {
+	var problems []Problem
+
+	for i, block := range blocks {
+		if block.Missing > 0 {
+			problems = append(problems, Problem{
+				Block:   i,
+				Kind:    Truncated,
+				Message: fmt.Sprintf("file ends %d bytes before the end of the block", block.Missing),
+			})
+		} else if !block.Valid() {
+			problems = append(problems, Problem{
+				Block: i,
+				Kind:  BadChecksum,
+				Message: fmt.Sprintf("checksum 0x%02X does not match computed 0x%02X",
+					block.Checksum, block.Computed),
+			})
+		}
+
+		if block.Header == nil {
+			continue
+		}
+
+		if i+1 >= len(blocks) || blocks[i+1].Flag == HeaderFlag {
+			problems = append(problems, Problem{
+				Block:   i,
+				Kind:    MissingData,
+				Message: fmt.Sprintf("header %q is not followed by a data block", block.Header.Name()),
+			})
+			continue
+		}
+
+		if length := len(blocks[i+1].Data); int(block.Header.DataLength) != length {
+			problems = append(problems, Problem{
+				Block: i,
+				Kind:  LengthMismatch,
+				Message: fmt.Sprintf("header %q declares %d bytes but data block has %d",
+					block.Header.Name(), block.Header.DataLength, length),
+			})
+		}
+	}
+
+	return problems
+}
+
+// Repair fixes the problems Verify reports, in place. Checksums are always
+// recomputed; header lengths are only corrected when fixLengths is set.
+// A block cut short is rebuilt from the bytes that remain, with a new
+// checksum. It returns the problems that were fixed.
+func Repair(blocks []*Block, fixLengths bool) []Problem {
+	var fixed []Problem
+
+	for _, problem := range Verify(blocks) {
+		block := blocks[problem.Block]
+
+		switch problem.Kind {
+		case BadChecksum:
+			block.UpdateChecksum()
+		case Truncated:
+			block.Missing = 0
+			block.UpdateChecksum()
+			problem.Message += fmt.Sprintf("; rebuilt with the %d bytes that remain", len(block.Data)+1)
+		case LengthMismatch:
+			if !fixLengths {
+				continue
+			}
+			header := *block.Header
+			length := uint16(len(blocks[problem.Block+1].Data))
+			if header.Type == Program && (header.Param2 == header.DataLength || header.Param2 > length) {
+				// Keep the program length in step when there are no variables
+				header.Param2 = length
+			}
+			header.DataLength = length
+			block.SetHeader(&header)
+		default:
+			continue
+		}
+
+		fixed = append(fixed, problem)
+	}
+
+	return fixed
+}
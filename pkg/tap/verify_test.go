@@ -0,0 +1,149 @@
+package tap
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAndRepair(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.WriteBytes("code", []byte{1, 2, 3, 4}, 32768); err != nil {
+		t.Fatalf("WriteBytes() error = %v", err)
+	}
+	if err := w.WriteProgram("prog", []byte{0, 10, 2, 0, 0xFB, 0x0D}, 10); err != nil {
+		t.Fatalf("WriteProgram() error = %v", err)
+	}
+
+	blocks, err := ReadBlocks(&buf)
+	if err != nil {
+		t.Fatalf("ReadBlocks() error = %v", err)
+	}
+	if problems := Verify(blocks); len(problems) != 0 {
+		t.Fatalf("Verify() on clean tape = %v, want none", problems)
+	}
+
+	// Corrupt a checksum and truncate the CODE data
+	blocks[0].Checksum ^= 0x01
+	blocks[1].Data = blocks[1].Data[:3]
+	blocks[1].UpdateChecksum()
+	blocks[3].Data = append(blocks[3].Data, 0x80)
+	blocks[3].UpdateChecksum()
+
+	problems := Verify(blocks)
+	kinds := map[ProblemKind]int{}
+	for _, p := range problems {
+		kinds[p.Kind]++
+	}
+	if kinds[BadChecksum] != 1 || kinds[LengthMismatch] != 2 {
+		t.Fatalf("Verify() = %v, want 1 checksum and 2 length problems", problems)
+	}
+
+	if fixed := Repair(blocks, false); len(fixed) != 1 {
+		t.Errorf("Repair(fixLengths=false) fixed %d problems, want 1", len(fixed))
+	}
+	if fixed := Repair(blocks, true); len(fixed) != 2 {
+		t.Errorf("Repair(fixLengths=true) fixed %d problems, want 2", len(fixed))
+	}
+	if problems := Verify(blocks); len(problems) != 0 {
+		t.Errorf("Verify() after repair = %v, want none", problems)
+	}
+
+	if blocks[0].Header.DataLength != 3 {
+		t.Errorf("CODE DataLength = %d, want 3", blocks[0].Header.DataLength)
+	}
+	if h := blocks[2].Header; h.DataLength != 7 || h.Param2 != 7 {
+		t.Errorf("Program DataLength/Param2 = %d/%d, want 7/7", h.DataLength, h.Param2)
+	}
+
+	// Repaired blocks must survive a write/read round trip
+	var out bytes.Buffer
+	if err := WriteBlocks(&out, blocks); err != nil {
+		t.Fatalf("WriteBlocks() error = %v", err)
+	}
+	reread, err := ReadBlocks(&out)
+	if err != nil {
+		t.Fatalf("ReadBlocks() error = %v", err)
+	}
+	if problems := Verify(reread); len(problems) != 0 {
+		t.Errorf("Verify() after round trip = %v, want none", problems)
+	}
+}
+
+func TestVerifyMissingData(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.WriteHeader(Bytes, "orphan", 10, 0, 0); err != nil {
+		t.Fatalf("WriteHeader() error = %v", err)
+	}
+
+	blocks, err := ReadBlocks(&buf)
+	if err != nil {
+		t.Fatalf("ReadBlocks() error = %v", err)
+	}
+	problems := Verify(blocks)
+	if len(problems) != 1 || problems[0].Kind != MissingData {
+		t.Errorf("Verify() = %v, want one MissingData problem", problems)
+	}
+}
+
+func TestRepairTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.WriteBytes("code", []byte{1, 2, 3, 4}, 32768); err != nil {
+		t.Fatalf("WriteBytes() error = %v", err)
+	}
+	tape := buf.Bytes()
+
+	t.Run("Rebuilt", func(t *testing.T) {
+		// Lose the checksum and the last data byte
+		blocks, err := ReadBlocks(bytes.NewReader(tape[:len(tape)-2]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("ReadBlocks() error = %v, want %v", err, ErrTruncated)
+		}
+		if len(blocks) != 2 || blocks[1].Missing != 2 || blocks[1].Valid() {
+			t.Fatalf("ReadBlocks() = %d blocks, want the header and the short block", len(blocks))
+		}
+		problems := Verify(blocks)
+		if len(problems) != 2 || problems[0].Kind != LengthMismatch || problems[1].Kind != Truncated {
+			t.Fatalf("Verify() = %v, want a length problem and a truncated block", problems)
+		}
+
+		fixed := Repair(blocks, true)
+		if len(fixed) != 2 || !strings.Contains(fixed[1].Message, "rebuilt") {
+			t.Errorf("Repair() = %v, want the block rebuilt", fixed)
+		}
+		var out bytes.Buffer
+		if err := WriteBlocks(&out, blocks); err != nil {
+			t.Fatalf("WriteBlocks() error = %v", err)
+		}
+		reread, err := ReadBlocks(&out)
+		if err != nil {
+			t.Fatalf("ReadBlocks() error = %v", err)
+		}
+		if problems := Verify(reread); len(problems) != 0 {
+			t.Errorf("Verify() after repair = %v, want none", problems)
+		}
+		if !bytes.Equal(reread[1].Data, []byte{1, 2, 3}) || reread[0].Header.DataLength != 3 {
+			t.Errorf("rebuilt data = %v with length %d, want [1 2 3]", reread[1].Data, reread[0].Header.DataLength)
+		}
+	})
+
+	t.Run("Dropped", func(t *testing.T) {
+		// Only the length of the data block is left
+		header := 2 + HeaderLength
+		blocks, err := ReadBlocks(bytes.NewReader(tape[:header+2]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("ReadBlocks() error = %v, want %v", err, ErrTruncated)
+		}
+		if len(blocks) != 1 || blocks[0].Header == nil {
+			t.Fatalf("ReadBlocks() = %d blocks, want the header only", len(blocks))
+		}
+		problems := Verify(blocks)
+		if len(problems) != 1 || problems[0].Kind != MissingData {
+			t.Errorf("Verify() = %v, want the header's data missing", problems)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package tap
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// MaxDataLength is the largest payload a single TAP block can hold
+	MaxDataLength = 0xFFFF - 2
+
+	// Param2 value the ROM stores for CODE and array headers
+	defaultParam2 = 32768
+)
+
+// Writer appends blocks to a TAP stream
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter creates a new TAP writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteBlock writes a single block with the given flag byte.
+// The block length and checksum are calculated automatically.
+func (w *Writer) WriteBlock(flag byte, data []byte) error {
+	if len(data) > MaxDataLength {
+		return fmt.Errorf("block too long: %d bytes (maximum is %d)", len(data), MaxDataLength)
+	}
+	if _, err := w.w.Write(createBlock(flag, data)); err != nil {
+		return fmt.Errorf("writing block: %w", err)
+	}
+	return nil
+}
+
+// WriteHeader writes a standard 17 byte header block
+func (w *Writer) WriteHeader(blockType byte, name string, dataLength, param1, param2 uint16) error {
+	if _, err := w.w.Write(createHeaderBlock(blockType, name, dataLength, param1, param2)); err != nil {
+		return fmt.Errorf("writing header block: %w", err)
+	}
+	return nil
+}
+
+// WriteHeaderless writes a data block without a preceding header
+func (w *Writer) WriteHeaderless(data []byte) error {
+	return w.WriteBlock(DataFlag, data)
+}
+
+// WriteProgram writes a BASIC program header and data block
+func (w *Writer) WriteProgram(name string, data []byte, autostart uint16) error {
+	return w.writePair(Program, name, data, autostart, uint16(len(data)))
+}
+
+// WriteProgramWithVariables writes a BASIC program header and data block
+// where data holds the program followed by its variables area, which
+// starts at length. Param2 is set to length, as SAVE does, so that LOAD
+// finds the variables.
+func (w *Writer) WriteProgramWithVariables(name string, data []byte, autostart, length uint16) error {
+	if int(length) > len(data) {
+		return fmt.Errorf("program length %d is more than the %d bytes of data", length, len(data))
+	}
+	return w.writePair(Program, name, data, autostart, length)
+}
+
+// WriteBytes writes a CODE header and data block loading at start
+func (w *Writer) WriteBytes(name string, data []byte, start uint16) error {
+	return w.writePair(Bytes, name, data, start, defaultParam2)
+}
+
+// WriteNumberArray writes a numeric array (SAVE "name" DATA a()) header
+// and data block. The data must already be in the ROM array format,
+// starting at the number of dimensions.
+func (w *Writer) WriteNumberArray(name string, variable byte, data []byte) error {
+	param1, err := arrayParam(variable, Data)
+	if err != nil {
+		return err
+	}
+	return w.writePair(Data, name, data, param1, defaultParam2)
+}
+
+// WriteCharArray writes a character array (SAVE "name" DATA a$()) header
+// and data block. The data must already be in the ROM array format,
+// starting at the number of dimensions.
+func (w *Writer) WriteCharArray(name string, variable byte, data []byte) error {
+	param1, err := arrayParam(variable, Chars)
+	if err != nil {
+		return err
+	}
+	return w.writePair(Chars, name, data, param1, defaultParam2)
+}
+
+// WriteRaw writes a block exactly as it is, including its stored checksum
+func (w *Writer) WriteRaw(b *Block) error {
+	if len(b.Data) > MaxDataLength {
+		return fmt.Errorf("block too long: %d bytes (maximum is %d)", len(b.Data), MaxDataLength)
+	}
+	length := b.Length()
+	if _, err := w.w.Write([]byte{byte(length), byte(length >> 8)}); err != nil {
+		return fmt.Errorf("writing block length: %w", err)
+	}
+	if _, err := w.w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("writing block: %w", err)
+	}
+	return nil
+}
+
+// WriteBlocks writes all blocks to w exactly as they are
+func WriteBlocks(w io.Writer, blocks []*Block) error {
+	tw := NewWriter(w)
+	for i, block := range blocks {
+		if err := tw.WriteRaw(block); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// writePair writes a header block followed by its data block
+func (w *Writer) writePair(blockType byte, name string, data []byte, param1, param2 uint16) error {
+	if len(data) > MaxDataLength {
+		return fmt.Errorf("data too long: %d bytes (maximum is %d)", len(data), MaxDataLength)
+	}
+	if err := w.WriteHeader(blockType, name, uint16(len(data)), param1, param2); err != nil {
+		return err
+	}
+	return w.WriteBlock(DataFlag, data)
+}
+
+// arrayParam returns Param1 for an array header. The high byte holds
+// the array name as it appears in the variables area.
+func arrayParam(variable byte, blockType byte) (uint16, error) {
+	if variable >= 'A' && variable <= 'Z' {
+		variable += 'a' - 'A'
+	}
+	if variable < 'a' || variable > 'z' {
+		return 0, fmt.Errorf("invalid array name %q (must be a single letter)", variable)
+	}
+
+	name := variable&0x1F | 0x80 // 100xxxxx for numeric arrays
+	if blockType == Chars {
+		name = variable&0x1F | 0xC0 // 110xxxxx for character arrays
+	}
+	return uint16(name) << 8, nil
+}
+
+// ArrayName returns the letter of the array stored in a Data or Chars header
+func (h *Header) ArrayName() byte {
+	return byte(h.Param1>>8)&0x1F | 0x60
+}
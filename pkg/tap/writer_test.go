@@ -0,0 +1,96 @@
+package tap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	program := []byte{0x00, 0x0A, 0x02, 0x00, 0xFB, 0x0D}
+	screen := make([]byte, 6912)
+
+	if err := w.WriteProgram("loader", program, 10); err != nil {
+		t.Fatalf("WriteProgram() error = %v", err)
+	}
+	if err := w.WriteBytes("screen", screen, 16384); err != nil {
+		t.Fatalf("WriteBytes() error = %v", err)
+	}
+	if err := w.WriteNumberArray("level", 'L', []byte{1, 1, 0, 0, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatalf("WriteNumberArray() error = %v", err)
+	}
+	if err := w.WriteCharArray("names", 'n', []byte{1, 2, 0, 'h', 'i'}); err != nil {
+		t.Fatalf("WriteCharArray() error = %v", err)
+	}
+	if err := w.WriteProgramWithVariables("scores", append(program, 0x61, 0, 0, 5, 0, 0), 0x8000, 6); err != nil {
+		t.Fatalf("WriteProgramWithVariables() error = %v", err)
+	}
+	if err := w.WriteBlock(0x42, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("WriteBlock() error = %v", err)
+	}
+
+	blocks, err := ReadBlocks(&buf)
+	if err != nil {
+		t.Fatalf("ReadBlocks() error = %v", err)
+	}
+	if len(blocks) != 11 {
+		t.Fatalf("ReadBlocks() returned %d blocks, want 11", len(blocks))
+	}
+
+	for i, block := range blocks {
+		if !block.Valid() {
+			t.Errorf("block %d: invalid checksum", i)
+		}
+	}
+
+	headers := []struct {
+		index    int
+		typ      byte
+		name     string
+		length   uint16
+		param1   uint16
+		param2   uint16
+		variable byte
+	}{
+		{index: 0, typ: Program, name: "loader", length: 6, param1: 10, param2: 6},
+		{index: 2, typ: Bytes, name: "screen", length: 6912, param1: 16384, param2: 32768},
+		{index: 4, typ: Data, name: "level", length: 9, param1: 0x8C00, param2: 32768, variable: 'l'},
+		{index: 6, typ: Chars, name: "names", length: 5, param1: 0xCE00, param2: 32768, variable: 'n'},
+		{index: 8, typ: Program, name: "scores", length: 12, param1: 0x8000, param2: 6},
+	}
+
+	for _, want := range headers {
+		h := blocks[want.index].Header
+		if h == nil {
+			t.Errorf("block %d: missing header", want.index)
+			continue
+		}
+		if h.Type != want.typ || h.Name() != want.name || h.DataLength != want.length ||
+			h.Param1 != want.param1 || h.Param2 != want.param2 {
+			t.Errorf("block %d: header = %+v, want %+v", want.index, h, want)
+		}
+		if want.variable != 0 && h.ArrayName() != want.variable {
+			t.Errorf("block %d: ArrayName() = %c, want %c", want.index, h.ArrayName(), want.variable)
+		}
+		if got := len(blocks[want.index+1].Data); got != int(want.length) {
+			t.Errorf("block %d: data length = %d, want %d", want.index+1, got, want.length)
+		}
+	}
+
+	if blocks[10].Flag != 0x42 || blocks[10].Header != nil {
+		t.Errorf("custom block flag = 0x%02X, want 0x42", blocks[10].Flag)
+	}
+
+	if err := w.WriteProgramWithVariables("x", program, 0, 7); err == nil {
+		t.Error("WriteProgramWithVariables() with length past the data error = nil")
+	}
+}
+
+func TestWriterInvalidArrayName(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	if err := w.WriteNumberArray("bad", '1', []byte{1, 1, 0}); err == nil {
+		t.Error("WriteNumberArray() with digit name: error = nil, want error")
+	}
+}